@@ -17,17 +17,17 @@ package diag
 import (
 	"bufio"
 	"bytes"
-	"encoding/xml"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
 	"os/user"
 	"path/filepath"
 	"reflect"
 	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -46,37 +46,85 @@ const (
 	ClientSecret = "ClientSecret"
 	// RefreshToken allows the client to obtain a new access token.
 	RefreshToken = "RefreshToken"
+	// LoginCustomerID is the manager account ID sent in the login-customer-id
+	// header when accessing a client account through a manager account.
+	// https://developers.google.com/google-ads/api/docs/concepts/call-structure#login-customer-id
+	LoginCustomerID = "LoginCustomerID"
+	// LinkedCustomerID is the account ID sent in the linked-customer-id
+	// header when a third-party app analytics provider accesses a customer
+	// account through a linked account.
+	// https://developers.google.com/google-ads/api/docs/concepts/call-structure#linked-customer-id
+	LinkedCustomerID = "LinkedCustomerID"
+	// JSONKeyFilePath is the path to a service account JSON key file.
+	// https://developers.google.com/google-ads/api/docs/oauth/service-accounts
+	JSONKeyFilePath = "JSONKeyFilePath"
+	// ImpersonatedEmail is the user email impersonated by a service account.
+	ImpersonatedEmail = "ImpersonatedEmail"
+	// UseProtoPlus selects the message type of the Python client library.
+	// https://developers.google.com/google-ads/api/docs/client-libs/python/proto-getters
+	UseProtoPlus = "UseProtoPlus"
 )
 
+// ConfigPathEnv is the environment variable of the configuration file path
+// that the client libraries read when no path is given.
+const ConfigPathEnv = "GOOGLE_ADS_CONFIGURATION_FILE_PATH"
+
+// Mask replaces the secret values redacted from log output.
+const Mask = "*****"
+
+// SecretWords is a slice of constant strings that indicate the keys whose
+// values are redacted by ConfigFile.Redact.
+var SecretWords = []string{DevToken, ClientSecret, RefreshToken}
+
 // PIIWords is a slice of constant strings that indicate Personally Identifiable Information
-var PIIWords = []string{DevToken, ClientID, ClientSecret, RefreshToken}
+var PIIWords = []string{DevToken, ClientID, ClientSecret, RefreshToken, ImpersonatedEmail}
 
 // RequiredKeys are the key names used in the Language structure that defines
-//  the contents of a client library configuration file.
+// the contents of a client library configuration file.
 var RequiredKeys = []string{DevToken, ClientID, ClientSecret, RefreshToken}
 
 // Config is the collection of language specific elements.
 type Config struct {
 	CommentChar string
 	Separator   string
-	Cfg         ConfigFile
+	// Placeholders are the values in the configuration file template of the
+	// client library, which must be replaced with the real values.
+	Placeholders []string
+	Cfg          ConfigFile
 }
 
-// ConfigFile is the structure of a client configuration file.
+// ConfigFile is the structure of a client configuration file. FromEnv is
+// true when the keys are read from environment variables instead of a file.
 type ConfigFile struct {
 	Filename string
 	Filepath string
 	Lang     string
+	FromEnv  bool
+	// OutputPath is the file that the configuration with the replaced values
+	// is written to. The configuration file is left unchanged when it is set.
+	OutputPath string
+	// ReadOnly is set once the configuration file cannot be written, e.g. on
+	// a read-only mount. The replaced values are then only kept in memory
+	// and printed to be set manually.
+	ReadOnly bool
 	ConfigKeys
+
+	// outputWritten is true once OutputPath is written, so that the next
+	// value is replaced in OutputPath rather than in the configuration file.
+	outputWritten bool
 }
 
 // ConfigKeys are the keys in a client configuration file.
 type ConfigKeys struct {
-	ClientID        string
-	ClientSecret    string
-	DevToken        string
-	RefreshToken    string
-	LoginCustomerID string
+	ClientID          string
+	ClientSecret      string
+	DevToken          string
+	RefreshToken      string
+	LoginCustomerID   string
+	LinkedCustomerID  string
+	JSONKeyFilePath   string
+	ImpersonatedEmail string
+	UseProtoPlus      string
 }
 
 // Languages defines the idiomatic features of each language in a Google Ads
@@ -85,56 +133,102 @@ var Languages = map[string]Config{
 	"java": {
 		CommentChar: "#",
 		Separator:   "=",
+		Placeholders: []string{"INSERT_DEVELOPER_TOKEN_HERE", "INSERT_CLIENT_ID_HERE",
+			"INSERT_CLIENT_SECRET_HERE", "INSERT_REFRESH_TOKEN_HERE",
+			"INSERT_LOGIN_CUSTOMER_ID_HERE"},
 		Cfg: ConfigFile{
 			Filename: "ads.properties",
 			ConfigKeys: ConfigKeys{
-				ClientID:        "api.googleads.clientId",
-				ClientSecret:    "api.googleads.clientSecret",
-				DevToken:        "api.googleads.developerToken",
-				RefreshToken:    "api.googleads.refreshToken",
-				LoginCustomerID: "api.googleads.loginCustomerId"}}},
+				ClientID:          "api.googleads.clientId",
+				ClientSecret:      "api.googleads.clientSecret",
+				DevToken:          "api.googleads.developerToken",
+				RefreshToken:      "api.googleads.refreshToken",
+				LoginCustomerID:   "api.googleads.loginCustomerId",
+				LinkedCustomerID:  "api.googleads.linkedCustomerId",
+				JSONKeyFilePath:   "api.googleads.serviceAccountSecretsPath",
+				ImpersonatedEmail: "api.googleads.serviceAccountUser"}}},
 	"dotnet": {
+		Placeholders: []string{"INSERT_DEVELOPER_TOKEN_HERE", "INSERT_OAUTH2_CLIENT_ID_HERE",
+			"INSERT_OAUTH2_CLIENT_SECRET_HERE", "INSERT_OAUTH2_REFRESH_TOKEN_HERE",
+			"INSERT_LOGIN_CUSTOMER_ID_HERE"},
 		Cfg: ConfigFile{
 			Filename: "App.Config",
 			ConfigKeys: ConfigKeys{
-				ClientID:        "OAuth2ClientId",
-				ClientSecret:    "OAuth2ClientSecret",
-				DevToken:        "DeveloperToken",
-				RefreshToken:    "OAuth2RefreshToken",
-				LoginCustomerID: "LoginCustomerId"}}},
+				ClientID:          "OAuth2ClientId",
+				ClientSecret:      "OAuth2ClientSecret",
+				DevToken:          "DeveloperToken",
+				RefreshToken:      "OAuth2RefreshToken",
+				LoginCustomerID:   "LoginCustomerId",
+				LinkedCustomerID:  "LinkedCustomerId",
+				JSONKeyFilePath:   "OAuth2SecretsJsonPath",
+				ImpersonatedEmail: "OAuth2PrnEmail"}}},
+	"node": {
+		Separator: ":",
+		Placeholders: []string{"INSERT_DEVELOPER_TOKEN_HERE", "INSERT_CLIENT_ID_HERE",
+			"INSERT_CLIENT_SECRET_HERE", "INSERT_REFRESH_TOKEN_HERE",
+			"INSERT_LOGIN_CUSTOMER_ID_HERE"},
+		Cfg: ConfigFile{
+			Filename: "google-ads.json",
+			ConfigKeys: ConfigKeys{
+				ClientID:         "client_id",
+				ClientSecret:     "client_secret",
+				DevToken:         "developer_token",
+				RefreshToken:     "refresh_token",
+				LoginCustomerID:  "login_customer_id",
+				LinkedCustomerID: "linked_customer_id"}}},
 	"php": {
 		CommentChar: ";",
 		Separator:   "=",
+		Placeholders: []string{"INSERT_DEVELOPER_TOKEN_HERE", "INSERT_OAUTH2_CLIENT_ID_HERE",
+			"INSERT_OAUTH2_CLIENT_SECRET_HERE", "INSERT_OAUTH2_REFRESH_TOKEN_HERE",
+			"INSERT_LOGIN_CUSTOMER_ID_HERE"},
 		Cfg: ConfigFile{
 			Filename: "google_ads_php.ini",
 			ConfigKeys: ConfigKeys{
-				ClientID:        "clientId",
-				ClientSecret:    "clientSecret",
-				DevToken:        "developerToken",
-				RefreshToken:    "refreshToken",
-				LoginCustomerID: "loginCustomerId"}}},
+				ClientID:          "clientId",
+				ClientSecret:      "clientSecret",
+				DevToken:          "developerToken",
+				RefreshToken:      "refreshToken",
+				LoginCustomerID:   "loginCustomerId",
+				LinkedCustomerID:  "linkedCustomerId",
+				JSONKeyFilePath:   "jsonKeyFilePath",
+				ImpersonatedEmail: "impersonatedEmail"}}},
 	"python": {
 		CommentChar: "#",
 		Separator:   ":",
+		Placeholders: []string{"INSERT_DEVELOPER_TOKEN_HERE", "INSERT_OAUTH2_CLIENT_ID_HERE",
+			"INSERT_OAUTH2_CLIENT_SECRET_HERE", "INSERT_REFRESH_TOKEN_HERE",
+			"INSERT_LOGIN_CUSTOMER_ID_HERE", "INSERT_PATH_TO_JSON_KEY_FILE_HERE",
+			"INSERT_USER_EMAIL_HERE"},
 		Cfg: ConfigFile{
 			Filename: "google-ads.yaml",
 			ConfigKeys: ConfigKeys{
-				ClientID:        "client_id",
-				ClientSecret:    "client_secret",
-				DevToken:        "developer_token",
-				RefreshToken:    "refresh_token",
-				LoginCustomerID: "login_customer_id"}}},
+				ClientID:          "client_id",
+				ClientSecret:      "client_secret",
+				DevToken:          "developer_token",
+				RefreshToken:      "refresh_token",
+				LoginCustomerID:   "login_customer_id",
+				LinkedCustomerID:  "linked_customer_id",
+				JSONKeyFilePath:   "json_key_file_path",
+				ImpersonatedEmail: "impersonated_email",
+				UseProtoPlus:      "use_proto_plus"}}},
 	"ruby": {
 		CommentChar: "#",
 		Separator:   "=",
+		Placeholders: []string{"INSERT_DEVELOPER_TOKEN_HERE", "INSERT_CLIENT_ID_HERE",
+			"INSERT_CLIENT_SECRET_HERE", "INSERT_REFRESH_TOKEN_HERE",
+			"INSERT_LOGIN_CUSTOMER_ID_HERE"},
 		Cfg: ConfigFile{
 			Filename: "google_ads_config.rb",
 			ConfigKeys: ConfigKeys{
-				ClientID:        "c.client_id",
-				ClientSecret:    "c.client_secret",
-				DevToken:        "c.developer_token",
-				RefreshToken:    "c.refresh_token",
-				LoginCustomerID: "c.login_customer_id"}}}}
+				ClientID:          "c.client_id",
+				ClientSecret:      "c.client_secret",
+				DevToken:          "c.developer_token",
+				RefreshToken:      "c.refresh_token",
+				LoginCustomerID:   "c.login_customer_id",
+				LinkedCustomerID:  "c.linked_customer_id",
+				JSONKeyFilePath:   "c.keyfile",
+				ImpersonatedEmail: "c.impersonate"}}}}
 
 // swapMap reverses the keys and values of m.
 func swapMap(m map[string]interface{}) map[string]string {
@@ -147,8 +241,12 @@ func swapMap(m map[string]interface{}) map[string]string {
 
 // GetConfigKeysInLang returns the key name in the configuration file
 // based on the given language. For example, "client_id" is returned with
-// "ClientID" for Python.
+// "ClientID" for Python. The environment variable name is returned when
+// the configuration is read from environment variables.
 func (c *ConfigFile) GetConfigKeysInLang(key string) string {
+	if c.FromEnv {
+		return EnvVars[key]
+	}
 	s := structs.New(Languages[c.Lang].Cfg.ConfigKeys)
 	return s.Field(key).Value().(string)
 }
@@ -170,100 +268,167 @@ func (c *ConfigFile) UpdateConfigKeys(keyValue map[string]string) {
 	}
 }
 
-// ReplaceConfigFromReader reads configuration file content from io.Reader
-// according to a specific language config file syntax. It inserts the new
-// key-value pair and comments out the existing one if found.
-func (c *ConfigFile) ReplaceConfigFromReader(key, value string, r io.Reader) string {
-	var buf bytes.Buffer
+// ReplaceConfig replaces a value in ConfigFile.ConfigKeys and its
+// configuration file. The original file is copied to a timestamped backup
+// file first, and the new content is written atomically by renaming a
+// temp file in the same directory. It returns the path of the backup file.
+// When the configuration is read from environment variables, only the value
+// in memory is replaced and an empty path is returned. When OutputPath is
+// set, the configuration is written there instead, without a backup, and an
+// empty path is returned. When the configuration file is a symlink, its
+// target is modified. When the file cannot be written, the value is printed
+// instead, see keepUnsaved, and an empty path is returned.
+func (c *ConfigFile) ReplaceConfig(key, value string) string {
+	if c.FromEnv {
+		c.replaceEnvConfig(key, value)
+		return ""
+	}
+	c.SetConfigKeys(key, value)
+	if c.OutputPath != "" {
+		c.writeOutput(key, value)
+		return ""
+	}
 
-	// Insert the new key-value pair at the "top" of the file. "Top" is
-	// the topmost position that is syntactically correct based on the language.
-	// And then it finds the line with the old config key and comments it out.
-	commentChar := Languages[c.Lang].CommentChar
-	scanner := bufio.NewScanner(r)
-	for i := 0; scanner.Scan(); i++ {
-		line := scanner.Text() + "\n"
-		trimmedLine := strings.TrimSpace(line)
-		langKey := c.GetConfigKeysInLang(key)
-
-		// Found the line with old config key and comment it out
-		if !strings.HasPrefix(trimmedLine, commentChar) && strings.Contains(trimmedLine, langKey) {
-			buf.WriteString(commentChar + line)
-		} else {
-			buf.WriteString(line)
-		}
+	if c.ReadOnly {
+		c.keepUnsaved(key, value, nil)
+		return ""
+	}
+	configFp, err := c.writeTarget()
+	if err != nil {
+		c.keepUnsaved(key, value, err)
+		return ""
+	}
+	original, err := ioutil.ReadFile(configFp)
+	if err != nil {
+		Fatalf("Problem reading config file: %s", err)
+	}
+	info, err := os.Stat(configFp)
+	if err != nil {
+		Fatalf("Problem reading config file: %s", err)
+	}
 
-		switch c.Lang {
-		case "dotnet":
-			if !strings.HasPrefix(trimmedLine, commentChar) && strings.Contains(trimmedLine, "<GoogleAdsApi>") {
-				buf.WriteString(c.configLineStr(key, value))
-			}
-		case "php":
-			if !strings.HasPrefix(trimmedLine, commentChar) {
-				if (key == DevToken && strings.Contains(trimmedLine, "[GOOGLE_ADS]")) ||
-					strings.Contains(trimmedLine, "[OAUTH2]") {
-					buf.WriteString(c.configLineStr(key, value))
-				}
-			}
-		case "ruby":
-			if !strings.HasPrefix(trimmedLine, commentChar) && strings.Contains(trimmedLine, "Google::Ads::GoogleAds::Config.new") {
-				buf.WriteString(c.configLineStr(key, value))
-			}
-		default:
-			if i == 0 {
-				buf.WriteString(c.configLineStr(key, value))
-			}
+	// Backup the original file
+	backupFp := configFp + "_" + time.Now().Format("2006-01-02_15-04-05") + ".bak"
+	log.Printf("Backing up config file %s to %s...", configFp, backupFp)
+	if err := ioutil.WriteFile(backupFp, original, info.Mode()); err != nil {
+		c.keepUnsaved(key, value, fmt.Errorf("cannot backup config file to %s: %s", backupFp, err))
+		return ""
+	}
+
+	// Replace with new config value and write to a temp file, which is
+	// created in the same directory so that it can be renamed atomically
+	newConfigStr := c.ReplaceConfigFromReader(key, value, bytes.NewReader(original))
+	if err := writeFileAtomic(configFp, []byte(newConfigStr), info.Mode()); err != nil {
+		if rErr := ioutil.WriteFile(configFp, original, info.Mode()); rErr != nil {
+			Fatalf("Cannot write config file (%s): %s\n"+
+				"Cannot restore it from the backup either: %s\n"+
+				"Please copy %s to %s manually.", configFp, err, rErr, backupFp, configFp)
 		}
+		c.keepUnsaved(key, value, fmt.Errorf("%s. The config file is restored "+
+			"from the backup %s", err, backupFp))
+		return ""
 	}
+	log.Printf("Created a new config file %s. To roll back, copy %s to %s.",
+		configFp, backupFp, configFp)
 
-	return buf.String()
+	return backupFp
 }
 
-// ReplaceConfig replaces a value in ConfigFile.ConfigKeys and its
-// configuration file.
-func (c *ConfigFile) ReplaceConfig(key, value string) string {
-	c.SetConfigKeys(key, value)
+// writeTarget returns the path of the file that ReplaceConfig modifies. It is
+// the target of the configuration file when that is a symlink, so that the
+// atomic rename does not replace the symlink with a regular file. It returns
+// an error when the file or its directory, where the backup and the temp
+// file are created, cannot be written.
+func (c *ConfigFile) writeTarget() (string, error) {
+	configFp := filepath.Join(c.Filepath, c.Filename)
+	target, err := filepath.EvalSymlinks(configFp)
+	if err != nil {
+		return "", err
+	}
+	if fi, err := os.Lstat(configFp); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		log.Printf("Config file %s is a symlink to %s, which is modified instead.", configFp, target)
+	}
 
-	// Create a temp file
-	tmpfile, err := ioutil.TempFile("", "googleadsapi_client_lib_config")
+	f, err := os.OpenFile(target, os.O_WRONLY, 0)
 	if err != nil {
-		log.Fatalf("ERROR: Problem creating temp file: %s", err)
+		return "", fmt.Errorf("the file is not writable: %s", err)
 	}
-	defer tmpfile.Close()
+	f.Close()
+	dir := filepath.Dir(target)
+	tmpfile, err := ioutil.TempFile(dir, "."+filepath.Base(target)+".tmp")
+	if err != nil {
+		return "", fmt.Errorf("the directory %s is not writable: %s", dir, err)
+	}
+	tmpfile.Close()
+	os.Remove(tmpfile.Name())
+	return target, nil
+}
 
-	// Open config file
+// keepUnsaved is called when the value of key cannot be written to the
+// configuration file because of err. The value is kept in memory and
+// printed, so that a newly generated value, e.g. a refresh token, is not
+// lost. The file is not written again afterwards.
+func (c *ConfigFile) keepUnsaved(key, value string, err error) {
 	configFp := filepath.Join(c.Filepath, c.Filename)
-	f, err := os.Open(configFp)
 	if err != nil {
-		log.Fatalf("ERROR: Problem opening config file: %s", err)
+		c.ReadOnly = true
+		Errorf("Cannot write config file %s: %s", configFp, err)
 	}
-	defer f.Close()
+	field := c.GetConfigKeysInLang(key)
+	if value == "" {
+		log.Printf("%s is NOT removed. Please remove it from %s manually.", field, configFp)
+		return
+	}
+	log.Printf("The new value of %s is NOT saved. Please set it in %s manually:\n%s",
+		field, configFp, c.configLineStr(key, value))
+}
 
-	// Replace with new config value and write to temp file
-	newConfigStr := c.ReplaceConfigFromReader(key, value, f)
-	if _, err := tmpfile.Write([]byte(newConfigStr)); err != nil {
-		log.Fatalf("ERROR: Cannot write to temp config file (%s): %s",
-			tmpfile.Name(), err)
+// writeOutput writes the configuration file with the value of key replaced
+// to OutputPath, which is only readable by the owner since it contains the
+// secrets. The values replaced before are kept.
+func (c *ConfigFile) writeOutput(key, value string) {
+	src := filepath.Join(c.Filepath, c.Filename)
+	if c.outputWritten {
+		src = c.OutputPath
+	}
+	original, err := ioutil.ReadFile(src)
+	if err != nil {
+		Fatalf("Problem reading config file: %s", err)
 	}
 
-	f.Close()
-	tmpfile.Close()
+	newConfigStr := c.ReplaceConfigFromReader(key, value, bytes.NewReader(original))
+	if err := writeFileAtomic(c.OutputPath, []byte(newConfigStr), 0600); err != nil {
+		Fatalf("Cannot write config file (%s): %s", c.OutputPath, err)
+	}
+	c.outputWritten = true
+	log.Printf("Wrote the updated config file to %s. %s is unchanged; review "+
+		"the new file before replacing it.", c.OutputPath,
+		filepath.Join(c.Filepath, c.Filename))
+}
 
-	// Swap new config file for the old one, and backup the old file
-	backupFp := configFp + "_" + time.Now().Format("2006-01-02_15-04-05")
-	log.Printf("Backing up config file %s to %s...", configFp, backupFp)
-	if err = os.Rename(configFp, backupFp); err != nil {
-		log.Fatalf("ERROR: Cannot rename config file from (%s) to (%s): %s",
-			configFp, backupFp, err)
-	} else {
-		log.Printf("Creating a new config file %s...", configFp)
-		if err = os.Rename(tmpfile.Name(), configFp); err != nil {
-			log.Fatalf("ERROR: Cannot rename config file from (%s) to (%s): %s",
-				tmpfile.Name(), configFp, err)
-		}
+// writeFileAtomic writes data to a temp file in the directory of filename,
+// and then renames the temp file to filename.
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	tmpfile, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
 	}
+	defer os.Remove(tmpfile.Name())
+	defer tmpfile.Close()
 
-	return backupFp
+	if _, err := tmpfile.Write(data); err != nil {
+		return err
+	}
+	if err := tmpfile.Sync(); err != nil {
+		return err
+	}
+	if err := tmpfile.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpfile.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpfile.Name(), filename)
 }
 
 // configLineStr returns a configuration file line formatted for the
@@ -275,24 +440,25 @@ func (c *ConfigFile) configLineStr(key, value string) (line string) {
 	switch strings.ToLower(c.Lang) {
 	case "java":
 		line = field + separator + value
-	case "php":
-		line = field + separator + " \"" + value + "\""
-	case "ruby":
-		line = "c." + field + separator + " \"" + value + "\""
+	case "php", "ruby":
+		line = field + " " + separator + " \"" + value + "\""
 	case "python":
-		line = field + separator + value
+		line = field + separator + " " + value
 	case "dotnet":
 		line = "<add key=\"" + field + "\" value=\"" + value + "\"/>"
+	case "node":
+		line = "\"" + field + "\": " + jsonValue(value, "")
 	}
 	return line + "\n"
 }
 
-// ListLanguages returns a slice of supported languages.
+// ListLanguages returns a sorted slice of supported languages.
 func ListLanguages() []string {
 	var langs = make([]string, 0)
 	for k := range Languages {
 		langs = append(langs, k)
 	}
+	sort.Strings(langs)
 	return langs
 }
 
@@ -306,12 +472,80 @@ func Contains(s []string, str string) bool {
 	return false
 }
 
+// customerIDLen is the number of digits in a Google Ads customer ID.
+const customerIDLen = 10
+
+// NormalizeCustomerID strips surrounding whitespace and dashes from a Google
+// Ads customer ID, such as 123-456-7890, and returns the remaining digits. It
+// returns an error when the result is not exactly 10 digits.
+func NormalizeCustomerID(cid string) (string, error) {
+	id := strings.Replace(strings.TrimSpace(cid), "-", "", -1)
+	if id == "" {
+		return "", fmt.Errorf("customer ID is empty")
+	}
+	for _, r := range id {
+		if r < '0' || r > '9' {
+			return "", fmt.Errorf("customer ID %q can only contain digits and dashes", cid)
+		}
+	}
+	if len(id) != customerIDLen {
+		return "", fmt.Errorf("customer ID %q must have %d digits, found %d",
+			cid, customerIDLen, len(id))
+	}
+	return id, nil
+}
+
+// normalizeLoginCustomerID strips the dashes from a well-formed login
+// customer ID, e.g. 123-456-7890, like --logincustomerid, so that it is sent
+// as digits in the login-customer-id header. Other values are kept for the
+// validation to report.
+func (c *ConfigFile) normalizeLoginCustomerID() {
+	if c.LoginCustomerID == "" || c.IsPlaceholder(c.LoginCustomerID) {
+		return
+	}
+	if id, err := NormalizeCustomerID(c.LoginCustomerID); err == nil {
+		c.LoginCustomerID = id
+	}
+}
+
+// ParseCustomerIDs parses a list of customer IDs separated by commas or
+// newlines, e.g. the content of a file with one customer ID per line. Blank
+// lines and lines starting with # are skipped, and duplicates are removed.
+// The customer IDs are normalized by NormalizeCustomerID.
+func ParseCustomerIDs(s string) ([]string, error) {
+	var ids []string
+	for _, line := range strings.Split(s, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		for _, cid := range strings.Split(line, ",") {
+			if strings.TrimSpace(cid) == "" {
+				continue
+			}
+			id, err := NormalizeCustomerID(cid)
+			if err != nil {
+				return nil, err
+			}
+			if !Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no customer IDs found")
+	}
+	return ids, nil
+}
+
 // parseKeyValueLine parses the given line into a key-value pair. The line
 // cannot be a comment.
 func parseKeyValueLine(c ConfigFile, line string) (string, string, error) {
 	separator := Languages[c.Lang].Separator
 	if idx := strings.Index(line, separator); idx >= 0 {
 		if key := strings.TrimSpace(line[:idx]); len(key) > 0 {
+			if c.Lang == "python" {
+				return key, parseYAMLValue(line[idx+1:]), nil
+			}
 			return key, findFirstValue(line[idx+1:]), nil
 		}
 	}
@@ -321,7 +555,7 @@ func parseKeyValueLine(c ConfigFile, line string) (string, string, error) {
 // findFirstValue returns the first value that contains alphanumeric
 // characters potentially with some special characters.
 func findFirstValue(k string) string {
-	quotedStr := regexp.MustCompile("[\\w\\-\\./_]+")
+	quotedStr := regexp.MustCompile("[\\w\\-\\./_@]+")
 	matches := quotedStr.FindAllString(k, -1)
 	if len(matches) > 0 {
 		return matches[0]
@@ -369,42 +603,27 @@ func ParseKeyValueFile(lang, filepath string) (c ConfigFile, err error) {
 	return c, nil
 }
 
-// ParseXMLFile parses the file content given in filepath and returns
-// a ConfigFile struct with the given attributes in the file.
-func ParseXMLFile(filepath string) (c ConfigFile, err error) {
-	var keyValue = make(map[string]string)
-	c, _ = GetConfigFile("dotnet", filepath)
-
-	type Property struct {
-		Key   string `xml:"key,attr"`
-		Value string `xml:"value,attr"`
-	}
-
-	type DotNetXML struct {
-		XMLName    xml.Name   `xml:"configuration"`
-		Properties []Property `xml:"GoogleAdsApi>add"`
-	}
-
-	f, err := os.Open(filepath)
-	if err != nil {
-		return c, err
-	}
-	defer f.Close()
-
-	inputBytes, _ := ioutil.ReadAll(f)
-	options := DotNetXML{}
-	err = xml.Unmarshal([]byte(inputBytes), &options)
-	if err != nil {
-		return c, err
+// IsPlaceholder returns true when the given value is a placeholder in the
+// configuration file template of the client library, e.g.
+// INSERT_DEVELOPER_TOKEN_HERE, else false.
+func (c *ConfigFile) IsPlaceholder(v string) bool {
+	if Contains(Languages[c.Lang].Placeholders, v) {
+		return true
 	}
+	return strings.HasPrefix(v, "INSERT_") && strings.HasSuffix(v, "_HERE")
+}
 
-	for _, prop := range options.Properties {
-		keyValue[prop.Key] = prop.Value
+// FindPlaceholders returns the given keys (e.g. DevToken) in
+// ConfigFile.ConfigKeys whose values are empty or placeholders.
+func (c *ConfigFile) FindPlaceholders(keys []string) []string {
+	var found []string
+	s := structs.New(c.ConfigKeys)
+	for _, k := range keys {
+		if v := s.Field(k).Value().(string); v == "" || c.IsPlaceholder(v) {
+			found = append(found, k)
+		}
 	}
-
-	c.UpdateConfigKeys(keyValue)
-
-	return c, nil
+	return found
 }
 
 // IsPII returns true when the given string is PII (peronsal identifiable
@@ -413,12 +632,39 @@ func IsPII(s string) bool {
 	return Contains(PIIWords, s)
 }
 
+// minRedactLen is the minimum length of a secret value to be redacted, so
+// that a very short value does not mask unrelated parts of the output.
+const minRedactLen = 4
+
+// Redact replaces the values of the secret keys (see SecretWords) in s with
+// Mask. Both the raw and URL encoded values are replaced, so that the values
+// are redacted in JSON responses, HTTP headers and form encoded requests.
+func (c *ConfigFile) Redact(s string) string {
+	keys := structs.New(c.ConfigKeys)
+	for _, k := range SecretWords {
+		v := keys.Field(k).Value().(string)
+		if len(v) < minRedactLen {
+			continue
+		}
+		s = strings.Replace(s, v, Mask, -1)
+		s = strings.Replace(s, url.QueryEscape(v), Mask, -1)
+	}
+	return s
+}
+
 // GetConfigFile returns a ConfigFile containing config filepath and filename.
 // When overridePath is an empty string, the function will retrieve the filepath and
-// filename from the default location in the file system.
+// filename from the ConfigPathEnv environment variable, and then from the
+// default location in the file system, like the client libraries do.
 func GetConfigFile(lang, overridePath string) (ConfigFile, error) {
 	if overridePath == "" {
-		return GetDefaultConfigFile(lang)
+		if envPath := os.Getenv(ConfigPathEnv); envPath != "" {
+			log.Printf("Using the config file in %s\n", ConfigPathEnv)
+			overridePath = envPath
+		} else {
+			log.Printf("Using the default config file location of the %s client library\n", lang)
+			return GetDefaultConfigFile(lang)
+		}
 	}
 
 	lang = strings.ToLower(lang)
@@ -428,6 +674,81 @@ func GetConfigFile(lang, overridePath string) (ConfigFile, error) {
 		Lang:     lang}, nil
 }
 
+// CheckConfigFile returns an error naming the path when the configuration
+// file at path is missing, unreadable or empty.
+func CheckConfigFile(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("config file %s does not exist", path)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot access config file %s: %s", path, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("config file %s is a directory", path)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read config file %s: %s. Please check "+
+			"its permissions", path, err)
+	}
+	if len(bytes.TrimSpace(content)) == 0 {
+		return fmt.Errorf("config file %s is empty", path)
+	}
+	return nil
+}
+
+// Check returns an error when the configuration file is missing, unreadable
+// or empty. It returns nil when the configuration is read from environment
+// variables.
+func (c *ConfigFile) Check() error {
+	if c.FromEnv {
+		return nil
+	}
+	return CheckConfigFile(filepath.Join(c.Filepath, c.Filename))
+}
+
+// ConfigLocations describes the locations of the configuration file that
+// GetConfigFile considers, in the order of precedence.
+func ConfigLocations(lang, overridePath string) []string {
+	var locations []string
+	if overridePath != "" {
+		locations = append(locations, "The given path: "+overridePath)
+	}
+	if envPath := os.Getenv(ConfigPathEnv); envPath != "" {
+		locations = append(locations, ConfigPathEnv+": "+envPath)
+	} else {
+		locations = append(locations, ConfigPathEnv+": not set")
+	}
+	if cfg, err := GetDefaultConfigFile(lang); err == nil && cfg.Filename != "" {
+		locations = append(locations, "The default location: "+
+			filepath.Join(cfg.Filepath, cfg.Filename))
+	}
+	return locations
+}
+
+// CheckPermissions returns an error when the configuration file can be read
+// by the group or other users, since it contains the refresh token and the
+// client secret. The check is skipped on Windows, where the permission bits
+// do not reflect the access control lists.
+func (c *ConfigFile) CheckPermissions() error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	configFp := filepath.Join(c.Filepath, c.Filename)
+	info, err := os.Stat(configFp)
+	if err != nil {
+		return err
+	}
+	if perm := info.Mode().Perm(); perm&0044 != 0 {
+		return fmt.Errorf("config file %s is readable by other users (mode %04o). "+
+			"Please restrict it with: chmod 600 %s", configFp, perm, configFp)
+	}
+	return nil
+}
+
 // GetDefaultConfigFile returns the default config path of Google Ads API client
 // library.
 func GetDefaultConfigFile(lang string) (ConfigFile, error) {
@@ -485,11 +806,30 @@ func (c *ConfigFile) Validate() (bool, error) {
 			c.ClientID)
 	}
 
-	if strings.Contains(c.LoginCustomerID, "-") {
+	if c.Lang == "python" && c.UseProtoPlus != "" &&
+		!Contains([]string{"True", "False", "true", "false"}, c.UseProtoPlus) {
 		valid = false
-		errMsg += fmt.Sprintf(
-			"LoginCustomerID cannot have dashes. Value: %s\n",
-			c.LoginCustomerID)
+		errMsg += fmt.Sprintf("UseProtoPlus must be True or False. Value: %s\n",
+			c.UseProtoPlus)
+	}
+
+	if c.LoginCustomerID != "" && !c.IsPlaceholder(c.LoginCustomerID) {
+		if _, err := NormalizeCustomerID(c.LoginCustomerID); err != nil {
+			valid = false
+			errMsg += fmt.Sprintf(
+				"LoginCustomerID must be a 10 digit manager account ID. Value: %s\n",
+				c.LoginCustomerID)
+		}
+	}
+
+	if c.LinkedCustomerID != "" && !c.IsPlaceholder(c.LinkedCustomerID) {
+		if _, err := NormalizeCustomerID(c.LinkedCustomerID); err != nil ||
+			strings.Contains(c.LinkedCustomerID, "-") {
+			valid = false
+			errMsg += fmt.Sprintf(
+				"LinkedCustomerID must be a 10 digit account ID without dashes. Value: %s\n",
+				c.LinkedCustomerID)
+		}
 	}
 
 	keys := reflect.TypeOf(c.ConfigKeys)
@@ -13,11 +13,13 @@
 package diag_test
 
 import (
+	"io/ioutil"
 	"log"
 	"oauthdoctor/diag"
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"strings"
 	"testing"
 )
@@ -84,12 +86,47 @@ func TestValidate(t *testing.T) {
 		{
 			cfg: diag.ConfigFile{
 				ConfigKeys: diag.ConfigKeys{
+					DevToken:        goodDevToken,
+					ClientID:        goodClientID,
+					ClientSecret:    goodSecret,
+					RefreshToken:    goodToken,
 					LoginCustomerID: "111-111-1111",
 				},
 			},
+			want: true,
+		}, // LoginCustomerID can have dashes
+		{
+			cfg: diag.ConfigFile{
+				ConfigKeys: diag.ConfigKeys{
+					LoginCustomerID: "111111111",
+				},
+			},
+			want:   false,
+			errstr: "LoginCustomerID must be a 10 digit",
+		}, // LoginCustomerID must have 10 digits
+		{
+			cfg: diag.ConfigFile{
+				ConfigKeys: diag.ConfigKeys{
+					LinkedCustomerID: "12345",
+				},
+			},
 			want:   false,
-			errstr: "LoginCustomerID",
-		}, // LoginCustomerID cannot have dashes
+			errstr: "LinkedCustomerID must be a 10 digit",
+		}, // LinkedCustomerID must have 10 digits
+		{
+			cfg: diag.ConfigFile{
+				Lang: "python",
+				ConfigKeys: diag.ConfigKeys{
+					DevToken:     goodDevToken,
+					ClientID:     goodClientID,
+					ClientSecret: goodSecret,
+					RefreshToken: goodToken,
+					UseProtoPlus: "yes",
+				},
+			},
+			want:   false,
+			errstr: "UseProtoPlus",
+		}, // UseProtoPlus must be a boolean
 	}
 
 	for _, test := range tests {
@@ -118,11 +155,341 @@ func TestReplaceConfig(t *testing.T) {
 client_secret: GoodClientSecret
 refresh_token: GoodRefreshToken`,
 			want: `developer_token: GoodDevToken
-refresh_token:newValue
 client_secret: GoodClientSecret
-#refresh_token: GoodRefreshToken
+refresh_token: newValue`,
+		}, // Python: Replace in place
+		{
+			key:   diag.ClientSecret,
+			value: "newValue",
+			cfg:   diag.ConfigFile{Lang: "python"},
+			input: `# Comment is preserved
+client_id: GoodClientID
+client_secret:  'GoodClientSecret'  # Trailing comment is preserved
+use_proto_plus: True`,
+			want: `# Comment is preserved
+client_id: GoodClientID
+client_secret:  'newValue'  # Trailing comment is preserved
+use_proto_plus: True`,
+		}, // Python: Preserve quotes and comments
+		{
+			key:   diag.RefreshToken,
+			value: "newValue",
+			cfg:   diag.ConfigFile{Lang: "python"},
+			input: `developer_token: GoodDevToken
+#refresh_token: OldRefreshToken`,
+			want: `refresh_token: newValue
+developer_token: GoodDevToken
+#refresh_token: OldRefreshToken`,
+		}, // Python: Insert missing key at the top
+		{
+			key:   diag.RefreshToken,
+			value: "newValue",
+			cfg:   diag.ConfigFile{Lang: "java"},
+			input: `api.googleads.clientId=GoodClientID
+api.googleads.refreshToken=GoodRefreshToken`,
+			want: `api.googleads.clientId=GoodClientID
+api.googleads.refreshToken=newValue`,
+		}, // Java: Replace in place
+		{
+			key:   diag.LoginCustomerID,
+			value: "",
+			cfg:   diag.ConfigFile{Lang: "python"},
+			input: `developer_token: GoodDevToken
+login_customer_id: 1234567890`,
+			want: `developer_token: GoodDevToken
+#login_customer_id: 1234567890`,
+		}, // Python: Remove a key with an empty value
+		{
+			key:   diag.LoginCustomerID,
+			value: "",
+			cfg:   diag.ConfigFile{Lang: "java"},
+			input: `api.googleads.clientId=GoodClientID
+api.googleads.loginCustomerId=1234567890`,
+			want: `api.googleads.clientId=GoodClientID
+#api.googleads.loginCustomerId=1234567890`,
+		}, // Java: Remove a key with an empty value
+		{
+			key:   diag.ClientSecret,
+			value: "newValue",
+			cfg:   diag.ConfigFile{Lang: "java"},
+			input: "# Credentials of the Google Ads API\r\n\r\n" +
+				"api.googleads.clientId = GoodClientID\r\n" +
+				"api.googleads.clientSecret = GoodClientSecret\r\n" +
+				"# api.googleads.loginCustomerId=INSERT_LOGIN_CUSTOMER_ID_HERE\r\n",
+			want: "# Credentials of the Google Ads API\r\n\r\n" +
+				"api.googleads.clientId = GoodClientID\r\n" +
+				"api.googleads.clientSecret = newValue\r\n" +
+				"# api.googleads.loginCustomerId=INSERT_LOGIN_CUSTOMER_ID_HERE\r\n",
+		}, // Java: Preserve comments, spacing and CRLF line endings
+		{
+			key:   diag.ClientSecret,
+			value: "GoodClientSecret",
+			cfg:   diag.ConfigFile{Lang: "java"},
+			input: "api.googleads.clientId=GoodClientID\n" +
+				"api.googleads.clientSecret=\"GoodClientSecret\"  \n",
+			want: "api.googleads.clientId=GoodClientID\n" +
+				"api.googleads.clientSecret=GoodClientSecret\n",
+		}, // Java: Replace the quotes and the trailing whitespace, which are part of the value
+		{
+			key:   diag.RefreshToken,
+			value: "newValue",
+			cfg:   diag.ConfigFile{Lang: "node"},
+			input: "{\n  \"client_id\": \"GoodClientID\",\n  \"refresh_token\": \"Good\\\"RefreshToken\",\n  \"developer_token\": \"GoodDevToken\"\n}\n",
+			want:  "{\n  \"client_id\": \"GoodClientID\",\n  \"refresh_token\": \"newValue\",\n  \"developer_token\": \"GoodDevToken\"\n}\n",
+		}, // Node.js: Replace in place, preserving the order and the indentation
+		{
+			key:   diag.LoginCustomerID,
+			value: "1234567890",
+			cfg:   diag.ConfigFile{Lang: "node"},
+			input: "{\r\n    \"customer_id\": \"1112223333\",\r\n    \"credentials\": {\r\n        \"client_id\": \"GoodClientID\"\r\n    }\r\n}\r\n",
+			want:  "{\r\n    \"customer_id\": \"1112223333\",\r\n    \"credentials\": {\r\n        \"login_customer_id\": \"1234567890\",\r\n        \"client_id\": \"GoodClientID\"\r\n    }\r\n}\r\n",
+		}, // Node.js: Insert a missing key into the credentials object
+		{
+			key:   diag.LoginCustomerID,
+			value: "1234567890",
+			cfg:   diag.ConfigFile{Lang: "node"},
+			input: `{"client_id": "GoodClientID", "login_customer_id": 1112223333}`,
+			want:  `{"client_id": "GoodClientID", "login_customer_id": 1234567890}`,
+		}, // Node.js: Keep a numeric customer ID a number
+		{
+			key:   diag.LoginCustomerID,
+			value: "0123456789",
+			cfg:   diag.ConfigFile{Lang: "node"},
+			input: `{"client_id": "GoodClientID", "login_customer_id": 1112223333}`,
+			want:  `{"client_id": "GoodClientID", "login_customer_id": "0123456789"}`,
+		}, // Node.js: Quote a customer ID with a leading zero
+		{
+			key:   diag.RefreshToken,
+			value: "newValue",
+			cfg:   diag.ConfigFile{Lang: "node"},
+			input: `{"refresh_token": "TopRefreshToken", "credentials": {"other": {"refresh_token": "x"}, "refresh_token": "GoodRefreshToken"}}`,
+			want:  `{"refresh_token": "TopRefreshToken", "credentials": {"other": {"refresh_token": "x"}, "refresh_token": "newValue"}}`,
+		}, // Node.js: Replace the key of the credentials object that is read
+		{
+			key:   diag.RefreshToken,
+			value: "newValue",
+			cfg:   diag.ConfigFile{Lang: "node"},
+			input: `{"other": {"refresh_token": "x"}, "refresh_token": "GoodRefreshToken"}`,
+			want:  `{"other": {"refresh_token": "x"}, "refresh_token": "newValue"}`,
+		}, // Node.js: Skip the keys of the nested objects
+		{
+			key:   diag.LoginCustomerID,
+			value: "",
+			cfg:   diag.ConfigFile{Lang: "node"},
+			input: "{\n  \"login_customer_id\": \"1234567890\",\n  \"client_id\": \"GoodClientID\"\n}",
+			want:  "{\n  \"client_id\": \"GoodClientID\"\n}",
+		}, // Node.js: Remove the first key-value pair with its line
+		{
+			key:   diag.LoginCustomerID,
+			value: "",
+			cfg:   diag.ConfigFile{Lang: "node"},
+			input: `{"client_id": "GoodClientID", "login_customer_id": "1234567890"}`,
+			want:  `{"client_id": "GoodClientID"}`,
+		}, // Node.js: Remove the last key-value pair on a single line
+		{
+			key:   diag.DevToken,
+			value: "newValue",
+			cfg:   diag.ConfigFile{Lang: "node"},
+			input: `{}`,
+			want:  `{"developer_token": "newValue"}`,
+		}, // Node.js: Insert a key into an empty object
+		{
+			key:   diag.RefreshToken,
+			value: "newValue",
+			cfg:   diag.ConfigFile{Lang: "php"},
+			input: `[GOOGLE_ADS]
+; Required AdWords API properties.
+developerToken = "GoodDevToken"
+
+[OAUTH2]
+clientId = "GoodClientID"
+refreshToken = 'GoodRefreshToken' ; Generated on 2019-01-01
 `,
-		},
+			want: `[GOOGLE_ADS]
+; Required AdWords API properties.
+developerToken = "GoodDevToken"
+
+[OAUTH2]
+clientId = "GoodClientID"
+refreshToken = 'newValue' ; Generated on 2019-01-01
+`,
+		}, // PHP: Preserve quotes and inline comments
+		{
+			key:   diag.LoginCustomerID,
+			value: "1234567890",
+			cfg:   diag.ConfigFile{Lang: "php"},
+			input: `[GOOGLE_ADS]
+    developerToken = "GoodDevToken"
+
+[OAUTH2]
+    clientId = "GoodClientID"
+`,
+			want: `[GOOGLE_ADS]
+    loginCustomerId = "1234567890"
+    developerToken = "GoodDevToken"
+
+[OAUTH2]
+    clientId = "GoodClientID"
+`,
+		}, // PHP: Insert a missing key in its section
+		{
+			key:   diag.ClientID,
+			value: "newValue",
+			cfg:   diag.ConfigFile{Lang: "php"},
+			input: `[CONNECTION]
+clientId = "OtherClientID"
+
+[OAUTH2]
+clientId = "GoodClientID"
+`,
+			want: `[CONNECTION]
+clientId = "OtherClientID"
+
+[OAUTH2]
+clientId = "newValue"
+`,
+		}, // PHP: Replace the key in its section only
+		{
+			key:   diag.LoginCustomerID,
+			value: "1234567890",
+			cfg:   diag.ConfigFile{Lang: "php"},
+			input: `[OAUTH2]
+clientId = "GoodClientID"
+
+[LOGGING]
+logLevel = "INFO"`,
+			want: `[OAUTH2]
+clientId = "GoodClientID"
+
+[LOGGING]
+logLevel = "INFO"
+
+[GOOGLE_ADS]
+loginCustomerId = "1234567890"
+`,
+		}, // PHP: Append a missing section
+		{
+			key:   diag.ClientSecret,
+			value: "new&Value",
+			cfg:   diag.ConfigFile{Lang: "dotnet"},
+			input: `<GoogleAdsApi>
+    <!-- <add key="OAuth2ClientSecret" value="INSERT_OAUTH2_CLIENT_SECRET_HERE" /> -->
+    <add key="OAuth2ClientSecret"   value="GoodClientSecret" />
+  </GoogleAdsApi>`,
+			want: `<GoogleAdsApi>
+    <!-- <add key="OAuth2ClientSecret" value="INSERT_OAUTH2_CLIENT_SECRET_HERE" /> -->
+    <add key="OAuth2ClientSecret"   value="new&amp;Value" />
+  </GoogleAdsApi>`,
+		}, // DotNet: Replace the value attribute in place
+		{
+			key:   diag.RefreshToken,
+			value: "newValue",
+			cfg:   diag.ConfigFile{Lang: "dotnet"},
+			input: `<GoogleAdsApi>
+    <DeveloperToken>GoodDevToken</DeveloperToken>
+    <add value='GoodRefreshToken' key='OAuth2RefreshToken'/>
+  </GoogleAdsApi>`,
+			want: `<GoogleAdsApi>
+    <DeveloperToken>GoodDevToken</DeveloperToken>
+    <add value='newValue' key='OAuth2RefreshToken'/>
+  </GoogleAdsApi>`,
+		}, // DotNet: Attributes in any order and single quotes
+		{
+			key:   diag.DevToken,
+			value: "newValue",
+			cfg:   diag.ConfigFile{Lang: "dotnet"},
+			input: `<GoogleAdsApi>
+    <DeveloperToken>GoodDevToken</DeveloperToken>
+  </GoogleAdsApi>`,
+			want: `<GoogleAdsApi>
+    <DeveloperToken>newValue</DeveloperToken>
+  </GoogleAdsApi>`,
+		}, // DotNet: Element-style setting
+		{
+			key:   diag.LoginCustomerID,
+			value: "",
+			cfg:   diag.ConfigFile{Lang: "dotnet"},
+			input: `<GoogleAdsApi>
+    <add key="LoginCustomerId" value="1234567890" />
+  </GoogleAdsApi>`,
+			want: `<GoogleAdsApi>
+    <!-- <add key="LoginCustomerId" value="1234567890" /> -->
+  </GoogleAdsApi>`,
+		}, // DotNet: Remove a key with an empty value
+		{
+			key:   diag.LoginCustomerID,
+			value: "1234567890",
+			cfg:   diag.ConfigFile{Lang: "dotnet"},
+			input: `<GoogleAdsApi>
+    <add key="DeveloperToken" value="GoodDevToken" />
+  </GoogleAdsApi>`,
+			want: `<GoogleAdsApi>
+    <add key="LoginCustomerId" value="1234567890"/>
+    <add key="DeveloperToken" value="GoodDevToken" />
+  </GoogleAdsApi>`,
+		}, // DotNet: Insert a missing key in the GoogleAdsApi section
+		{
+			key:   diag.RefreshToken,
+			value: "newValue",
+			cfg:   diag.ConfigFile{Lang: "ruby"},
+			input: `Google::Ads::GoogleAds::Config.new do |c|
+  # c.refresh_token = 'INSERT_REFRESH_TOKEN_HERE'
+  c.client_id = "GoodClientID"
+  c.refresh_token = 'GoodRefreshToken' # Generated on 2019-01-01
+end`,
+			want: `Google::Ads::GoogleAds::Config.new do |c|
+  # c.refresh_token = 'INSERT_REFRESH_TOKEN_HERE'
+  c.client_id = "GoodClientID"
+  c.refresh_token = 'newValue' # Generated on 2019-01-01
+end`,
+		}, // Ruby: Replace an assignment in place
+		{
+			key:   diag.DevToken,
+			value: "newValue",
+			cfg:   diag.ConfigFile{Lang: "ruby"},
+			input: `Google::Ads::GoogleAds::Config.new do |config|
+  config[:developer_token] = "GoodDevToken"
+  config.login_customer_id = nil
+end`,
+			want: `Google::Ads::GoogleAds::Config.new do |config|
+  config[:developer_token] = "newValue"
+  config.login_customer_id = nil
+end`,
+		}, // Ruby: Symbol key
+		{
+			key:   diag.LoginCustomerID,
+			value: "1234567890",
+			cfg:   diag.ConfigFile{Lang: "ruby"},
+			input: `Google::Ads::GoogleAds::Config.new do |config|
+  config.login_customer_id = nil
+end`,
+			want: `Google::Ads::GoogleAds::Config.new do |config|
+  config.login_customer_id = 1234567890
+end`,
+		}, // Ruby: Replace nil with a number
+		{
+			key:   diag.LoginCustomerID,
+			value: "0123456789",
+			cfg:   diag.ConfigFile{Lang: "ruby"},
+			input: `Google::Ads::GoogleAds::Config.new do |config|
+  config.login_customer_id = 1234567890
+end`,
+			want: `Google::Ads::GoogleAds::Config.new do |config|
+  config.login_customer_id = '0123456789'
+end`,
+		}, // Ruby: Quote a number with a leading zero
+		{
+			key:   diag.ClientSecret,
+			value: "newValue",
+			cfg:   diag.ConfigFile{Lang: "ruby"},
+			input: `Google::Ads::GoogleAds::Config.new do |config|
+  config.client_id = 'GoodClientID'
+end`,
+			want: `Google::Ads::GoogleAds::Config.new do |config|
+  config.client_secret = "newValue"
+  config.client_id = 'GoodClientID'
+end`,
+		}, // Ruby: Insert a missing key with the block variable
 	}
 
 	for _, test := range tests {
@@ -134,6 +501,301 @@ client_secret: GoodClientSecret
 	}
 }
 
+func TestReplaceConfigBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oauthdoctor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	const original = "developer_token: GoodDevToken\nrefresh_token: OldRefreshToken\n"
+	configFp := filepath.Join(dir, "google-ads.yaml")
+	if err := ioutil.WriteFile(configFp, []byte(original), 0600); err != nil {
+		t.Fatalf("Error writing config file: %s", err)
+	}
+
+	cfg := diag.ConfigFile{Filepath: dir, Filename: "google-ads.yaml", Lang: "python"}
+	backupFp := cfg.ReplaceConfig(diag.RefreshToken, "NewRefreshToken")
+
+	backup, err := ioutil.ReadFile(backupFp)
+	if err != nil {
+		t.Fatalf("Error reading backup file: %s", err)
+	}
+	if string(backup) != original {
+		t.Errorf("Backup mismatch - got: %s, want: %s", backup, original)
+	}
+
+	got, err := ioutil.ReadFile(configFp)
+	if err != nil {
+		t.Fatalf("Error reading config file: %s", err)
+	}
+	const want = "developer_token: GoodDevToken\nrefresh_token: NewRefreshToken\n"
+	if string(got) != want {
+		t.Errorf("Config file mismatch - got: %s, want: %s", got, want)
+	}
+	if cfg.RefreshToken != "NewRefreshToken" {
+		t.Errorf("RefreshToken mismatch - got: %s, want: NewRefreshToken", cfg.RefreshToken)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 2 {
+		t.Errorf("Temp files are left in the config dir: %v", files)
+	}
+}
+
+func TestReplaceConfigSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require privileges on Windows")
+	}
+	dir, err := ioutil.TempDir("", "oauthdoctor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	realDir := filepath.Join(dir, "real")
+	if err := os.Mkdir(realDir, 0700); err != nil {
+		t.Fatalf("Error creating dir: %s", err)
+	}
+	targetFp := filepath.Join(realDir, "google-ads.yaml")
+	if err := ioutil.WriteFile(targetFp, []byte("refresh_token: OldRefreshToken\n"), 0600); err != nil {
+		t.Fatalf("Error writing config file: %s", err)
+	}
+	configFp := filepath.Join(dir, "google-ads.yaml")
+	if err := os.Symlink(targetFp, configFp); err != nil {
+		t.Fatalf("Error creating symlink: %s", err)
+	}
+
+	cfg := diag.ConfigFile{Filepath: dir, Filename: "google-ads.yaml", Lang: "python"}
+	backupFp := cfg.ReplaceConfig(diag.RefreshToken, "NewRefreshToken")
+
+	// The symlink is kept, and the target and its backup are written
+	if fi, err := os.Lstat(configFp); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Config file is not a symlink anymore: %v", err)
+	}
+	got, err := ioutil.ReadFile(targetFp)
+	if err != nil {
+		t.Fatalf("Error reading config file: %s", err)
+	}
+	if string(got) != "refresh_token: NewRefreshToken\n" {
+		t.Errorf("Config file mismatch - got: %s", got)
+	}
+	if filepath.Dir(backupFp) != realDir {
+		t.Errorf("Backup file is not next to the target - got: %s, want in: %s", backupFp, realDir)
+	}
+}
+
+func TestReplaceConfigReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oauthdoctor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	const original = "refresh_token: OldRefreshToken\n"
+	configFp := filepath.Join(dir, "google-ads.yaml")
+	if err := ioutil.WriteFile(configFp, []byte(original), 0600); err != nil {
+		t.Fatalf("Error writing config file: %s", err)
+	}
+
+	tests := []struct {
+		desc  string
+		cfg   diag.ConfigFile
+		setup func() bool
+	}{
+		{
+			desc:  "Already read-only",
+			cfg:   diag.ConfigFile{Filepath: dir, Filename: "google-ads.yaml", Lang: "python", ReadOnly: true},
+			setup: func() bool { return true },
+		},
+		{
+			desc: "File without write permission",
+			cfg:  diag.ConfigFile{Filepath: dir, Filename: "google-ads.yaml", Lang: "python"},
+			setup: func() bool {
+				// The permissions do not apply to root
+				return os.Chmod(configFp, 0400) == nil && os.Geteuid() != 0 && runtime.GOOS != "windows"
+			},
+		},
+	}
+
+	for _, test := range tests {
+		if !test.setup() {
+			t.Logf("%s: skipped", test.desc)
+			continue
+		}
+		if backupFp := test.cfg.ReplaceConfig(diag.RefreshToken, "NewRefreshToken"); backupFp != "" {
+			t.Errorf("%s: backup - got: %s, want none", test.desc, backupFp)
+		}
+		if got, _ := ioutil.ReadFile(configFp); string(got) != original {
+			t.Errorf("%s: config file is modified - got: %s", test.desc, got)
+		}
+		if !test.cfg.ReadOnly || test.cfg.RefreshToken != "NewRefreshToken" {
+			t.Errorf("%s: got read-only: %t, refresh token: %s, want the value kept in memory",
+				test.desc, test.cfg.ReadOnly, test.cfg.RefreshToken)
+		}
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Files are created in the config dir: %v", files)
+	}
+}
+
+func TestReplaceConfigOutputPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oauthdoctor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	const original = "developer_token: GoodDevToken\nrefresh_token: OldRefreshToken\n"
+	configFp := filepath.Join(dir, "google-ads.yaml")
+	if err := ioutil.WriteFile(configFp, []byte(original), 0644); err != nil {
+		t.Fatalf("Error writing config file: %s", err)
+	}
+
+	outputFp := filepath.Join(dir, "google-ads.new.yaml")
+	cfg := diag.ConfigFile{Filepath: dir, Filename: "google-ads.yaml", Lang: "python", OutputPath: outputFp}
+	if backupFp := cfg.ReplaceConfig(diag.RefreshToken, "NewRefreshToken"); backupFp != "" {
+		t.Errorf("Backup file is created with an output path: %s", backupFp)
+	}
+	cfg.ReplaceConfig(diag.DevToken, "NewDevToken")
+
+	got, err := ioutil.ReadFile(configFp)
+	if err != nil {
+		t.Fatalf("Error reading config file: %s", err)
+	}
+	if string(got) != original {
+		t.Errorf("Config file is modified - got: %s, want: %s", got, original)
+	}
+
+	got, err = ioutil.ReadFile(outputFp)
+	if err != nil {
+		t.Fatalf("Error reading output file: %s", err)
+	}
+	const want = "developer_token: NewDevToken\nrefresh_token: NewRefreshToken\n"
+	if string(got) != want {
+		t.Errorf("Output file mismatch - got: %s, want: %s", got, want)
+	}
+	if info, err := os.Stat(outputFp); err == nil && info.Mode().Perm() != 0600 {
+		t.Errorf("Output file mode - got: %s, want: -rw-------", info.Mode())
+	}
+}
+
+func TestGetConfigFileFromEnv(t *testing.T) {
+	old, had := os.LookupEnv(diag.ConfigPathEnv)
+	defer func() {
+		if had {
+			os.Setenv(diag.ConfigPathEnv, old)
+		} else {
+			os.Unsetenv(diag.ConfigPathEnv)
+		}
+	}()
+
+	tests := []struct {
+		env          string
+		overridePath string
+		want         diag.ConfigFile
+	}{
+		{
+			env:  "/env/path/google-ads.yaml",
+			want: diag.ConfigFile{Filepath: "/env/path", Filename: "google-ads.yaml", Lang: "python"},
+		},
+		{
+			env:          "/env/path/google-ads.yaml",
+			overridePath: "/flag/path/google_ads.yaml",
+			want:         diag.ConfigFile{Filepath: "/flag/path", Filename: "google_ads.yaml", Lang: "python"},
+		},
+	}
+
+	for _, test := range tests {
+		os.Setenv(diag.ConfigPathEnv, test.env)
+		got, err := diag.GetConfigFile("python", test.overridePath)
+		if err != nil {
+			t.Fatalf("GetConfigFile(%s) returned error: %s", test.overridePath, err)
+		}
+		if got != test.want {
+			t.Errorf("GetConfigFile(%s) with %s=%s - got: %+v, want: %+v",
+				test.overridePath, diag.ConfigPathEnv, test.env, got, test.want)
+		}
+	}
+}
+
+func TestCheckConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oauthdoctor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filled := filepath.Join(dir, "google-ads.yaml")
+	empty := filepath.Join(dir, "empty.yaml")
+	ioutil.WriteFile(filled, []byte("developer_token: abc\n"), 0600)
+	ioutil.WriteFile(empty, []byte(" \n\n"), 0600)
+
+	tests := []struct {
+		path    string
+		wantErr string
+	}{
+		{path: filled},
+		{path: empty, wantErr: "is empty"},
+		{path: filepath.Join(dir, "missing.yaml"), wantErr: "does not exist"},
+		{path: dir, wantErr: "is a directory"},
+	}
+
+	for _, test := range tests {
+		err := diag.CheckConfigFile(test.path)
+		if test.wantErr == "" {
+			if err != nil {
+				t.Errorf("CheckConfigFile(%s) returned error: %s", test.path, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.wantErr) ||
+			!strings.Contains(err.Error(), test.path) {
+			t.Errorf("CheckConfigFile(%s) - got: %v, want an error with the path and %q",
+				test.path, err, test.wantErr)
+		}
+	}
+}
+
+func TestCheckPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("File permissions are not checked on Windows")
+	}
+
+	dir, err := ioutil.TempDir("", "oauthdoctor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		perm    os.FileMode
+		wantErr bool
+	}{
+		{perm: 0600, wantErr: false},
+		{perm: 0400, wantErr: false},
+		{perm: 0640, wantErr: true},
+		{perm: 0644, wantErr: true},
+		{perm: 0604, wantErr: true},
+	}
+
+	cfg := diag.ConfigFile{Filepath: dir, Filename: "google-ads.yaml", Lang: "python"}
+	configFp := filepath.Join(dir, cfg.Filename)
+	for _, test := range tests {
+		os.Remove(configFp)
+		if err := ioutil.WriteFile(configFp, []byte("developer_token: abc\n"), test.perm); err != nil {
+			t.Fatalf("Error writing config file: %s", err)
+		}
+		// WriteFile is subject to umask
+		os.Chmod(configFp, test.perm)
+
+		if err := cfg.CheckPermissions(); (err != nil) != test.wantErr {
+			t.Errorf("CheckPermissions with mode %04o - got: %v, want error: %t",
+				test.perm, err, test.wantErr)
+		}
+	}
+}
+
 func TestParseKeyValueFile(t *testing.T) {
 	dir, err := os.Getwd()
 	if err != nil {
@@ -202,6 +864,37 @@ func TestParseKeyValueFile(t *testing.T) {
 				},
 			},
 		}, // Java
+		{
+			configPath: filepath.Join(dir, "testdata", "config_file5"),
+			lang:       "python",
+			want: diag.ConfigFile{
+				Filepath: filepath.Join(dir, "testdata"),
+				Filename: "config_file5",
+				Lang:     "python",
+				ConfigKeys: diag.ConfigKeys{
+					DevToken:          "GoodDevToken",
+					JSONKeyFilePath:   "/path/to/service-account-key.json",
+					ImpersonatedEmail: "user@example.com",
+				},
+			},
+		}, // Python: Service account
+		{
+			configPath: filepath.Join(dir, "testdata", "config_file6"),
+			lang:       "python",
+			want: diag.ConfigFile{
+				Filepath: filepath.Join(dir, "testdata"),
+				Filename: "config_file6",
+				Lang:     "python",
+				ConfigKeys: diag.ConfigKeys{
+					ClientID:        "0123456789-GoodClientID.apps.googleusercontent.com",
+					ClientSecret:    "Good+Client=Secret",
+					DevToken:        "GoodDevToken",
+					RefreshToken:    "1//Good_Refresh_Token",
+					LoginCustomerID: "1234567890",
+					UseProtoPlus:    "True",
+				},
+			},
+		}, // Python: Quoted values, comments and use_proto_plus
 	}
 
 	for _, test := range tests {
@@ -213,6 +906,60 @@ func TestParseKeyValueFile(t *testing.T) {
 	}
 }
 
+func TestParseRubyFile(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("Error getting current dir: %s", err)
+	}
+
+	configPath := filepath.Join(dir, "testdata", "ruby_config_file1")
+	want := diag.ConfigFile{
+		Filepath: filepath.Join(dir, "testdata"),
+		Filename: "ruby_config_file1",
+		Lang:     "ruby",
+		ConfigKeys: diag.ConfigKeys{
+			ClientID:        "GoodClientID",
+			ClientSecret:    "GoodClientSecret",
+			DevToken:        "GoodDevToken",
+			RefreshToken:    "GoodRefreshToken",
+			LoginCustomerID: "1234567890",
+		},
+	}
+
+	got, err := diag.ParseRubyFile(configPath)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseRubyFile mismatch - got: %+v, want: %+v, err: %s",
+			got, want, errstring(err))
+	}
+}
+
+func TestParseINIFile(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("Error getting current dir: %s", err)
+	}
+
+	configPath := filepath.Join(dir, "testdata", "php_config_file1")
+	want := diag.ConfigFile{
+		Filepath: filepath.Join(dir, "testdata"),
+		Filename: "php_config_file1",
+		Lang:     "php",
+		ConfigKeys: diag.ConfigKeys{
+			ClientID:        "GoodClientID",
+			ClientSecret:    "GoodClientSecret",
+			DevToken:        "GoodDevToken",
+			RefreshToken:    "GoodRefreshToken",
+			LoginCustomerID: "1234567890",
+		},
+	}
+
+	got, err := diag.ParseINIFile(configPath)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseINIFile mismatch - got: %+v, want: %+v, err: %s",
+			got, want, errstring(err))
+	}
+}
+
 func TestParseXMLFile(t *testing.T) {
 	dir, err := os.Getwd()
 	if err != nil {
@@ -239,6 +986,22 @@ func TestParseXMLFile(t *testing.T) {
 				},
 			},
 		}, // Can parse DotNet XML with sp
+		{
+			configPath: filepath.Join(dir, "testdata", "xml_config_file2"),
+			lang:       "dotnet",
+			want: diag.ConfigFile{
+				Filepath: filepath.Join(dir, "testdata"),
+				Filename: "xml_config_file2",
+				Lang:     "dotnet",
+				ConfigKeys: diag.ConfigKeys{
+					ClientID:        "0123456789-GoodClientID.apps.googleusercontent.com",
+					ClientSecret:    "Good&ClientSecret",
+					DevToken:        "GoodDevToken",
+					RefreshToken:    "1/PG1Ap6P-Good_Refresh_Token",
+					LoginCustomerID: "1234567890",
+				},
+			},
+		}, // Can parse element-style settings and attributes in any order
 	}
 
 	for _, test := range tests {
@@ -250,6 +1013,205 @@ func TestParseXMLFile(t *testing.T) {
 	}
 }
 
+func TestParseJSONFile(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("Error getting current dir: %s", err)
+	}
+
+	tests := []struct {
+		configPath string
+		want       diag.ConfigFile
+	}{
+		{
+			configPath: filepath.Join(dir, "testdata", "node_config_file1"),
+			want: diag.ConfigFile{
+				Filepath: filepath.Join(dir, "testdata"),
+				Filename: "node_config_file1",
+				Lang:     "node",
+				ConfigKeys: diag.ConfigKeys{
+					ClientID:     "0123456789-GoodClientID.apps.googleusercontent.com",
+					ClientSecret: "GoodClientSecret",
+					DevToken:     "GoodDevToken",
+					RefreshToken: "1/PG1Ap6P-Good_Refresh_Token",
+				},
+			},
+		}, // Can parse a flat object
+		{
+			configPath: filepath.Join(dir, "testdata", "node_config_file2"),
+			want: diag.ConfigFile{
+				Filepath: filepath.Join(dir, "testdata"),
+				Filename: "node_config_file2",
+				Lang:     "node",
+				ConfigKeys: diag.ConfigKeys{
+					ClientID:        "0123456789-GoodClientID.apps.googleusercontent.com",
+					ClientSecret:    "GoodClientSecret",
+					DevToken:        "GoodDevToken",
+					RefreshToken:    "1/PG1Ap6P-Good_Refresh_Token",
+					LoginCustomerID: "1234567890",
+				},
+			},
+		}, // Can parse a nested credentials object with a numeric customer ID
+	}
+
+	for _, test := range tests {
+		got, err := diag.ParseJSONFile(test.configPath)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("JSONFile mismatch - got: %+v, want: %+v, err: %s",
+				got, test.want, errstring(err))
+		}
+	}
+
+	keyFile := filepath.Join(dir, "testdata", "unknown_config_file")
+	if _, err := diag.ParseJSONFile(keyFile); err == nil {
+		t.Errorf("ParseJSONFile(%s) - got no error, want an error for a file that is not JSON", keyFile)
+	}
+}
+
+func TestFindPlaceholders(t *testing.T) {
+	keys := []string{diag.DevToken, diag.ClientID, diag.ClientSecret, diag.RefreshToken}
+
+	tests := []struct {
+		cfg  diag.ConfigFile
+		want []string
+	}{
+		{
+			cfg: diag.ConfigFile{
+				Lang: "python",
+				ConfigKeys: diag.ConfigKeys{
+					DevToken:     "GoodDevToken",
+					ClientID:     "GoodClientID",
+					ClientSecret: "GoodClientSecret",
+					RefreshToken: "GoodRefreshToken",
+				},
+			},
+			want: nil,
+		}, // Everything is filled in
+		{
+			cfg: diag.ConfigFile{
+				Lang: "python",
+				ConfigKeys: diag.ConfigKeys{
+					DevToken:     "INSERT_DEVELOPER_TOKEN_HERE",
+					ClientID:     "INSERT_OAUTH2_CLIENT_ID_HERE",
+					ClientSecret: "GoodClientSecret",
+				},
+			},
+			want: []string{diag.DevToken, diag.ClientID, diag.RefreshToken},
+		}, // Python placeholders and an empty value
+		{
+			cfg: diag.ConfigFile{
+				Lang: "ruby",
+				ConfigKeys: diag.ConfigKeys{
+					DevToken:     "GoodDevToken",
+					ClientID:     "GoodClientID",
+					ClientSecret: "INSERT_SOME_NEW_SECRET_HERE",
+					RefreshToken: "GoodRefreshToken",
+				},
+			},
+			want: []string{diag.ClientSecret},
+		}, // Unknown placeholder in the INSERT_..._HERE form
+	}
+
+	for _, test := range tests {
+		if got := test.cfg.FindPlaceholders(keys); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("FindPlaceholders mismatch - got: %v, want: %v", got, test.want)
+		}
+	}
+}
+
+func TestNormalizeCustomerID(t *testing.T) {
+	tests := []struct {
+		desc    string
+		cid     string
+		want    string
+		wantErr bool
+	}{
+		{desc: "digits only", cid: "1234567890", want: "1234567890"},
+		{desc: "dashes", cid: "123-456-7890", want: "1234567890"},
+		{desc: "surrounding whitespace", cid: " 123-456-7890\n", want: "1234567890"},
+		{desc: "empty", cid: " ", wantErr: true},
+		{desc: "9 digits", cid: "123-456-789", wantErr: true},
+		{desc: "11 digits", cid: "123-456-78901", wantErr: true},
+		{desc: "non-numeric", cid: "123-456-789O", wantErr: true},
+		{desc: "inner whitespace", cid: "123 456 7890", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := diag.NormalizeCustomerID(test.cid)
+		if (err != nil) != test.wantErr {
+			t.Errorf("[%s] NormalizeCustomerID(%q) error = %v, wantErr %v",
+				test.desc, test.cid, err, test.wantErr)
+		}
+		if got != test.want {
+			t.Errorf("[%s] NormalizeCustomerID(%q) = %q, want %q",
+				test.desc, test.cid, got, test.want)
+		}
+	}
+}
+
+func TestParseCustomerIDs(t *testing.T) {
+	tests := []struct {
+		desc    string
+		s       string
+		want    []string
+		wantErr bool
+	}{
+		{desc: "single", s: "123-456-7890", want: []string{"1234567890"}},
+		{desc: "comma separated", s: "1234567890, 098-765-4321", want: []string{"1234567890", "0987654321"}},
+		{desc: "file", s: "# Clients\n1234567890\n\n0987654321\n", want: []string{"1234567890", "0987654321"}},
+		{desc: "duplicates", s: "1234567890\n123-456-7890", want: []string{"1234567890"}},
+		{desc: "malformed", s: "1234567890\n12345", wantErr: true},
+		{desc: "empty", s: "# No clients\n", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := diag.ParseCustomerIDs(test.s)
+		if (err != nil) != test.wantErr {
+			t.Errorf("[%s] ParseCustomerIDs(%q) error = %v, wantErr %v",
+				test.desc, test.s, err, test.wantErr)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("[%s] ParseCustomerIDs(%q) = %v, want %v",
+				test.desc, test.s, got, test.want)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	cfg := diag.ConfigFile{
+		ConfigKeys: diag.ConfigKeys{
+			ClientID:     "GoodClientID",
+			ClientSecret: "GoodClientSecret",
+			DevToken:     "GoodDevToken",
+			RefreshToken: "1//Good_Refresh_Token",
+		},
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{
+			input: `{"error": {"message": "Token GoodDevToken is not approved"}}`,
+			want:  `{"error": {"message": "Token ` + diag.Mask + ` is not approved"}}`,
+		}, // JSON response
+		{
+			input: "developer-token: GoodDevToken\nclient_id: GoodClientID",
+			want:  "developer-token: " + diag.Mask + "\nclient_id: GoodClientID",
+		}, // Header dump: ClientID is not a secret
+		{
+			input: "client_secret=GoodClientSecret&refresh_token=1%2F%2FGood_Refresh_Token",
+			want:  "client_secret=" + diag.Mask + "&refresh_token=" + diag.Mask,
+		}, // URL encoded request
+	}
+
+	for _, test := range tests {
+		if got := cfg.Redact(test.input); got != test.want {
+			t.Errorf("Redact mismatch - got: %s, want: %s", got, test.want)
+		}
+	}
+}
+
 func errstring(err error) string {
 	if err != nil {
 		return err.Error()
@@ -0,0 +1,165 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diag
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// languageExts maps the file extensions to the client library languages.
+var languageExts = map[string]string{
+	".config":     "dotnet",
+	".xml":        "dotnet",
+	".ini":        "php",
+	".json":       "node",
+	".properties": "java",
+	".rb":         "ruby",
+	".yaml":       "python",
+	".yml":        "python",
+}
+
+// configFormats maps the configuration file formats to the client library
+// languages that read them.
+var configFormats = map[string]string{
+	"ini":        "php",
+	"json":       "node",
+	"properties": "java",
+	"rb":         "ruby",
+	"xml":        "dotnet",
+	"yaml":       "python",
+}
+
+// ConfigFormats returns the sorted configuration file formats that can be
+// given to FormatLanguage.
+func ConfigFormats() []string {
+	var formats []string
+	for f := range configFormats {
+		formats = append(formats, f)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// FormatLanguage returns the client library language whose parser reads the
+// configuration file format, e.g. php for ini, so that the detection of the
+// language can be bypassed for an unusually named file.
+func FormatLanguage(format string) (string, error) {
+	format = strings.TrimPrefix(strings.ToLower(format), ".")
+	if lang, ok := configFormats[format]; ok {
+		return lang, nil
+	}
+	return "", fmt.Errorf("unsupported config format %q. Supported formats are: %s",
+		format, strings.Join(ConfigFormats(), ", "))
+}
+
+// languageMarkers are the strings that only appear in the configuration file
+// of a client library language. They are matched in order.
+var languageMarkers = []struct {
+	lang   string
+	marker string
+}{
+	{lang: "dotnet", marker: "<GoogleAdsApi>"},
+	{lang: "ruby", marker: "Google::Ads::GoogleAds::Config.new"},
+	{lang: "php", marker: "[GOOGLE_ADS]"},
+	{lang: "php", marker: "[OAUTH2]"},
+	{lang: "java", marker: "api.googleads."},
+	{lang: "node", marker: `"developer_token"`},
+	{lang: "python", marker: "developer_token:"},
+}
+
+// DetectLanguage returns the client library language of the configuration
+// file at path. The language is determined by the filename first, and then
+// by the content of the file.
+func DetectLanguage(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return detectLanguage(filepath.Base(path), content)
+}
+
+// detectLanguage returns the client library language of the configuration
+// file with the given filename and content.
+func detectLanguage(filename string, content []byte) (string, error) {
+	for lang, cfg := range Languages {
+		if strings.EqualFold(filename, cfg.Cfg.Filename) {
+			return lang, nil
+		}
+	}
+
+	if lang, ok := languageExts[strings.ToLower(filepath.Ext(filename))]; ok {
+		return lang, nil
+	}
+
+	for _, m := range languageMarkers {
+		if bytes.Contains(content, []byte(m.marker)) {
+			return m.lang, nil
+		}
+	}
+
+	return "", fmt.Errorf("cannot detect the client library language of %s. Supported formats are: %s",
+		filename, strings.Join(supportedFormats(), ", "))
+}
+
+// supportedFormats returns the default configuration filename of each
+// client library language.
+func supportedFormats() []string {
+	var formats []string
+	for _, lang := range ListLanguages() {
+		formats = append(formats, fmt.Sprintf("%s (%s)", Languages[lang].Cfg.Filename, lang))
+	}
+	return formats
+}
+
+// ParseConfigFile parses the configuration file at path with the parser of
+// the given client library language. When lang is empty, the language is
+// detected by DetectLanguage.
+func ParseConfigFile(lang, path string) (ConfigFile, error) {
+	if err := CheckConfigFile(path); err != nil {
+		return ConfigFile{}, err
+	}
+	if lang == "" {
+		var err error
+		if lang, err = DetectLanguage(path); err != nil {
+			return ConfigFile{}, err
+		}
+	}
+
+	var c ConfigFile
+	var err error
+	switch lang {
+	case "dotnet":
+		c, err = ParseXMLFile(path)
+	case "node":
+		c, err = ParseJSONFile(path)
+	case "php":
+		c, err = ParseINIFile(path)
+	case "ruby":
+		c, err = ParseRubyFile(path)
+	default:
+		c, err = ParseKeyValueFile(lang, path)
+	}
+	if err == nil && c.ConfigKeys == (ConfigKeys{}) {
+		err = fmt.Errorf("none of the keys of the %s client library are "+
+			"found in config file %s. Please check the language and the "+
+			"format of the file", lang, path)
+	}
+	c.normalizeLoginCustomerID()
+	return c, err
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package diag_test
+
+import (
+	"oauthdoctor/diag"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+		errstr   string
+	}{
+		{filename: "config_file1", want: "python", errstr: "nil"},
+		{filename: "config_file2", want: "ruby", errstr: "nil"},
+		{filename: "config_file3", want: "php", errstr: "nil"},
+		{filename: "config_file4", want: "java", errstr: "nil"},
+		{filename: "config_file5", want: "python", errstr: "nil"},
+		{filename: "xml_config_file1", want: "dotnet", errstr: "nil"},
+		{filename: "node_config_file1", want: "node", errstr: "nil"},
+		{filename: "unknown_config_file", want: "", errstr: "google-ads.yaml (python)"},
+	}
+
+	for _, test := range tests {
+		got, err := diag.DetectLanguage(filepath.Join("testdata", test.filename))
+		if got != test.want || !strings.Contains(errstring(err), test.errstr) {
+			t.Errorf("DetectLanguage(%s) - got: %s, want: %s, got err: %s, but missing %s in error msg",
+				test.filename, got, test.want, errstring(err), test.errstr)
+		}
+	}
+}
+
+func TestParseConfigFileDetectsLanguage(t *testing.T) {
+	got, err := diag.ParseConfigFile("", filepath.Join("testdata", "xml_config_file1"))
+	if err != nil {
+		t.Fatalf("ParseConfigFile returned error: %s", err)
+	}
+	if got.Lang != "dotnet" || got.DevToken != "GoodDevToken" {
+		t.Errorf("ParseConfigFile mismatch - got: %+v", got)
+	}
+}
+
+func TestFormatLanguage(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+		errstr string
+	}{
+		{format: "yaml", want: "python", errstr: "nil"},
+		{format: "properties", want: "java", errstr: "nil"},
+		{format: "INI", want: "php", errstr: "nil"},
+		{format: ".rb", want: "ruby", errstr: "nil"},
+		{format: "xml", want: "dotnet", errstr: "nil"},
+		{format: "json", want: "node", errstr: "nil"},
+		{format: "toml", want: "", errstr: "Supported formats are: ini, json, properties, rb, xml, yaml"},
+	}
+
+	for _, test := range tests {
+		got, err := diag.FormatLanguage(test.format)
+		if got != test.want || !strings.Contains(errstring(err), test.errstr) {
+			t.Errorf("FormatLanguage(%s) - got: %s, want: %s, got err: %s, but missing %s in error msg",
+				test.format, got, test.want, errstring(err), test.errstr)
+		}
+	}
+}
+
+func TestParseConfigFileForcedFormat(t *testing.T) {
+	// The YAML file of the Python client library has no INI sections
+	lang, _ := diag.FormatLanguage("ini")
+	if _, err := diag.ParseConfigFile(lang, filepath.Join("testdata", "config_file1")); err == nil {
+		t.Error("ParseConfigFile of a YAML file as ini - got: nil, want: an error")
+	}
+
+	// An unusually named file is parsed with the forced format
+	got, err := diag.ParseConfigFile(lang, filepath.Join("testdata", "config_file3"))
+	if err != nil || got.DevToken != "GoodDevToken" {
+		t.Errorf("ParseConfigFile of an INI file as ini - got: %+v, err: %s", got, errstring(err))
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diag
+
+// This file contains the loader of a configuration supplied in environment
+// variables instead of a configuration file.
+
+import (
+	"log"
+	"os"
+)
+
+// EnvVars maps the keys in ConfigKeys to the environment variables that the
+// client libraries read when no configuration file is used.
+var EnvVars = map[string]string{
+	ClientID:          "GOOGLE_ADS_CLIENT_ID",
+	ClientSecret:      "GOOGLE_ADS_CLIENT_SECRET",
+	DevToken:          "GOOGLE_ADS_DEVELOPER_TOKEN",
+	ImpersonatedEmail: "GOOGLE_ADS_IMPERSONATED_EMAIL",
+	JSONKeyFilePath:   "GOOGLE_ADS_JSON_KEY_FILE_PATH",
+	LinkedCustomerID:  "GOOGLE_ADS_LINKED_CUSTOMER_ID",
+	LoginCustomerID:   "GOOGLE_ADS_LOGIN_CUSTOMER_ID",
+	RefreshToken:      "GOOGLE_ADS_REFRESH_TOKEN",
+	UseProtoPlus:      "GOOGLE_ADS_USE_PROTO_PLUS",
+}
+
+// HasEnvConfig returns true when the developer token, which every OAuth type
+// needs, is set in the environment.
+func HasEnvConfig() bool {
+	return os.Getenv(EnvVars[DevToken]) != ""
+}
+
+// LoadEnvConfig returns a ConfigFile populated from the GOOGLE_ADS_*
+// environment variables. The returned ConfigFile has no file behind it, so
+// ReplaceConfig only updates the values in memory.
+func LoadEnvConfig(lang string) ConfigFile {
+	c := ConfigFile{Lang: lang, FromEnv: true}
+	for k, env := range EnvVars {
+		if v, ok := os.LookupEnv(env); ok {
+			c.SetConfigKeys(k, v)
+		}
+	}
+	c.normalizeLoginCustomerID()
+	return c
+}
+
+// replaceEnvConfig updates a value read from the environment and explains
+// how to change the environment variable, since there is no file to rewrite.
+func (c *ConfigFile) replaceEnvConfig(key, value string) {
+	c.SetConfigKeys(key, value)
+	if value == "" {
+		log.Printf("The configuration is read from environment variables, so "+
+			"no file is modified. Please unset %s in your environment.", EnvVars[key])
+		return
+	}
+	if Contains(SecretWords, key) {
+		value = Mask
+	}
+	log.Printf("The configuration is read from environment variables, so "+
+		"no file is modified. Please set %s=%s in your environment.", EnvVars[key], value)
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package diag_test
+
+import (
+	"oauthdoctor/diag"
+	"os"
+	"testing"
+)
+
+func TestLoadEnvConfig(t *testing.T) {
+	env := map[string]string{
+		"GOOGLE_ADS_DEVELOPER_TOKEN":   "abcdefghijkl1234567890",
+		"GOOGLE_ADS_CLIENT_ID":         "12345.apps.googleusercontent.com",
+		"GOOGLE_ADS_CLIENT_SECRET":     "secret",
+		"GOOGLE_ADS_REFRESH_TOKEN":     "refresh",
+		"GOOGLE_ADS_LOGIN_CUSTOMER_ID": "1234567890",
+	}
+	for _, v := range diag.EnvVars {
+		old, had := os.LookupEnv(v)
+		if had {
+			defer os.Setenv(v, old)
+		} else {
+			defer os.Unsetenv(v)
+		}
+		os.Unsetenv(v)
+	}
+
+	if diag.HasEnvConfig() {
+		t.Errorf("HasEnvConfig() with no variables set - got: true, want: false")
+	}
+	for k, v := range env {
+		os.Setenv(k, v)
+	}
+	if !diag.HasEnvConfig() {
+		t.Errorf("HasEnvConfig() - got: false, want: true")
+	}
+
+	got := diag.LoadEnvConfig("python")
+	want := diag.ConfigFile{
+		Lang:    "python",
+		FromEnv: true,
+		ConfigKeys: diag.ConfigKeys{
+			ClientID:        "12345.apps.googleusercontent.com",
+			ClientSecret:    "secret",
+			DevToken:        "abcdefghijkl1234567890",
+			RefreshToken:    "refresh",
+			LoginCustomerID: "1234567890",
+		},
+	}
+	if got != want {
+		t.Errorf("LoadEnvConfig() - got: %+v, want: %+v", got, want)
+	}
+
+	if k := got.GetConfigKeysInLang(diag.RefreshToken); k != "GOOGLE_ADS_REFRESH_TOKEN" {
+		t.Errorf("GetConfigKeysInLang(%s) - got: %s, want: GOOGLE_ADS_REFRESH_TOKEN",
+			diag.RefreshToken, k)
+	}
+
+	// ReplaceConfig does not touch any file in environment mode
+	if backup := got.ReplaceConfig(diag.RefreshToken, "new"); backup != "" {
+		t.Errorf("ReplaceConfig() in environment mode - got backup: %s, want none", backup)
+	}
+	if got.RefreshToken != "new" {
+		t.Errorf("ReplaceConfig() in environment mode - got: %s, want: new", got.RefreshToken)
+	}
+}
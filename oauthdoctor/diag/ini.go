@@ -0,0 +1,105 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diag
+
+// This file contains functions that are specific to the configuration file
+// (google_ads_php.ini) of the PHP client library. The settings are split in
+// sections, e.g. the developer token is in [GOOGLE_ADS] and the OAuth2
+// credentials are in [OAUTH2], and a key is only read from its section.
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/fatih/structs"
+)
+
+const (
+	iniGoogleAdsSection = "GOOGLE_ADS"
+	iniOAuth2Section    = "OAUTH2"
+)
+
+// iniSections are the sections of the keys in ConfigKeys in the PHP
+// configuration file.
+var iniSections = map[string]string{
+	ClientID:          iniOAuth2Section,
+	ClientSecret:      iniOAuth2Section,
+	DevToken:          iniGoogleAdsSection,
+	ImpersonatedEmail: iniOAuth2Section,
+	JSONKeyFilePath:   iniOAuth2Section,
+	LinkedCustomerID:  iniGoogleAdsSection,
+	LoginCustomerID:   iniGoogleAdsSection,
+	RefreshToken:      iniOAuth2Section,
+}
+
+// iniSection returns the name of the section opened by the line, e.g.
+// GOOGLE_ADS for [GOOGLE_ADS]. It returns false when the line is not a
+// section header.
+func iniSection(line string) (string, bool) {
+	trimmed := strings.TrimSpace(line)
+	if len(trimmed) < 2 || trimmed[0] != '[' || trimmed[len(trimmed)-1] != ']' {
+		return "", false
+	}
+	return strings.TrimSpace(trimmed[1 : len(trimmed)-1]), true
+}
+
+// inKeySection returns true when key (e.g. DevToken) belongs in section.
+// Keys of the languages without sections are in any section.
+func (c *ConfigFile) inKeySection(key, section string) bool {
+	if c.Lang != "php" {
+		return true
+	}
+	return iniSections[key] == section
+}
+
+// ParseINIFile reads the PHP configuration file in filepath and returns a
+// ConfigFile. A key in a section other than its own, e.g. clientId in
+// [GOOGLE_ADS], is ignored.
+func ParseINIFile(filepath string) (c ConfigFile, err error) {
+	keyValue := make(map[string]string)
+	c, _ = GetConfigFile("php", filepath)
+	lang := Languages[c.Lang]
+	langKeys := swapMap(structs.Map(lang.Cfg.ConfigKeys))
+
+	f, err := os.Open(filepath)
+	if err != nil {
+		return c, err
+	}
+	defer f.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if s, ok := iniSection(line); ok {
+			section = s
+			continue
+		}
+		l, ok := parseValueLine(line, lang.Separator, lang.CommentChar, inlineComments[c.Lang])
+		if !ok {
+			continue
+		}
+		if key, ok := langKeys[l.key]; ok && c.inKeySection(key, section) {
+			keyValue[l.key] = l.value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return c, err
+	}
+
+	c.UpdateConfigKeys(keyValue)
+
+	return c, nil
+}
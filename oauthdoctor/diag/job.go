@@ -0,0 +1,127 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package diag
+
+// This file contains the job file, which describes a diagnosis declaratively
+// for the orchestration systems, e.g. CI.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// Job is a diagnosis described in a JSON job file. The fields that are set
+// are the values of the command line flags of the same meaning.
+type Job struct {
+	// ConfigPath is the path of the configuration file, as --configpath.
+	ConfigPath string `json:"configPath"`
+	// CustomerIDs are the customer IDs to diagnose, as --customerid.
+	CustomerIDs []string `json:"customerIds"`
+	// LoginCustomerID overrides the login customer ID of the configuration
+	// file, as --logincustomerid. An empty value sends no login customer ID,
+	// so it is only used when it is set.
+	LoginCustomerID *string `json:"loginCustomerId"`
+	// OAuthType is the OAuth2 type, as --oauthtype.
+	OAuthType string `json:"oauthType"`
+	// Flags are the other flags by name, e.g. {"noninteractive": true,
+	// "output": "json", "timeout": "10s"}. The values are strings, numbers or
+	// booleans.
+	Flags map[string]interface{} `json:"flags"`
+}
+
+// jobFields are the names of the fields in the job file.
+var jobFields = []string{"configPath", "customerIds", "flags", "loginCustomerId", "oauthType"}
+
+// ReadJob reads and validates the JSON job file in the given path. All the
+// unknown fields are reported in the error, since a misspelt field would be
+// silently ignored otherwise.
+func ReadJob(path string) (*Job, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the job file: %s", err)
+	}
+	return parseJob(content)
+}
+
+// parseJob parses and validates the content of a job file.
+func parseJob(content []byte) (*Job, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(content, &fields); err != nil {
+		return nil, fmt.Errorf("invalid job file: %s", err)
+	}
+	var unknown []string
+	for name := range fields {
+		if !Contains(jobFields, name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("invalid job file: unknown fields: %s. The fields are: %s",
+			strings.Join(unknown, ", "), strings.Join(jobFields, ", "))
+	}
+
+	var job Job
+	d := json.NewDecoder(bytes.NewReader(content))
+	d.UseNumber()
+	if err := d.Decode(&job); err != nil {
+		return nil, fmt.Errorf("invalid job file: %s", err)
+	}
+	if _, err := job.FlagValues(); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// FlagValues returns the values of the command line flags in the job by flag
+// name. It returns an error when a value in Flags is not a string, a number
+// or a boolean, or when it sets the same flag as a field of the job.
+func (j *Job) FlagValues() (map[string]string, error) {
+	values := make(map[string]string)
+	if j.ConfigPath != "" {
+		values["configpath"] = j.ConfigPath
+	}
+	if len(j.CustomerIDs) > 0 {
+		values["customerid"] = strings.Join(j.CustomerIDs, ",")
+	}
+	if j.LoginCustomerID != nil {
+		values["logincustomerid"] = *j.LoginCustomerID
+	}
+	if j.OAuthType != "" {
+		values["oauthtype"] = j.OAuthType
+	}
+
+	names := make([]string, 0, len(j.Flags))
+	for name := range j.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := values[name]; ok {
+			return nil, fmt.Errorf("invalid job file: flag %s is also set by a field of the job", name)
+		}
+		switch v := j.Flags[name].(type) {
+		case string:
+			values[name] = v
+		case bool, json.Number, float64:
+			values[name] = fmt.Sprint(v)
+		default:
+			return nil, fmt.Errorf("invalid job file: the value of flag %s must be a string, a number or a boolean", name)
+		}
+	}
+	return values, nil
+}
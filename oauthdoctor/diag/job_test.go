@@ -0,0 +1,96 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package diag_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"oauthdoctor/diag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadJob(t *testing.T) {
+	tests := []struct {
+		desc    string
+		content string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			desc: "All fields",
+			content: `{"configPath": "/tmp/google-ads.yaml", "customerIds": ["123-456-7890", "1112223333"],
+				"loginCustomerId": "", "oauthType": "installed_app",
+				"flags": {"noninteractive": true, "output": "json", "maxattempts": 2}}`,
+			want: map[string]string{"configpath": "/tmp/google-ads.yaml",
+				"customerid": "123-456-7890,1112223333", "logincustomerid": "",
+				"oauthtype": "installed_app", "noninteractive": "true", "output": "json",
+				"maxattempts": "2"},
+		},
+		{
+			desc:    "Unset login customer ID is not overridden",
+			content: `{"customerIds": ["1112223333"]}`,
+			want:    map[string]string{"customerid": "1112223333"},
+		},
+		{
+			desc:    "Unknown fields are all reported",
+			content: `{"customerId": "1112223333", "flag": {}}`,
+			wantErr: "unknown fields: customerId, flag",
+		},
+		{
+			desc:    "Flag set by a field of the job",
+			content: `{"customerIds": ["1112223333"], "flags": {"customerid": "1234567890"}}`,
+			wantErr: "flag customerid is also set",
+		},
+		{
+			desc:    "Flag value that is not a scalar",
+			content: `{"flags": {"scopes": ["a", "b"]}}`,
+			wantErr: "flag scopes must be a string",
+		},
+		{
+			desc:    "Malformed JSON",
+			content: `{"customerIds": `,
+			wantErr: "invalid job file",
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "oauthdoctor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i, test := range tests {
+		path := filepath.Join(dir, fmt.Sprintf("job%d.json", i))
+		if err := ioutil.WriteFile(path, []byte(test.content), 0600); err != nil {
+			t.Fatalf("Error writing job file: %s", err)
+		}
+		job, err := diag.ReadJob(path)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: ReadJob - got error: %v, want: %s", test.desc, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: ReadJob - got error: %s", test.desc, err)
+			continue
+		}
+		if got, _ := job.FlagValues(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: FlagValues - got: %v, want: %v", test.desc, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diag
+
+// This file contains functions that are specific to the JSON configuration
+// files of the Node.js google-ads-api library, e.g.
+// {"client_id": "...", "developer_token": "..."}. The keys are read from the
+// top-level object, or from a nested "credentials" object when there's one.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// jsonCredentialsKey is the key of the nested object of the credentials.
+const jsonCredentialsKey = "credentials"
+
+var (
+	// jsonAfterCommaRe and jsonBeforeCommaRe match the comma that separates
+	// a key-value pair from the next or the previous one.
+	jsonAfterCommaRe  = regexp.MustCompile(`^\s*,[ \t]*`)
+	jsonBeforeCommaRe = regexp.MustCompile(`,\s*$`)
+)
+
+// ParseJSONFile parses the file content given in filepath and returns
+// a ConfigFile struct with the given attributes in the file.
+func ParseJSONFile(filepath string) (c ConfigFile, err error) {
+	keyValue := make(map[string]string)
+	c, _ = GetConfigFile("node", filepath)
+
+	content, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return c, err
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(content, &obj); err != nil {
+		return c, err
+	}
+	if isServiceAccountKey(obj) {
+		return c, fmt.Errorf("%s is a service account JSON key file, not a "+
+			"configuration file. Its path is set in the configuration file instead", filepath)
+	}
+	if nested, ok := obj[jsonCredentialsKey]; ok {
+		var creds map[string]json.RawMessage
+		if err := json.Unmarshal(nested, &creds); err == nil {
+			obj = creds
+		}
+	}
+
+	for k, raw := range obj {
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			keyValue[k] = s
+		} else if isDigits(string(raw)) {
+			// A customer ID can be a number
+			keyValue[k] = string(raw)
+		}
+	}
+
+	c.UpdateConfigKeys(keyValue)
+
+	return c, nil
+}
+
+// isServiceAccountKey returns true when the JSON object is a service account
+// key file, which is often given instead of the configuration file.
+func isServiceAccountKey(obj map[string]json.RawMessage) bool {
+	var keyType string
+	json.Unmarshal(obj["type"], &keyType)
+	return keyType == "service_account"
+}
+
+// jsonValue returns value encoded as a JSON string, or as a number when the
+// old value is a number and value is a number without a leading zero.
+func jsonValue(value, old string) string {
+	if old != "" && !strings.HasPrefix(old, `"`) && isNumber(value) {
+		return value
+	}
+	b, _ := json.Marshal(value)
+	return string(b)
+}
+
+// replaceJSON replaces the value of key in the JSON content. Only the value
+// is changed, so that the order of the keys and the indentation are
+// preserved. When value is empty, the key-value pair is removed, since JSON
+// has no comments. The key is looked up in the object that ParseJSONFile
+// reads, i.e. the credentials object when there's one, or else the top-level
+// object, and a missing key-value pair is inserted at the top of it.
+func (c *ConfigFile) replaceJSON(key, value, content string) string {
+	langKey := c.GetConfigKeysInLang(key)
+	open := strings.Index(content, "{")
+	if open < 0 {
+		return content
+	}
+	if _, start, _, ok := jsonMember(content, open, jsonCredentialsKey); ok && content[start] == '{' {
+		open = start
+	}
+	if pairStart, start, end, ok := jsonMember(content, open, langKey); ok {
+		if value == "" {
+			return removeJSONPair(content, pairStart, end)
+		}
+		return content[:start] + jsonValue(value, content[start:end]) + content[end:]
+	}
+	if value == "" {
+		return content
+	}
+
+	pair := `"` + langKey + `": ` + jsonValue(value, "")
+	rest := content[open+1:]
+	body := strings.TrimLeft(rest, " \t\r\n")
+	empty := strings.HasPrefix(body, "}")
+	space := rest[:len(rest)-len(body)]
+	if !strings.Contains(space, "\n") {
+		// The object is on a single line
+		if empty {
+			return content[:open+1] + pair + rest
+		}
+		return content[:open+1] + pair + ", " + rest
+	}
+
+	// Indent the new line like the line after the opening brace
+	eol := "\n"
+	if strings.Contains(content, "\r\n") {
+		eol = "\r\n"
+	}
+	indent := space[strings.LastIndex(space, "\n")+1:]
+	if empty {
+		return content[:open+1] + eol + indent + "  " + pair + rest
+	}
+	return content[:open+1] + eol + indent + pair + "," + rest
+}
+
+// removeJSONPair removes the key-value pair between start and end from the
+// JSON content, together with the comma that separates it from the other
+// pairs. The line of the pair is removed when there's nothing else on it.
+func removeJSONPair(content string, start, end int) string {
+	if m := jsonAfterCommaRe.FindString(content[end:]); m != "" {
+		end += len(m)
+	} else if m := jsonBeforeCommaRe.FindString(content[:start]); m != "" {
+		start -= len(m)
+	}
+
+	lineStart := strings.LastIndex(content[:start], "\n") + 1
+	if strings.TrimSpace(content[lineStart:start]) == "" {
+		if i := strings.Index(content[end:], "\n"); i >= 0 && strings.TrimSpace(content[end:end+i]) == "" {
+			start, end = lineStart, end+i+1
+		}
+	}
+	return content[:start] + content[end:]
+}
+
+// jsonMember finds the member name among the direct members of the JSON
+// object that opens at open in content, skipping the nested objects and
+// arrays. It returns the offsets of the start of the member and of the start
+// and the end of its value, or false when the object has no such member.
+func jsonMember(content string, open int, name string) (int, int, int, bool) {
+	i := open + 1
+	for {
+		i = skipJSONSpace(content, i)
+		if i >= len(content) || content[i] != '"' {
+			return 0, 0, 0, false
+		}
+		pairStart := i
+		i = skipJSONString(content, i)
+		var key string
+		json.Unmarshal([]byte(content[pairStart:i]), &key)
+
+		i = skipJSONSpace(content, i)
+		if i >= len(content) || content[i] != ':' {
+			return 0, 0, 0, false
+		}
+		start := skipJSONSpace(content, i+1)
+		i = skipJSONValue(content, start)
+		if key == name && start < i {
+			return pairStart, start, i, true
+		}
+		i = skipJSONSpace(content, i)
+		if i >= len(content) || content[i] != ',' {
+			return 0, 0, 0, false
+		}
+		i++
+	}
+}
+
+// skipJSONSpace returns the offset of the first character at or after i in
+// content that is not whitespace.
+func skipJSONSpace(content string, i int) int {
+	for i < len(content) && strings.IndexByte(" \t\r\n", content[i]) >= 0 {
+		i++
+	}
+	return i
+}
+
+// skipJSONString returns the offset after the JSON string that starts at i
+// in content.
+func skipJSONString(content string, i int) int {
+	for i++; i < len(content); i++ {
+		switch content[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return len(content)
+}
+
+// skipJSONValue returns the offset after the JSON value that starts at i in
+// content, including the nested objects and arrays.
+func skipJSONValue(content string, i int) int {
+	if i >= len(content) {
+		return i
+	}
+	switch content[i] {
+	case '"':
+		return skipJSONString(content, i)
+	case '{', '[':
+		depth := 0
+		for i < len(content) {
+			switch content[i] {
+			case '"':
+				i = skipJSONString(content, i)
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+			}
+			i++
+			if depth == 0 {
+				return i
+			}
+		}
+		return i
+	}
+	for i < len(content) && strings.IndexByte(", \t\r\n}]", content[i]) < 0 {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,101 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package diag
+
+// This file contains the copy of the log output in a file, which can be sent
+// when contacting support.
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// LogFile is an io.Writer that writes a copy of the log output to a file,
+// with the secret values redacted and without the colors. The lines are held
+// until SetRedact is called, since the secret values are only known once the
+// configuration file is parsed.
+type LogFile struct {
+	f *os.File
+	// redact masks the secret values in the lines written to the file.
+	redact func(string) string
+	// pending are the lines written before redact is set.
+	pending []string
+}
+
+// openLogFile is the log file that is closed by Exitf, so that its pending
+// lines are not lost.
+var openLogFile *LogFile
+
+// CreateLogFile creates or truncates the log file in the given path, which
+// is only readable by the current user.
+func CreateLogFile(path string) (*LogFile, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	openLogFile = &LogFile{f: f}
+	return openLogFile, nil
+}
+
+// SetRedact sets the function that masks the secret values in the lines
+// written to the file, and writes the pending lines with it.
+func (l *LogFile) SetRedact(redact func(string) string) error {
+	l.redact = redact
+	return l.flush()
+}
+
+// flush writes the pending lines, redacted when redact is set.
+func (l *LogFile) flush() error {
+	pending := l.pending
+	l.pending = nil
+	for _, s := range pending {
+		if l.redact != nil {
+			s = l.redact(s)
+		}
+		if _, err := io.WriteString(l.f, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write implements io.Writer.
+func (l *LogFile) Write(p []byte) (int, error) {
+	s := string(p)
+	for _, color := range levelColors {
+		s = strings.Replace(s, color, "", -1)
+	}
+	s = strings.Replace(s, colorReset, "", -1)
+	if l.redact == nil {
+		l.pending = append(l.pending, s)
+		return len(p), nil
+	}
+	if _, err := io.WriteString(l.f, l.redact(s)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close writes the pending lines as they are, since no secret values are
+// known to redact them, and closes the log file.
+func (l *LogFile) Close() error {
+	if l == openLogFile {
+		openLogFile = nil
+	}
+	if err := l.flush(); err != nil {
+		l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
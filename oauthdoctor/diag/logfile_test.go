@@ -0,0 +1,63 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package diag_test
+
+import (
+	"io/ioutil"
+	"oauthdoctor/diag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oauthdoctor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "doctor.log")
+	f, err := diag.CreateLogFile(path)
+	if err != nil {
+		t.Fatalf("CreateLogFile(%s) - got error: %s", path, err)
+	}
+	diag.SetColor(true)
+	defer diag.SetColor(false)
+	// The line written before the secret values are known is held until then
+	early := "config file with SecretValue is parsed\n"
+	if n, err := f.Write([]byte(early)); err != nil || n != len(early) {
+		t.Errorf("Write - got: %d, %v, want: %d, nil", n, err, len(early))
+	}
+	if err := f.SetRedact(func(s string) string {
+		return strings.Replace(s, "SecretValue", diag.Mask, -1)
+	}); err != nil {
+		t.Errorf("SetRedact - got error: %s", err)
+	}
+	line := diag.FormatLevel(diag.LevelError, "refresh token SecretValue is invalid\n")
+	if n, err := f.Write([]byte(line)); err != nil || n != len(line) {
+		t.Errorf("Write - got: %d, %v, want: %d, nil", n, err, len(line))
+	}
+	f.Close()
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error reading the log file: %s", err)
+	}
+	want := "config file with " + diag.Mask + " is parsed\n" +
+		"ERROR: refresh token " + diag.Mask + " is invalid\n"
+	if got := string(content); got != want {
+		t.Errorf("log file - got: %q, want: %q", got, want)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diag
+
+// This file contains the leveled output of the doctor, which colors the
+// error and warning lines when they are printed to a terminal.
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime"
+)
+
+// Level is the severity of an output line. The progress and the guidance
+// lines are printed at LevelInfo with log.Print.
+type Level int
+
+// These are the levels of the output lines.
+const (
+	LevelInfo Level = iota
+	LevelWarn
+	LevelError
+)
+
+// levelPrefixes are the prefixes of the lines at each level.
+var levelPrefixes = map[Level]string{
+	LevelWarn:  "WARNING: ",
+	LevelError: "ERROR: ",
+}
+
+// levelColors are the ANSI escape codes of the colors of each level.
+var levelColors = map[Level]string{
+	LevelWarn:  "\x1b[33m",
+	LevelError: "\x1b[31m",
+}
+
+const colorReset = "\x1b[0m"
+
+// fatalOutput also gets the messages of Fatalf when it is not nil, e.g.
+// stderr when the log output is discarded in quiet mode.
+var fatalOutput io.Writer
+
+// SetFatalOutput sets the writer that also gets the messages of Fatalf, so
+// that they are not lost when the log output is discarded. A nil writer
+// only prints them to the log output.
+func SetFatalOutput(w io.Writer) {
+	fatalOutput = w
+}
+
+// colorOutput is true when the lines are colored by level.
+var colorOutput bool
+
+// SetColor enables or disables the colors of the output lines. They are
+// disabled by default.
+func SetColor(enabled bool) {
+	colorOutput = enabled
+}
+
+// ColorSupported returns true when f is a terminal that supports the ANSI
+// colors and the NO_COLOR environment variable is not set.
+// https://no-color.org
+func ColorSupported(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	// The Windows console only supports the ANSI escape codes when they
+	// are enabled, so they are only used in Windows Terminal.
+	if runtime.GOOS == "windows" && os.Getenv("WT_SESSION") == "" {
+		return false
+	}
+	return IsTerminal(f)
+}
+
+// IsTerminal returns true when f is a terminal, e.g. stdin of an interactive
+// session rather than a pipe or a file.
+func IsTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// FormatLevel returns msg with the prefix of the level, and colored when
+// the colors are enabled.
+func FormatLevel(level Level, msg string) string {
+	msg = levelPrefixes[level] + msg
+	if color, ok := levelColors[level]; ok && colorOutput {
+		msg = color + msg + colorReset
+	}
+	return msg
+}
+
+// Error prints msg at LevelError.
+func Error(msg string) {
+	log.Print(FormatLevel(LevelError, msg))
+}
+
+// Errorf prints the formatted message at LevelError.
+func Errorf(format string, v ...interface{}) {
+	log.Print(FormatLevel(LevelError, fmt.Sprintf(format, v...)))
+}
+
+// Warnf prints the formatted message at LevelWarn.
+func Warnf(format string, v ...interface{}) {
+	log.Print(FormatLevel(LevelWarn, fmt.Sprintf(format, v...)))
+}
+
+// Fatalf prints the formatted message at LevelError, also to the writer of
+// SetFatalOutput, and exits with status code 1.
+func Fatalf(format string, v ...interface{}) {
+	Exitf(1, format, v...)
+}
+
+// Exitf prints the formatted message at LevelError, also to the writer of
+// SetFatalOutput, and exits with the status code. The log file is closed
+// first, so that its pending lines are written.
+func Exitf(code int, format string, v ...interface{}) {
+	msg := FormatLevel(LevelError, fmt.Sprintf(format, v...))
+	if fatalOutput != nil {
+		fmt.Fprintln(fatalOutput, msg)
+	}
+	log.Print(msg)
+	if openLogFile != nil {
+		openLogFile.Close()
+	}
+	os.Exit(code)
+}
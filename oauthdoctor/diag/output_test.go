@@ -0,0 +1,66 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package diag_test
+
+import (
+	"oauthdoctor/diag"
+	"os"
+	"testing"
+)
+
+func TestFormatLevel(t *testing.T) {
+	defer diag.SetColor(false)
+
+	tests := []struct {
+		level diag.Level
+		color bool
+		want  string
+	}{
+		{diag.LevelInfo, true, "msg"},
+		{diag.LevelWarn, false, "WARNING: msg"},
+		{diag.LevelError, false, "ERROR: msg"},
+		{diag.LevelWarn, true, "\x1b[33mWARNING: msg\x1b[0m"},
+		{diag.LevelError, true, "\x1b[31mERROR: msg\x1b[0m"},
+	}
+	for _, test := range tests {
+		diag.SetColor(test.color)
+		if got := diag.FormatLevel(test.level, "msg"); got != test.want {
+			t.Errorf("FormatLevel(%d, msg) with color %t - got: %q, want: %q",
+				test.level, test.color, got, test.want)
+		}
+	}
+}
+
+func TestColorSupported(t *testing.T) {
+	old, had := os.LookupEnv("NO_COLOR")
+	if had {
+		defer os.Setenv("NO_COLOR", old)
+	} else {
+		defer os.Unsetenv("NO_COLOR")
+	}
+
+	f, err := os.Open("testdata/config_file1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	os.Unsetenv("NO_COLOR")
+	if diag.ColorSupported(f) {
+		t.Errorf("ColorSupported(regular file) - got: true, want: false")
+	}
+	os.Setenv("NO_COLOR", "1")
+	if diag.ColorSupported(os.Stdout) {
+		t.Errorf("ColorSupported(stdout) with NO_COLOR - got: true, want: false")
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diag
+
+// This file contains the line-level editor that replaces a single value in
+// a configuration file. Everything except the replaced value, including the
+// comments, blank lines, quoting style and line endings, is preserved.
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// valueLine is a key-value pair line split into its parts, so that the value
+// can be replaced without changing the rest of the line.
+type valueLine struct {
+	// prefix is the indentation, the key, the separator and the spaces
+	// before the value.
+	prefix string
+	key    string
+	// quote is the quote character around the value, if there's any.
+	quote string
+	value string
+	// suffix is the text after the value, e.g. a trailing comment.
+	suffix string
+}
+
+// parseValueLine splits a key-value pair line. The value ends at an inline
+// comment starting with inlineComment after a space, unless inlineComment
+// is empty. It returns false when the line is not a key-value pair, e.g. a
+// comment or a blank line.
+func parseValueLine(line, separator, commentChar, inlineComment string) (valueLine, bool) {
+	var l valueLine
+
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || (commentChar != "" && strings.HasPrefix(trimmed, commentChar)) {
+		return l, false
+	}
+
+	idx := strings.Index(line, separator)
+	if idx < 0 {
+		return l, false
+	}
+	l.key = strings.TrimSpace(line[:idx])
+	if l.key == "" {
+		return l, false
+	}
+
+	rest := line[idx+len(separator):]
+	value := strings.TrimLeft(rest, " \t")
+	l.prefix = line[:len(line)-len(value)]
+	l.splitValue(value, inlineComment)
+	return l, true
+}
+
+// splitValue splits the text after the prefix into the quote, the value and
+// the suffix. An unquoted value ends at an inline comment starting with
+// inlineComment after a space, or at any of the terminators.
+func (l *valueLine) splitValue(value, inlineComment string, terminators ...string) {
+	if len(value) > 0 && (value[0] == '"' || value[0] == '\'') {
+		if end := strings.IndexByte(value[1:], value[0]); end >= 0 {
+			l.quote = value[:1]
+			l.value = value[1 : end+1]
+			l.suffix = value[end+2:]
+			return
+		}
+	}
+
+	// An unquoted value ends at the trailing comment
+	end := len(value)
+	if inlineComment != "" {
+		terminators = append(terminators, " "+inlineComment, "\t"+inlineComment)
+	}
+	for _, t := range terminators {
+		if i := strings.Index(value, t); i >= 0 && i < end {
+			end = i
+		}
+	}
+	l.value = strings.TrimRight(value[:end], " \t")
+	l.suffix = value[len(l.value):]
+}
+
+// String returns the key-value pair line.
+func (l valueLine) String() string {
+	return l.prefix + l.quote + l.value + l.quote + l.suffix
+}
+
+// inlineComments are the characters that start a comment after a value in
+// each language. The values in a .properties file cannot have comments.
+var inlineComments = map[string]string{
+	"php":    ";",
+	"python": "#",
+	"ruby":   "#",
+}
+
+// splitEOL splits a line into its content and its line ending.
+func splitEOL(line string) (string, string) {
+	switch {
+	case strings.HasSuffix(line, "\r\n"):
+		return line[:len(line)-2], "\r\n"
+	case strings.HasSuffix(line, "\n"):
+		return line[:len(line)-1], "\n"
+	}
+	return line, ""
+}
+
+// replaceLine replaces the value of langKey in the line. When value is
+// empty, the line is commented out instead. It returns false when the line
+// is not the key-value pair of langKey.
+func (c *ConfigFile) replaceLine(langKey, value, line string) (string, bool) {
+	if c.Lang == "dotnet" {
+		return replaceXMLLine(langKey, value, line)
+	}
+
+	lang := Languages[c.Lang]
+	var l valueLine
+	var ok bool
+	if c.Lang == "ruby" {
+		l, ok = parseRubyLine(line)
+	} else {
+		l, ok = parseValueLine(line, lang.Separator, lang.CommentChar, inlineComments[c.Lang])
+	}
+	if !ok || l.key != langKey {
+		return line, false
+	}
+	if value == "" {
+		return lang.CommentChar + line, true
+	}
+	if c.Lang == "ruby" && l.quote == "" && !isNumber(value) {
+		// Replace a number or nil with a string
+		l.quote = "'"
+	}
+	if c.Lang == "java" {
+		// The quotes and the trailing whitespace are part of the value in a
+		// .properties file
+		l.quote, l.suffix = "", ""
+	}
+	l.value = value
+	return l.String(), true
+}
+
+// isInsertAnchor returns true when a missing key-value pair of key is
+// inserted after the line, i.e. the line opens the section of the key.
+func (c *ConfigFile) isInsertAnchor(key, line string) bool {
+	trimmed := strings.TrimSpace(line)
+	switch c.Lang {
+	case "dotnet":
+		return strings.Contains(trimmed, "<GoogleAdsApi>")
+	case "php":
+		section, ok := iniSection(trimmed)
+		return ok && section == iniSections[key]
+	case "ruby":
+		return !strings.HasPrefix(trimmed, "#") &&
+			strings.Contains(trimmed, "Google::Ads::GoogleAds::Config.new")
+	}
+	return false
+}
+
+// ReplaceConfigFromReader reads configuration file content from io.Reader
+// according to a specific language config file syntax, and replaces the
+// value of the given key in place. Only the value is changed; comments,
+// blank lines, quoting style, line endings and the other keys are preserved.
+// When the key is not found, the new key-value pair is inserted at the top
+// of the section of the key, or at the top of the file. When value is empty,
+// the existing key-value pair is commented out and nothing is inserted,
+// which removes the key from the configuration. In a PHP configuration file,
+// only the key in the section of the key is replaced, and a missing section
+// is appended to the end of the file. In a JSON configuration file, see
+// replaceJSON, the key-value pair is removed instead of commented out.
+func (c *ConfigFile) ReplaceConfigFromReader(key, value string, r io.Reader) string {
+	content, _ := ioutil.ReadAll(r)
+	if c.Lang == "node" {
+		return c.replaceJSON(key, value, string(content))
+	}
+	langKey := c.GetConfigKeysInLang(key)
+	lines := strings.SplitAfter(string(content), "\n")
+
+	var buf bytes.Buffer
+	found, inComment := false, false
+	section := ""
+	for _, line := range lines {
+		text, eol := splitEOL(line)
+		commented := false
+		if c.Lang == "dotnet" {
+			commented, inComment = xmlCommentState(text, inComment)
+		}
+		if s, ok := iniSection(text); ok && c.Lang == "php" {
+			section = s
+		}
+		if !found && !commented && c.inKeySection(key, section) {
+			text, found = c.replaceLine(langKey, value, text)
+		}
+		buf.WriteString(text + eol)
+	}
+	if found || value == "" {
+		return buf.String()
+	}
+
+	// Insert the missing key-value pair with the line ending of the file
+	eol := "\n"
+	if strings.Contains(string(content), "\r\n") {
+		eol = "\r\n"
+	}
+	newLine := strings.TrimSuffix(c.configLineStr(key, value), "\n") + eol
+
+	buf.Reset()
+	for i, line := range lines {
+		buf.WriteString(line)
+		if c.isInsertAnchor(key, line) {
+			// Indent the new line like the line after the anchor
+			indent := ""
+			if i+1 < len(lines) {
+				next := lines[i+1]
+				indent = next[:len(next)-len(strings.TrimLeft(next, " \t"))]
+			}
+			if !strings.HasSuffix(line, "\n") {
+				buf.WriteString(eol)
+			}
+			if v := rubyBlockVar(line); c.Lang == "ruby" && v != "" {
+				newLine = v + strings.TrimPrefix(newLine, "c")
+			}
+			buf.WriteString(indent + newLine)
+			return buf.String() + strings.Join(lines[i+1:], "")
+		}
+	}
+	if c.Lang == "php" {
+		// A key outside of its section is not read by the client library
+		if len(content) > 0 {
+			if !strings.HasSuffix(string(content), "\n") {
+				buf.WriteString(eol)
+			}
+			buf.WriteString(eol)
+		}
+		return buf.String() + "[" + iniSections[key] + "]" + eol + newLine
+	}
+	return newLine + string(content)
+}
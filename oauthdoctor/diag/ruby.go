@@ -0,0 +1,116 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diag
+
+// This file contains functions that are specific to the configuration file
+// (google_ads_config.rb) of the Ruby client library. The settings are the
+// assignments in the Google::Ads::GoogleAds::Config.new block, e.g.
+// c.client_id = '...', as well as c[:client_id] = '...' and the hash styles
+// client_id: '...' and :client_id => '...'.
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+)
+
+var (
+	// rubyKeyRe matches the key of an assignment or a hash pair and the
+	// separator. The name of the key is in one of the submatches.
+	rubyKeyRe = regexp.MustCompile(`^\s*(?:\w+\.(\w+)\s*=|\w+\[\s*(?::(\w+)|"(\w+)"|'(\w+)')\s*\]\s*=|(\w+):|:(\w+)\s*=>|"(\w+)"\s*=>|'(\w+)'\s*=>)[ \t]*`)
+	// rubyBlockRe matches the block variable of the Config.new block.
+	rubyBlockRe = regexp.MustCompile(`Config\.new\s+do\s*\|\s*(\w+)\s*\|`)
+)
+
+// parseRubyLine splits an assignment or a hash pair of a Ruby configuration
+// file. The key is returned as the key of an assignment to c, e.g.
+// c.client_id, regardless of the style. It returns false when the line is
+// not a setting, e.g. a comment.
+func parseRubyLine(line string) (valueLine, bool) {
+	var l valueLine
+
+	m := rubyKeyRe.FindStringSubmatch(line)
+	if m == nil {
+		return l, false
+	}
+	// A comparison is not an assignment
+	rest := line[len(m[0]):]
+	if len(rest) > 0 && rest[0] == '=' {
+		return l, false
+	}
+	for _, name := range m[1:] {
+		if name != "" {
+			l.key = "c." + name
+			break
+		}
+	}
+
+	l.prefix = m[0]
+	l.splitValue(rest, "#", ",")
+	return l, true
+}
+
+// rubyBlockVar returns the block variable of the Config.new block in the
+// line, or an empty string when the line does not open the block.
+func rubyBlockVar(line string) string {
+	if m := rubyBlockRe.FindStringSubmatch(line); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// isDigits returns true when s is a non-empty string of digits.
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// isNumber returns true when s is a decimal integer without a leading zero,
+// which can be written as a number. A value with a leading zero, e.g. a
+// customer ID, would be read as an octal or invalid number, so it is written
+// as a string.
+func isNumber(s string) bool {
+	return isDigits(s) && (s == "0" || s[0] != '0')
+}
+
+// ParseRubyFile reads the Ruby configuration file in filepath and returns a
+// ConfigFile.
+func ParseRubyFile(filepath string) (c ConfigFile, err error) {
+	keyValue := make(map[string]string)
+	c, _ = GetConfigFile("ruby", filepath)
+
+	f, err := os.Open(filepath)
+	if err != nil {
+		return c, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if l, ok := parseRubyLine(scanner.Text()); ok && l.value != "nil" {
+			keyValue[l.key] = l.value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return c, err
+	}
+
+	c.UpdateConfigKeys(keyValue)
+
+	return c, nil
+}
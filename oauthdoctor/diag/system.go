@@ -15,7 +15,6 @@ package diag
 
 import (
 	"fmt"
-	"log"
 	"net"
 	"os"
 	"runtime"
@@ -81,7 +80,7 @@ func ConnEndpoint() error {
 func PrintIPv4(host string) {
 	addrs, err := net.LookupIP(host)
 	if err != nil {
-		log.Printf("ERROR: PrintIPV4: %v\n", err)
+		Errorf("PrintIPV4: %v", err)
 	}
 
 	for _, addr := range addrs {
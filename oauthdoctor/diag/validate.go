@@ -0,0 +1,283 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diag
+
+// This file contains the checks of the individual values in the client
+// library configuration file, which can be run without any network calls.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/fatih/structs"
+)
+
+// FieldStatus is the result of checking a key in the configuration file.
+type FieldStatus struct {
+	// Key is the key name in ConfigKeys, e.g. DevToken.
+	Key string
+	// Field is the key name in the configuration file, e.g. developer_token.
+	Field string
+	// Problem describes why the value is invalid. It is empty when the
+	// value is valid.
+	Problem string
+}
+
+// OK returns true when the value is valid.
+func (s FieldStatus) OK() bool {
+	return s.Problem == ""
+}
+
+var devTokenRe = regexp.MustCompile("^[[:alnum:]_\\-]+$")
+
+// devTokenLength is the length of the developer tokens. It is only used to
+// warn, since the format of the developer tokens may change.
+const devTokenLength = 22
+
+// CheckFields checks that the values of the given keys are filled in and
+// well-formed. LoginCustomerID, LinkedCustomerID and UseProtoPlus are also
+// checked when they are set, since they are optional.
+func (c *ConfigFile) CheckFields(keys []string) []FieldStatus {
+	for _, k := range []string{LoginCustomerID, LinkedCustomerID, UseProtoPlus} {
+		if !Contains(keys, k) && c.value(k) != "" {
+			keys = append(keys, k)
+		}
+	}
+
+	var fields []FieldStatus
+	for _, k := range keys {
+		if k == UseProtoPlus && c.Lang != "python" {
+			continue
+		}
+		fields = append(fields, FieldStatus{
+			Key:     k,
+			Field:   c.GetConfigKeysInLang(k),
+			Problem: c.checkField(k),
+		})
+	}
+	return fields
+}
+
+// value returns the value of the key in ConfigKeys.
+func (c *ConfigFile) value(key string) string {
+	return structs.New(c.ConfigKeys).Field(key).Value().(string)
+}
+
+// checkField returns the problem with the value of the key, or an empty
+// string when the value is valid.
+func (c *ConfigFile) checkField(key string) string {
+	v := c.value(key)
+	if v == "" {
+		return "is empty"
+	}
+	if c.IsPlaceholder(v) {
+		return "is a placeholder value"
+	}
+	if strings.TrimSpace(v) != v ||
+		(key != JSONKeyFilePath && strings.ContainsAny(v, " \t")) {
+		return "contains whitespace"
+	}
+
+	switch key {
+	case DevToken:
+		if !devTokenRe.MatchString(v) {
+			return "can only contain letters, digits, underscores and dashes"
+		}
+	case ClientID:
+		if !strings.HasSuffix(v, "apps.googleusercontent.com") {
+			return "does not end with apps.googleusercontent.com"
+		}
+	case LoginCustomerID:
+		// Dashes are accepted like in --logincustomerid
+		if _, err := NormalizeCustomerID(v); err != nil {
+			return err.Error()
+		}
+	case LinkedCustomerID:
+		if strings.Contains(v, "-") {
+			return "cannot have dashes"
+		}
+		if _, err := NormalizeCustomerID(v); err != nil {
+			return err.Error()
+		}
+	case JSONKeyFilePath:
+		return checkJSONKeyFile(v)
+	case ImpersonatedEmail:
+		if !strings.Contains(v, "@") {
+			return "is not an email address"
+		}
+	case UseProtoPlus:
+		if !Contains([]string{"True", "False", "true", "false"}, v) {
+			return "must be True or False"
+		}
+	}
+	return ""
+}
+
+// checkJSONKeyFile returns the problem with the service account JSON key
+// file, or an empty string when it is valid.
+func checkJSONKeyFile(path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Sprintf("cannot be read: %s", err)
+	}
+	var key struct {
+		Type             string          `json:"type"`
+		ClientEmail      string          `json:"client_email"`
+		PrivateKey       string          `json:"private_key"`
+		Audience         string          `json:"audience"`
+		CredentialSource json.RawMessage `json:"credential_source"`
+	}
+	if err := json.Unmarshal(data, &key); err != nil {
+		return fmt.Sprintf("is not a JSON file: %s", err)
+	}
+	// An external account credential file of Workload Identity Federation
+	// can be used instead of a service account key
+	if key.Type == "external_account" {
+		if key.Audience == "" || len(key.CredentialSource) == 0 {
+			return "is an external account credential file without audience or credential_source"
+		}
+		return ""
+	}
+	if key.Type != "service_account" || key.ClientEmail == "" || key.PrivateKey == "" {
+		return "is not a service account JSON key file or an external account credential file"
+	}
+	return ""
+}
+
+// PrintFieldStatus prints a summary line with OK or the problem of each
+// field, and returns false when any of the fields has a problem.
+func PrintFieldStatus(fields []FieldStatus) bool {
+	ok := true
+	log.Println("Config validation summary:")
+	for _, f := range fields {
+		if f.OK() {
+			log.Printf("\tOK       %s (%s)\n", f.Key, f.Field)
+		} else {
+			ok = false
+			log.Printf("\tPROBLEM  %s (%s) %s\n", f.Key, f.Field, f.Problem)
+		}
+	}
+	return ok
+}
+
+// CheckDevTokenFormat returns why the developer token looks malformed, e.g.
+// truncated when it was copied, or an empty string when it looks
+// well-formed.
+func (c *ConfigFile) CheckDevTokenFormat() string {
+	if !devTokenRe.MatchString(c.DevToken) {
+		return "can only contain letters, digits, underscores and dashes"
+	}
+	if len(c.DevToken) != devTokenLength {
+		return fmt.Sprintf("is %d characters long instead of %d", len(c.DevToken), devTokenLength)
+	}
+	return ""
+}
+
+// FindUntrimmedValues returns the given keys whose values, as the client
+// library reads them, have leading or trailing whitespace or are wrapped in
+// quotes, mapped to the values without them. The lines of the configuration
+// file are checked instead of ConfigKeys, since the parsers of some
+// languages already drop the whitespace and the quotes that the client
+// library keeps. The values of a JSON file are parsed as they are.
+func (c *ConfigFile) FindUntrimmedValues(keys []string) map[string]string {
+	found := make(map[string]string)
+	raw := make(map[string]string)
+	if c.FromEnv || c.Filename == "" || c.Lang == "node" {
+		for _, k := range keys {
+			raw[k] = c.value(k)
+		}
+	} else {
+		content, err := ioutil.ReadFile(filepath.Join(c.Filepath, c.Filename))
+		if err != nil {
+			return found
+		}
+		raw = c.rawValues(keys, string(content))
+	}
+
+	for k, v := range raw {
+		if trimmed := trimValue(v); trimmed != v && trimmed != "" {
+			found[k] = trimmed
+		}
+	}
+	return found
+}
+
+// rawValues returns the first value of each of the given keys in content,
+// including the whitespace and the quotes that the client library reads as
+// part of the value.
+func (c *ConfigFile) rawValues(keys []string, content string) map[string]string {
+	values := make(map[string]string)
+	inComment := false
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		commented := false
+		if c.Lang == "dotnet" {
+			commented, inComment = xmlCommentState(line, inComment)
+		}
+		langKey, value, ok := c.rawValue(line)
+		if !ok || commented {
+			continue
+		}
+		for _, k := range keys {
+			if _, seen := values[k]; !seen && c.GetConfigKeysInLang(k) == langKey {
+				values[k] = value
+			}
+		}
+	}
+	return values
+}
+
+// rawValue returns the key and the value of a key-value pair line as the
+// client library reads it. It returns false when the line is not a key-value
+// pair.
+func (c *ConfigFile) rawValue(line string) (string, string, bool) {
+	switch c.Lang {
+	case "dotnet":
+		add := xmlAddRe.FindString(line)
+		k := xmlKeyRe.FindStringSubmatch(add)
+		v := xmlValueRe.FindStringSubmatch(add)
+		if k == nil || v == nil {
+			return "", "", false
+		}
+		return k[1] + k[2], v[1] + v[2], true
+	case "ruby":
+		l, ok := parseRubyLine(line)
+		return l.key, l.value, ok
+	}
+	lang := Languages[c.Lang]
+	l, ok := parseValueLine(line, lang.Separator, lang.CommentChar, inlineComments[c.Lang])
+	if c.Lang == "java" {
+		// A .properties file has no quoting, so the quotes and the trailing
+		// whitespace are part of the value
+		return l.key, l.quote + l.value + l.quote + l.suffix, ok
+	}
+	return l.key, l.value, ok
+}
+
+// trimValue removes the whitespace and the quotes around v, including the
+// whitespace inside the quotes and the nested quotes, e.g. "'abc '".
+func trimValue(v string) string {
+	for {
+		v = strings.TrimSpace(v)
+		if len(v) < 2 || (v[0] != '"' && v[0] != '\'') || v[len(v)-1] != v[0] {
+			return v
+		}
+		v = v[1 : len(v)-1]
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diag
+
+// This file contains functions that are specific to the App.config and
+// Web.config XML configuration files of the .NET client library. The
+// settings are read from the <GoogleAdsApi> section, either as
+// <add key="..." value="..."/> elements or as elements named after the keys,
+// e.g. <DeveloperToken>...</DeveloperToken>.
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// xmlSetting is a setting in the <GoogleAdsApi> section.
+type xmlSetting struct {
+	XMLName xml.Name
+	Key     string `xml:"key,attr"`
+	Value   string `xml:"value,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// dotNetXML is the structure of an App.config or Web.config file.
+type dotNetXML struct {
+	XMLName      xml.Name `xml:"configuration"`
+	GoogleAdsAPI struct {
+		Settings []xmlSetting `xml:",any"`
+	} `xml:"GoogleAdsApi"`
+}
+
+// ParseXMLFile parses the file content given in filepath and returns
+// a ConfigFile struct with the given attributes in the file.
+func ParseXMLFile(filepath string) (c ConfigFile, err error) {
+	var keyValue = make(map[string]string)
+	c, _ = GetConfigFile("dotnet", filepath)
+
+	f, err := os.Open(filepath)
+	if err != nil {
+		return c, err
+	}
+	defer f.Close()
+
+	inputBytes, _ := ioutil.ReadAll(f)
+	options := dotNetXML{}
+	err = xml.Unmarshal([]byte(inputBytes), &options)
+	if err != nil {
+		return c, err
+	}
+
+	for _, s := range options.GoogleAdsAPI.Settings {
+		if s.XMLName.Local == "add" {
+			keyValue[s.Key] = s.Value
+		} else {
+			keyValue[s.XMLName.Local] = strings.TrimSpace(s.Text)
+		}
+	}
+
+	c.UpdateConfigKeys(keyValue)
+
+	return c, nil
+}
+
+var (
+	// xmlAddRe matches an <add .../> element.
+	xmlAddRe = regexp.MustCompile(`<add\s[^>]*>`)
+	// xmlKeyRe and xmlValueRe match the key and the value attributes in
+	// either kind of quotes.
+	xmlKeyRe   = regexp.MustCompile(`\bkey\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	xmlValueRe = regexp.MustCompile(`\bvalue\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+)
+
+// xmlEscaper escapes a value in an XML attribute or element.
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;",
+	"\"", "&quot;", "'", "&apos;")
+
+// xmlCommentState returns whether the line starts in or with an XML comment,
+// and whether a comment is still open at the end of the line. inComment is
+// whether a comment is open at the end of the previous line.
+func xmlCommentState(line string, inComment bool) (bool, bool) {
+	commented := inComment || strings.HasPrefix(strings.TrimSpace(line), "<!--")
+	open, end := strings.LastIndex(line, "<!--"), strings.LastIndex(line, "-->")
+	switch {
+	case open > end:
+		inComment = true
+	case end >= 0:
+		inComment = false
+	}
+	return commented, inComment
+}
+
+// replaceXMLLine replaces the value of langKey in the line, which is either
+// in the value attribute of an <add/> element or in an element named
+// langKey. When value is empty, the element is commented out instead. It
+// returns false when the line has no setting of langKey.
+func replaceXMLLine(langKey, value, line string) (string, bool) {
+	start, end := -1, -1
+	if loc := xmlAddRe.FindStringIndex(line); loc != nil {
+		add := line[loc[0]:loc[1]]
+		if m := xmlKeyRe.FindStringSubmatch(add); m != nil && m[1]+m[2] == langKey {
+			if v := xmlValueRe.FindStringSubmatchIndex(add); v != nil {
+				// The submatch of the quote style that matched
+				start, end = v[2], v[3]
+				if start < 0 {
+					start, end = v[4], v[5]
+				}
+				start, end = start+loc[0], end+loc[0]
+			}
+		}
+	}
+	if start < 0 {
+		elemRe := regexp.MustCompile(`<` + regexp.QuoteMeta(langKey) + `>([^<]*)</` +
+			regexp.QuoteMeta(langKey) + `>`)
+		if m := elemRe.FindStringSubmatchIndex(line); m != nil {
+			start, end = m[2], m[3]
+		}
+	}
+	if start < 0 {
+		return line, false
+	}
+
+	if value == "" {
+		trimmed := strings.TrimLeft(line, " \t")
+		return line[:len(line)-len(trimmed)] + "<!-- " + trimmed + " -->", true
+	}
+	return line[:start] + xmlEscaper.Replace(value) + line[end:], true
+}
@@ -0,0 +1,27 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diag
+
+// This file contains functions that are specific to the YAML configuration
+// file (google-ads.yaml) of the Python client library. Only the flat
+// key-value pairs used by the client library are supported.
+
+// parseYAMLValue returns the value of a YAML key-value pair. The quotes
+// around the value and the trailing comment are removed.
+func parseYAMLValue(line string) string {
+	if l, ok := parseValueLine("key:"+line, ":", "#", "#"); ok {
+		return l.value
+	}
+	return ""
+}
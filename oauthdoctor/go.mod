@@ -4,5 +4,6 @@ go 1.11
 
 require (
 	github.com/fatih/structs v1.1.0
-	golang.org/x/oauth2 v0.0.0-20190319182350-c85d3e98c914
+	golang.org/x/net v0.0.0-20200822124328-c89045814202
+	golang.org/x/oauth2 v0.0.0-20210413134643-5e61552d6c78
 )
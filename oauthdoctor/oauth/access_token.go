@@ -0,0 +1,74 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains the diagnosis with an access token given directly, e.g.
+// from gcloud auth print-access-token, which skips the token exchange of the
+// OAuth flows.
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"oauthdoctor/diag"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// AccessTokenEnv is the environment variable of the access token, which
+// keeps the access token out of the shell history.
+const AccessTokenEnv = "GOOGLE_ADS_ACCESS_TOKEN"
+
+// minAccessTokenLen is the minimum length of an access token to be redacted,
+// as in diag.ConfigFile.Redact.
+const minAccessTokenLen = 4
+
+// simulateAccessTokenFlow gets the account info with the access token in
+// Config, and diagnoses the error if there's any. Only the developer token
+// and the customer IDs can be fixed, since an access token cannot be
+// refreshed.
+func (c *Config) simulateAccessTokenFlow(ctx context.Context) {
+	log.Print("Using the given access token. The OAuth2 token exchange is skipped.")
+	accountInfo, err := c.connectWithAccessToken(ctx)
+	accountInfo, err = c.fixAndRetry(ctx, accountInfo, err, func(error) (*bytes.Buffer, error) {
+		return c.connectWithAccessToken(ctx)
+	})
+
+	c.finish(accountInfo, err)
+}
+
+// connectWithAccessToken gets the account info with a client authorized by
+// the access token in Config.
+func (c *Config) connectWithAccessToken(ctx context.Context) (*bytes.Buffer, error) {
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: c.AccessToken, TokenType: "Bearer"})
+	return c.getAccount(ctx, oauth2.NewClient(c.oauth2Context(ctx), ts))
+}
+
+// redactAccessToken masks the access token in Config in s.
+func (c *Config) redactAccessToken(s string) string {
+	if len(c.AccessToken) < minAccessTokenLen {
+		return s
+	}
+	return strings.Replace(s, c.AccessToken, diag.Mask, -1)
+}
+
+// diagnoseAccessTokenExpired explains that the access token given directly
+// is rejected, which is most likely because it has expired.
+func (c *Config) diagnoseAccessTokenExpired() {
+	diag.Error("Your access token has expired or is invalid.")
+	log.Print("An access token is only valid for about an hour, and the " +
+		"doctor cannot refresh it. Please get a new access token, e.g. with " +
+		"`gcloud auth print-access-token`, and run the doctor again.")
+}
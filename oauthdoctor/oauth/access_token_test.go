@@ -0,0 +1,114 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"oauthdoctor/diag"
+)
+
+func TestSimulateAccessTokenFlow(t *testing.T) {
+	const accessToken = "ya29.GoodAccessToken"
+	tests := []struct {
+		desc   string
+		status int
+		body   string
+		want   Report
+	}{
+		{
+			desc:   "Valid access token",
+			status: http.StatusOK,
+			body:   `{"resourceName": "customers/1234567890"}`,
+			want: Report{Success: true, CustomerID: "1234567890", Account: &Account{ID: "1234567890"},
+				AccountType: ProductionAccountType},
+		},
+		{
+			desc:   "Expired access token",
+			status: http.StatusUnauthorized,
+			body: `{"error": {"code": 401, "message": "Request had invalid authentication credentials. ` +
+				`Expected OAuth 2 access token: ` + accessToken + `", "status": "UNAUTHENTICATED"}}`,
+			want: Report{
+				Error:       "AccessTokenExpired",
+				Code:        AccessTokenExpired,
+				Message:     "Request had invalid authentication credentials. Expected OAuth 2 access token: " + diag.Mask,
+				Remediation: remediations[AccessTokenExpired],
+				CustomerID:  "1234567890",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		var requests []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.URL.Path)
+			if got := r.Header.Get("Authorization"); got != "Bearer "+accessToken {
+				t.Errorf("%s: Authorization - got: %q, want the access token", test.desc, got)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(test.status)
+			fmt.Fprint(w, test.body)
+		}))
+
+		c := &Config{
+			AccessToken:    accessToken,
+			CustomerID:     "1234567890",
+			Endpoint:       server.URL,
+			HTTPClient:     server.Client(),
+			NonInteractive: true,
+			OAuthType:      InstalledApp,
+			reachable:      true,
+			ConfigFile: diag.ConfigFile{
+				Lang:       "python",
+				ConfigKeys: diag.ConfigKeys{DevToken: "GoodDevToken-012345678"},
+			},
+		}
+		got := c.SimulateOAuthFlow(context.Background())
+		server.Close()
+
+		if fmt.Sprintf("%+v", got) != fmt.Sprintf("%+v", test.want) ||
+			(got.Account == nil) != (test.want.Account == nil) {
+			t.Errorf("%s:\ngot:  %+v\nwant: %+v", test.desc, got, test.want)
+		}
+		// Only the Google Ads API is requested, without the token exchange
+		for _, path := range requests {
+			if strings.Contains(path, "token") {
+				t.Errorf("%s: unexpected token request %s", test.desc, path)
+			}
+		}
+	}
+}
+
+func TestDiagnoseAccessTokenExpiredNotRetried(t *testing.T) {
+	// The access token cannot be refreshed, so a retry sends it again
+	c := &Config{
+		AccessToken: "ya29.ExpiredAccessToken",
+		OAuthType:   InstalledApp,
+		Prompter:    &scriptedPrompter{},
+	}
+	err := errors.New(`{"error": {"code": 401, "message": "Request had invalid authentication credentials.", "status": "UNAUTHENTICATED",
+		"details": [{"reason": "ACCESS_TOKEN_EXPIRED"}]}}`)
+	if c.diagnose(context.Background(), err) {
+		t.Error("diagnose - got: true, want: false")
+	}
+	if c.report.Code != AccessTokenExpired {
+		t.Errorf("code - got: %s, want: AccessTokenExpired", c.report.Error)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains the diagnosis of the customer IDs of the accounts that
+// are not enabled, e.g. canceled or suspended, which are rejected regardless
+// of the credentials.
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+
+	"oauthdoctor/diag"
+)
+
+// accountStatusURL is the help page about the status of a Google Ads account.
+const accountStatusURL = "https://support.google.com/google-ads/answer/2375392"
+
+// accountStatus returns the status of the customer ID, e.g. SUSPENDED, in the
+// account hierarchy of the accessible manager accounts with the last
+// authorized client. The account itself cannot be queried while it is not
+// enabled. It returns false when the status cannot be found.
+func (c *Config) accountStatus(ctx context.Context) (string, bool) {
+	if c.client == nil {
+		return "", false
+	}
+	h := c.searchHierarchy(ctx, c.client, "customer_client.status")
+	if !h.found {
+		return "", false
+	}
+	var row struct {
+		CustomerClient struct {
+			Status string `json:"status"`
+		} `json:"customerClient"`
+	}
+	if err := json.Unmarshal(h.row, &row); err != nil || row.CustomerClient.Status == "" {
+		return "", false
+	}
+	return row.CustomerClient.Status, true
+}
+
+// diagnoseCustomerNotEnabled explains that the account of the customer ID is
+// not enabled, which is a problem with the state of the account and not with
+// the credentials. An account that did not finish signing up is told apart
+// by the error code, and a suspended or canceled account by its status in
+// the hierarchy of the accessible manager accounts.
+func (c *Config) diagnoseCustomerNotEnabled(ctx context.Context, errorCode string) {
+	diag.Error("The account " + c.CustomerID + " is not enabled, so it " +
+		"cannot be accessed. This is a problem with the state of the account, " +
+		"not with your credentials, so the configuration file does not need " +
+		"to be changed.")
+
+	if strings.HasSuffix(errorCode, "INCOMPLETE_SIGNUP") {
+		log.Print("The sign-up of the account is not complete. Please sign in " +
+			"to the Google Ads UI (https://ads.google.com) with the login email " +
+			"and finish setting up the account, e.g. the billing information.")
+		c.report.Remediation = "Finish the sign-up of the account in the Google Ads UI."
+		return
+	}
+
+	status, ok := c.accountStatus(ctx)
+	switch {
+	case !ok:
+		log.Print("The account may be canceled, suspended, or not set up " +
+			"yet. Please check the status of the account in the Google Ads UI: " +
+			accountStatusURL)
+	case status == "SUSPENDED":
+		log.Print("The account is suspended, e.g. for a policy violation or " +
+			"an unpaid balance. Please check the notifications in the Google Ads " +
+			"UI, or contact the Google Ads support: " + accountStatusURL)
+		c.report.Remediation = "The account is suspended. Resolve the suspension in the Google Ads UI."
+	case status == "CANCELED" || status == "CLOSED":
+		log.Printf("The account is %s. Please reactivate it in the Google Ads "+
+			"UI, or use another customer ID: %s", strings.ToLower(status), accountStatusURL)
+		c.report.Remediation = "The account is " + strings.ToLower(status) +
+			". Reactivate it in the Google Ads UI, or use another customer ID."
+	default:
+		log.Printf("The status of the account is %s. Please check it in the "+
+			"Google Ads UI: %s", status, accountStatusURL)
+	}
+	c.suggestCustomerIDs(ctx)
+}
@@ -0,0 +1,146 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains the auto mode, which tries the OAuth types that the
+// configuration file applies to instead of a given one.
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"oauthdoctor/diag"
+)
+
+// FlowResult is the result of an OAuth type tried in the auto mode.
+type FlowResult struct {
+	OAuthType   string `json:"oauthType"`
+	Success     bool   `json:"success"`
+	Error       string `json:"error,omitempty"`
+	Code        int32  `json:"code"`
+	Remediation string `json:"remediation,omitempty"`
+}
+
+// autoFlows returns the OAuth types that the configuration file applies to:
+// the installed app flow, which refreshes the refresh token first, when it
+// has a client ID and secret, the service account flow when it has a JSON
+// key file, and the web flow, which needs a browser, last. The web flow is
+// skipped in non-interactive mode.
+func (c *Config) autoFlows() []string {
+	var flows []string
+	client := len(c.ConfigFile.FindPlaceholders([]string{diag.ClientID, diag.ClientSecret})) == 0
+	if client {
+		flows = append(flows, InstalledApp)
+	}
+	if len(c.ConfigFile.FindPlaceholders([]string{diag.JSONKeyFilePath})) == 0 {
+		flows = append(flows, ServiceAccount)
+	}
+	if client && !c.NonInteractive {
+		flows = append(flows, Web)
+	} else if client {
+		log.Print("The web flow is skipped in non-interactive mode, since it " +
+			"requires signing in with a browser.")
+	}
+	return flows
+}
+
+// AutoFlowKeys returns the keys in the configuration file that the client
+// library uses for the OAuth types that the auto mode tries with it. The keys
+// of the installed app flow are returned when no OAuth type applies.
+func AutoFlowKeys(cf diag.ConfigFile) []string {
+	c := &Config{ConfigFile: cf}
+	flows := c.autoFlows()
+	if len(flows) == 0 {
+		return FlowKeys(InstalledApp)
+	}
+	var keys []string
+	seen := make(map[string]bool)
+	for _, flow := range flows {
+		for _, key := range FlowKeys(flow) {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// simulateAutoFlows simulates each of the autoFlows in turn, and stops at the
+// first one that succeeds unless AllFlows is set. The results of the flows
+// are recorded in the Flows of the report, whose verdict is the one of the
+// first successful flow, or else of the first flow. The warnings of all the
+// flows are kept in the report.
+func (c *Config) simulateAutoFlows(ctx context.Context) {
+	flows := c.autoFlows()
+	if len(flows) == 0 {
+		msg := "The configuration file has neither a client ID and client " +
+			"secret nor a service account JSON key file, so no OAuth flow applies."
+		diag.Error(msg)
+		c.fail(UnfilledConfigValue, msg, []string{diag.ClientID, diag.ClientSecret, diag.JSONKeyFilePath})
+		log.Print("Recommended action: " + remediations[UnfilledConfigValue])
+		return
+	}
+	log.Printf("Trying the OAuth flows that apply to the configuration file: %s",
+		strings.Join(flows, ", "))
+
+	var verdict *Report
+	var results []FlowResult
+	var warnings []string
+	for _, flow := range flows {
+		if ctx.Err() != nil {
+			break
+		}
+		log.Printf("Trying the %s flow...", flow)
+		c.OAuthType = flow
+		c.report = Report{CustomerID: c.CustomerID}
+		c.simulateFlow(ctx)
+
+		r := c.report
+		for _, w := range r.Warnings {
+			if !diag.Contains(warnings, w) {
+				warnings = append(warnings, w)
+			}
+		}
+		results = append(results, FlowResult{OAuthType: flow, Success: r.Success,
+			Error: r.Error, Code: r.Code, Remediation: r.Remediation})
+		if verdict == nil || (r.Success && !verdict.Success) {
+			verdict = &r
+		}
+		if r.Success && !c.AllFlows {
+			break
+		}
+	}
+	c.OAuthType = Auto
+
+	if verdict != nil {
+		c.report = *verdict
+	}
+	c.report.Flows = results
+	c.report.Warnings = warnings
+	printFlowResults(results)
+}
+
+// printFlowResults prints whether each of the tried OAuth types succeeded.
+func printFlowResults(results []FlowResult) {
+	log.Print("OAuth flows tried:")
+	for _, r := range results {
+		if r.Success {
+			log.Printf("\t%s\tPASS", r.OAuthType)
+		} else {
+			log.Printf("\t%s\tFAIL %s: %s", r.OAuthType, r.Error, r.Remediation)
+		}
+	}
+}
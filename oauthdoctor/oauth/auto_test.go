@@ -0,0 +1,152 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"oauthdoctor/diag"
+)
+
+func TestSimulateAutoFlows(t *testing.T) {
+	tests := []struct {
+		desc      string
+		keys      diag.ConfigKeys
+		allFlows  bool
+		want      int32
+		wantFlows string
+	}{
+		{
+			desc: "Stops at the first successful flow",
+			keys: diag.ConfigKeys{ClientID: "ClientID.apps.googleusercontent.com", ClientSecret: "ClientSecret",
+				RefreshToken: "GoodRefreshToken", JSONKeyFilePath: "/nonexistent/key.json"},
+			want:      0,
+			wantFlows: "[installed_app:true]",
+		},
+		{
+			desc: "Tries all the flows with AllFlows",
+			keys: diag.ConfigKeys{ClientID: "ClientID.apps.googleusercontent.com", ClientSecret: "ClientSecret",
+				RefreshToken: "GoodRefreshToken", JSONKeyFilePath: "/nonexistent/key.json"},
+			allFlows:  true,
+			want:      0,
+			wantFlows: "[installed_app:true service_account:false]",
+		},
+		{
+			desc: "Verdict of the first flow when all fail",
+			keys: diag.ConfigKeys{ClientID: "ClientID.apps.googleusercontent.com", ClientSecret: "ClientSecret",
+				RefreshToken: "BadRefreshToken", JSONKeyFilePath: "/nonexistent/key.json"},
+			want:      InvalidRefreshToken,
+			wantFlows: "[installed_app:false service_account:false]",
+		},
+		{
+			desc:      "No flow applies",
+			keys:      diag.ConfigKeys{RefreshToken: "GoodRefreshToken"},
+			want:      UnfilledConfigValue,
+			wantFlows: "[]",
+		},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/token" {
+			fmt.Fprint(w, `{"resourceName": "customers/1234567890"}`)
+			return
+		}
+		if r.FormValue("refresh_token") != "GoodRefreshToken" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error": "invalid_grant", "error_description": "Bad Request"}`)
+			return
+		}
+		fmt.Fprint(w, `{"access_token": "AccessToken", "token_type": "Bearer", "expires_in": 3600}`)
+	}))
+	defer server.Close()
+
+	for _, test := range tests {
+		keys := test.keys
+		keys.DevToken = "GoodDevToken"
+		keys.ImpersonatedEmail = "user@example.com"
+		c := &Config{
+			AllFlows:       test.allFlows,
+			CustomerID:     "1234567890",
+			Endpoint:       server.URL,
+			HTTPClient:     server.Client(),
+			NonInteractive: true,
+			OAuthType:      Auto,
+			TokenEndpoint:  server.URL + "/token",
+			reachable:      true,
+			ConfigFile:     diag.ConfigFile{Lang: "python", ConfigKeys: keys},
+		}
+		r := c.SimulateOAuthFlow(context.Background())
+
+		if r.Code != test.want || r.Success != (test.want == 0) {
+			t.Errorf("%s: verdict - got: %t %s, want: %s", test.desc, r.Success, r.Error, errorNames[test.want])
+		}
+		var flows []string
+		for _, f := range r.Flows {
+			flows = append(flows, fmt.Sprintf("%s:%t", f.OAuthType, f.Success))
+		}
+		if fmt.Sprint(flows) != test.wantFlows {
+			t.Errorf("%s: flows - got: %v, want: %s", test.desc, flows, test.wantFlows)
+		}
+		// The malformed developer token is warned about once, not per flow
+		if len(flows) > 0 && len(r.Warnings) != 1 {
+			t.Errorf("%s: warnings - got: %q, want one", test.desc, r.Warnings)
+		}
+		if c.OAuthType != Auto {
+			t.Errorf("%s: OAuth type - got: %s, want: %s", test.desc, c.OAuthType, Auto)
+		}
+	}
+}
+
+func TestAutoFlowKeys(t *testing.T) {
+	tests := []struct {
+		desc string
+		keys diag.ConfigKeys
+		want []string
+	}{
+		{
+			desc: "Service account only",
+			keys: diag.ConfigKeys{DevToken: "GoodDevToken", JSONKeyFilePath: "/tmp/key.json"},
+			want: []string{diag.DevToken, diag.JSONKeyFilePath, diag.ImpersonatedEmail},
+		},
+		{
+			desc: "Client ID and secret only",
+			keys: diag.ConfigKeys{DevToken: "GoodDevToken", ClientID: "GoodClientID", ClientSecret: "GoodClientSecret"},
+			want: []string{diag.DevToken, diag.ClientID, diag.ClientSecret, diag.RefreshToken},
+		},
+		{
+			desc: "Both",
+			keys: diag.ConfigKeys{DevToken: "GoodDevToken", ClientID: "GoodClientID",
+				ClientSecret: "GoodClientSecret", JSONKeyFilePath: "/tmp/key.json"},
+			want: []string{diag.DevToken, diag.ClientID, diag.ClientSecret, diag.RefreshToken,
+				diag.JSONKeyFilePath, diag.ImpersonatedEmail},
+		},
+		{
+			desc: "Neither",
+			keys: diag.ConfigKeys{DevToken: "GoodDevToken"},
+			want: []string{diag.DevToken, diag.ClientID, diag.ClientSecret, diag.RefreshToken},
+		},
+	}
+
+	for _, test := range tests {
+		got := AutoFlowKeys(diag.ConfigFile{Lang: "python", ConfigKeys: test.keys})
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%s: got: %v, want: %v", test.desc, got, test.want)
+		}
+	}
+}
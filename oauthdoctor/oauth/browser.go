@@ -0,0 +1,77 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"log"
+	"oauthdoctor/diag"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// BrowserSupported returns true when a browser can be opened for the auth
+// dialog, i.e. the session is interactive and has a display. Servers and
+// containers have neither a terminal on stdin nor, on Linux and the BSDs, an
+// X11 or Wayland display.
+func BrowserSupported() bool {
+	if !diag.IsTerminal(os.Stdin) {
+		return false
+	}
+	switch runtime.GOOS {
+	case "darwin", "windows":
+		return true
+	}
+	return os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+}
+
+// openBrowser opens the URL with the default browser of the operating
+// system.
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
+
+// printAuthURL prints the URL of the auth dialog between separator lines, so
+// that it stands out in the log output when it must be opened manually.
+func printAuthURL(url string) {
+	line := strings.Repeat("=", 72)
+	log.Printf("Open this URL in a browser to continue with the auth dialog:\n%s\n%s\n%s\n", line, url, line)
+}
+
+// launchBrowser opens the URL of the auth dialog with the default browser
+// when OpenBrowser is set. It prints the URL instead and returns false when
+// the browser is not opened.
+func (c *Config) launchBrowser(url string) bool {
+	if c.OpenBrowser {
+		err := openBrowser(url)
+		if err == nil {
+			log.Printf("Your browser is opened to visit the URL for the auth dialog:\n%s\n", url)
+			return true
+		}
+		log.Printf("Cannot open a browser: %s", err)
+	}
+	printAuthURL(url)
+	return false
+}
@@ -0,0 +1,37 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"os"
+	"testing"
+
+	"oauthdoctor/diag"
+)
+
+func TestLaunchBrowserDisabled(t *testing.T) {
+	c := &Config{OpenBrowser: false}
+	if c.launchBrowser("https://accounts.google.com/o/oauth2/auth") {
+		t.Error("launchBrowser - got: true, want: false when OpenBrowser is not set")
+	}
+}
+
+func TestBrowserSupportedWithoutTerminal(t *testing.T) {
+	if diag.IsTerminal(os.Stdin) {
+		t.Skip("stdin is a terminal")
+	}
+	if BrowserSupported() {
+		t.Error("BrowserSupported - got: true, want: false when stdin is not a terminal")
+	}
+}
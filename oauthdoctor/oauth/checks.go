@@ -0,0 +1,105 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains the named checks of a diagnosis, which Checks in Config
+// limits to the ones that are run.
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"oauthdoctor/diag"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// The names of the checks in Config.Checks.
+const (
+	// ConfigCheck checks that the values in the configuration file are
+	// filled in, and warns about the ones that look malformed.
+	ConfigCheck = "config"
+	// ConnectivityCheck checks that the Google endpoints can be reached.
+	ConnectivityCheck = "connectivity"
+	// TokenCheck exchanges the credentials for an access token.
+	TokenCheck = "token"
+	// AccountCheck requests the account of the customer ID from the Google
+	// Ads API. The credentials are exchanged for an access token too, since
+	// the request requires one.
+	AccountCheck = "account"
+)
+
+// CheckNames are the names of the checks in the order they are run.
+var CheckNames = []string{ConfigCheck, ConnectivityCheck, TokenCheck, AccountCheck}
+
+// ParseChecks parses the comma separated names of checks, e.g. "config,token".
+// It returns an error that lists the valid names when a name is unknown.
+func ParseChecks(s string) ([]string, error) {
+	var checks []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !diag.Contains(CheckNames, name) {
+			return nil, fmt.Errorf("unknown check %q (valid checks: %s)",
+				name, strings.Join(CheckNames, ", "))
+		}
+		if !diag.Contains(checks, name) {
+			checks = append(checks, name)
+		}
+	}
+	if len(checks) == 0 {
+		return nil, fmt.Errorf("no check given (valid checks: %s)", strings.Join(CheckNames, ", "))
+	}
+	return checks, nil
+}
+
+// runs returns true when the check is run. All the checks are run when
+// Checks is empty.
+func (c *Config) runs(check string) bool {
+	return len(c.Checks) == 0 || diag.Contains(c.Checks, check)
+}
+
+// runsFlow returns true when the OAuth flow is simulated, which is needed by
+// the token and the account checks.
+func (c *Config) runsFlow() bool {
+	return c.runs(TokenCheck) || c.runs(AccountCheck)
+}
+
+// passChecks records the success of the checks that were run without the
+// OAuth flow.
+func (c *Config) passChecks() {
+	log.Printf("SUCCESS: The %s checks passed. The other checks were skipped.",
+		strings.Join(c.Checks, ", "))
+	c.report.Success = true
+}
+
+// skipAccountCheck returns an empty account info without the Google Ads API
+// request when the account check is not run. The access token of client is
+// still obtained for the token check.
+func (c *Config) skipAccountCheck(client *http.Client) (*bytes.Buffer, bool, error) {
+	if c.runs(AccountCheck) {
+		return nil, false, nil
+	}
+	log.Print("Skipping the Google Ads API request, since the account check is not run.")
+	if t, ok := client.Transport.(*oauth2.Transport); ok {
+		if _, err := t.Source.Token(); err != nil {
+			return nil, true, err
+		}
+	}
+	return &bytes.Buffer{}, true, nil
+}
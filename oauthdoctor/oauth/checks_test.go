@@ -0,0 +1,127 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"oauthdoctor/diag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseChecks(t *testing.T) {
+	tests := []struct {
+		checks  string
+		want    []string
+		wantErr bool
+	}{
+		{checks: "token", want: []string{TokenCheck}},
+		{checks: "config, Connectivity,config", want: []string{ConfigCheck, ConnectivityCheck}},
+		{checks: "account,token", want: []string{AccountCheck, TokenCheck}},
+		{checks: "dns", wantErr: true},
+		{checks: ",", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseChecks(test.checks)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseChecks(%q) error - got: %v, want error: %t", test.checks, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			// The error lists the valid checks
+			if !strings.Contains(err.Error(), strings.Join(CheckNames, ", ")) {
+				t.Errorf("ParseChecks(%q) error - got: %s, want the valid checks", test.checks, err)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseChecks(%q) - got: %v, want: %v", test.checks, got, test.want)
+		}
+	}
+}
+
+// hostTransport sends all the requests to the server at host, e.g. the
+// connectivity checks of the overridden endpoints.
+type hostTransport struct {
+	host string
+}
+
+func (t *hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme, req.URL.Host = "http", t.host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestSimulateOAuthFlowChecks(t *testing.T) {
+	tests := []struct {
+		desc         string
+		checks       []string
+		wantSuccess  bool
+		wantHeads    int
+		wantTokens   int
+		wantAccounts int
+	}{
+		{desc: "All checks", wantSuccess: true, wantHeads: 2, wantTokens: 1, wantAccounts: 1},
+		{desc: "Config only", checks: []string{ConfigCheck}, wantSuccess: true},
+		{desc: "Connectivity only", checks: []string{ConnectivityCheck}, wantSuccess: true, wantHeads: 2},
+		{desc: "Token only", checks: []string{TokenCheck}, wantSuccess: true, wantTokens: 1},
+		{desc: "Account only", checks: []string{AccountCheck}, wantSuccess: true, wantTokens: 1, wantAccounts: 1},
+	}
+
+	for _, test := range tests {
+		var heads, tokens, accounts int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch {
+			case r.Method == "HEAD":
+				heads++
+			case r.URL.Path == "/token":
+				tokens++
+				fmt.Fprint(w, `{"access_token": "AccessToken", "token_type": "Bearer", "expires_in": 3600}`)
+			default:
+				accounts++
+				fmt.Fprint(w, `{"resourceName": "customers/1234567890"}`)
+			}
+		}))
+
+		c := &Config{
+			Checks:         test.checks,
+			CustomerID:     "1234567890",
+			Endpoint:       server.URL,
+			HTTPClient:     &http.Client{Transport: &hostTransport{host: strings.TrimPrefix(server.URL, "http://")}},
+			NonInteractive: true,
+			OAuthType:      InstalledApp,
+			TokenEndpoint:  server.URL + "/token",
+			ConfigFile: diag.ConfigFile{
+				Lang: "python",
+				ConfigKeys: diag.ConfigKeys{DevToken: "ABCDEFGHIJKLMNOPQRSTUV", ClientID: "GoodClientID",
+					ClientSecret: "GoodClientSecret", RefreshToken: "GoodRefreshToken"},
+			},
+		}
+		got := c.SimulateOAuthFlow(context.Background())
+		server.Close()
+
+		if got.Success != test.wantSuccess {
+			t.Errorf("%s: success - got: %t, want: %t (%s)", test.desc, got.Success, test.wantSuccess, got.Message)
+		}
+		if heads != test.wantHeads || tokens != test.wantTokens || accounts != test.wantAccounts {
+			t.Errorf("%s: requests - got: %d HEAD, %d token, %d account, want: %d, %d, %d", test.desc,
+				heads, tokens, accounts, test.wantHeads, test.wantTokens, test.wantAccounts)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains the check of the system clock, whose skew makes the
+// token endpoint reject the JWTs and the tokens as if they were invalid.
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"oauthdoctor/diag"
+)
+
+// maxClockSkew is the skew of the system clock from the clock of the token
+// endpoint above which the JWT and token errors are attributed to the clock.
+// The Date header has a resolution of a second, so a smaller skew cannot be
+// measured reliably anyway.
+const maxClockSkew = time.Minute
+
+// clockErrors are the errors of the token endpoint that a skewed clock
+// causes, e.g. a JWT of a service account whose iat is in the future.
+var clockErrors = []string{
+	"Invalid JWT",
+	"Token used too early",
+	"Token used too late",
+}
+
+// clockSkew measures the skew of the system clock when err is one of the
+// clockErrors. It returns false when err is another error, when the skew
+// cannot be measured, or when it is below maxClockSkew.
+func (c *Config) clockSkew(ctx context.Context, err error) (time.Duration, bool) {
+	if !containsAny(err.Error(), clockErrors...) {
+		return 0, false
+	}
+	skew, mErr := c.measureClockSkew(ctx)
+	if mErr != nil {
+		log.Printf("Cannot check the system clock: %s", c.redact(mErr.Error()))
+		return 0, false
+	}
+	if skew > -maxClockSkew && skew < maxClockSkew {
+		log.Printf("The system clock is in sync with the token endpoint (skew: %s).", skew)
+		return skew, false
+	}
+	return skew, true
+}
+
+// measureClockSkew compares the system clock with the Date header of the
+// response of the token endpoint. The skew is positive when the system clock
+// is ahead. The header is compared with the middle of the request, and the
+// half second lost by its resolution is added back.
+func (c *Config) measureClockSkew(ctx context.Context) (time.Duration, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	req, err := http.NewRequest("HEAD", c.tokenURL(), nil)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	resp, err := c.httpClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	end := time.Now()
+
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, fmt.Errorf("the response of the token endpoint has no valid Date header: %q", resp.Header.Get("Date"))
+	}
+	local := start.Add(end.Sub(start) / 2)
+	return local.Sub(date.Add(500 * time.Millisecond)).Round(time.Second), nil
+}
+
+// diagnoseClockSkew explains that the token endpoint rejected the request
+// because the system clock is off by skew, not because of the credentials.
+func (c *Config) diagnoseClockSkew(skew time.Duration) {
+	direction := "ahead of"
+	if skew < 0 {
+		direction, skew = "behind", -skew
+	}
+	diag.Errorf("The system clock is %s %s the clock of the token endpoint. "+
+		"The token endpoint rejects the JWTs and the tokens issued for a "+
+		"skewed clock as invalid, so your credentials are most likely fine.",
+		skew, direction)
+	log.Print("Please synchronize the system clock, e.g. enable NTP or the " +
+		"automatic date and time setting, and run the doctor again. Do not " +
+		"regenerate your credentials for this error.")
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const jwtError = `oauth2: cannot fetch token: 400 Bad Request Response: {"error": "invalid_grant", "error_description": "Invalid JWT: Token must be a short-lived token (60 minutes) and in a reasonable timeframe. Check your iat and exp values in the JWT claim."}`
+
+func TestDiagnoseClockSkew(t *testing.T) {
+	tests := []struct {
+		desc     string
+		offset   time.Duration
+		noDate   bool
+		err      string
+		want     int32
+		wantSkew string
+	}{
+		{
+			desc:     "System clock behind the token endpoint",
+			offset:   10 * time.Minute,
+			err:      jwtError,
+			want:     ClockSkew,
+			wantSkew: "-",
+		},
+		{
+			desc:     "System clock ahead of the token endpoint",
+			offset:   -2 * time.Hour,
+			err:      jwtError,
+			want:     ClockSkew,
+			wantSkew: "2h",
+		},
+		{
+			desc: "System clock in sync",
+			err:  jwtError,
+			want: InvalidRefreshToken,
+		},
+		{
+			desc:   "Skew cannot be measured without a Date header",
+			noDate: true,
+			err:    jwtError,
+			want:   InvalidRefreshToken,
+		},
+		{
+			desc:   "Skew is not checked for other errors",
+			offset: 10 * time.Minute,
+			err:    `oauth2: cannot fetch token: 400 Bad Request Response: {"error": "invalid_grant", "error_description": "Bad Request"}`,
+			want:   InvalidRefreshToken,
+		},
+	}
+
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if test.noDate {
+				w.Header()["Date"] = nil
+			} else {
+				w.Header().Set("Date", time.Now().Add(test.offset).UTC().Format(http.TimeFormat))
+			}
+		}))
+		c := &Config{
+			HTTPClient:     server.Client(),
+			NonInteractive: true,
+			TokenEndpoint:  server.URL + "/token",
+		}
+		c.diagnose(context.Background(), errors.New(test.err))
+		server.Close()
+
+		if c.report.Code != test.want {
+			t.Errorf("%s: code - got: %s, want: %s", test.desc, c.report.Error, errorNames[test.want])
+		}
+		if !strings.HasPrefix(c.report.ClockSkew, test.wantSkew) || (test.wantSkew == "") != (c.report.ClockSkew == "") {
+			t.Errorf("%s: clock skew - got: %q, want prefix: %q", test.desc, c.report.ClockSkew, test.wantSkew)
+		}
+	}
+}
+
+func TestDiagnoseClockSkewNotRetried(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	}))
+	defer server.Close()
+
+	// A retry fails again until the clock is synchronized
+	c := &Config{
+		HTTPClient:    server.Client(),
+		Prompter:      &scriptedPrompter{},
+		TokenEndpoint: server.URL + "/token",
+	}
+	if c.diagnose(context.Background(), errors.New(jwtError)) {
+		t.Error("diagnose - got: true, want: false")
+	}
+	if c.report.Code != ClockSkew {
+		t.Errorf("code - got: %s, want: ClockSkew", c.report.Error)
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains the guidance about the Google Cloud project of the
+// OAuth client ID.
+
+import (
+	"context"
+	"log"
+	"oauthdoctor/diag"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// apiEnableCheckDelay is the delay between the checks whether the Google
+// Ads API is enabled, since enabling it takes effect after a while.
+var apiEnableCheckDelay = 10 * time.Second
+
+// errorProjectRe matches the project number in the error message of a
+// disabled API, e.g. "Google Ads API has not been used in project 123 before
+// or it is disabled."
+var errorProjectRe = regexp.MustCompile(`project (\d+)`)
+
+// clientIDRe matches an OAuth client ID, which starts with the number of
+// its Google Cloud project, e.g. 123456789012-abc.apps.googleusercontent.com.
+var clientIDRe = regexp.MustCompile(`^(\d+)-[[:alnum:]]+\.apps\.googleusercontent\.com$`)
+
+// ProjectNumber returns the number of the Google Cloud project that the OAuth
+// client ID belongs to. It returns false when the client ID is not in the
+// format of an OAuth client ID.
+func ProjectNumber(clientID string) (string, bool) {
+	m := clientIDRe.FindStringSubmatch(clientID)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// clientProject returns the project number of the client ID, and warns that
+// the client ID looks malformed when it has none.
+func (c *Config) clientProject() string {
+	project, ok := ProjectNumber(c.ConfigFile.ClientID)
+	if !ok {
+		c.warnf("Your client ID %q is not in the format of an OAuth client "+
+			"ID, <project number>-<id>.apps.googleusercontent.com. It may be "+
+			"malformed, truncated or copied with extra characters.",
+			c.ConfigFile.ClientID)
+	}
+	return project
+}
+
+// cloudProject returns the number of the Google Cloud project in the error
+// message, or else the one of the client ID. It returns an empty string when
+// neither has a project number.
+func (c *Config) cloudProject(msg string) string {
+	if m := errorProjectRe.FindStringSubmatch(msg); m != nil {
+		return m[1]
+	}
+	return c.clientProject()
+}
+
+// credentialsURL returns the Google Cloud console page of the OAuth client
+// IDs in the project.
+func credentialsURL(project string) string {
+	return "https://console.cloud.google.com/apis/credentials?project=" + project
+}
+
+// diagnoseClientMismatch explains that the refresh token was not generated
+// with the client ID and secret in the configuration file and offers to
+// regenerate it with them. It returns false when the user declines.
+func (c *Config) diagnoseClientMismatch() bool {
+	diag.Error("Your refresh token was not generated with the client ID and " +
+		"secret in your configuration file. They have to come from the same " +
+		"OAuth client, so do not replace the client ID and secret to fix this.")
+	if project := c.clientProject(); project != "" {
+		log.Printf("Your client ID belongs to the Google Cloud project %s. "+
+			"Generate the refresh token with this client.", project)
+	}
+	c.printRefreshTokenGuide()
+
+	if c.NonInteractive || c.OAuthType != InstalledApp {
+		return true
+	}
+	if c.confirm("Would you like to run the installed app flow now to "+
+		"generate a new refresh token with your client ID?", true) {
+		return true
+	}
+	log.Print("The installed app flow is NOT run")
+	return false
+}
+
+// diagnoseClientID points at the Google Cloud project of the client ID, in
+// which the client ID and secret can be checked.
+func (c *Config) diagnoseClientID() {
+	project := c.clientProject()
+	if project == "" {
+		return
+	}
+	log.Printf("Your client ID belongs to the Google Cloud project %s. Check "+
+		"that the OAuth client ID exists there and copy its client ID and "+
+		"secret: %s", project, credentialsURL(project))
+}
+
+// diagnoseRedirectURI explains that the redirect URL of the auth request is
+// not one of the Authorized redirect URIs of the OAuth client ID, and prints
+// the exact URL that the doctor sent, which has to match a registered one.
+func (c *Config) diagnoseRedirectURI() {
+	redirectURL := c.redirectURL
+	if redirectURL == "" {
+		redirectURL = c.webRedirectURL()
+	}
+	diag.Errorf("The redirect URL %s is not one of the Authorized redirect "+
+		"URIs of your OAuth 2.0 client ID.", redirectURL)
+	if c.OAuthType == InstalledApp {
+		log.Print("The installed app flow redirects to a loopback URL, which " +
+			"only a client ID of the Desktop app type accepts. Please use a " +
+			"Desktop app client ID, or run the web flow with --oauthtype web " +
+			"for a Web application client ID.")
+	} else {
+		log.Print("The registered URI must match exactly, including the " +
+			"scheme, the host, the port, the path and the trailing slash. " +
+			"Add the URL above to the Authorized redirect URIs of your client " +
+			"ID, or run the doctor with --redirecturl set to one of them.")
+	}
+	if project := c.clientProject(); project != "" {
+		log.Printf("Your client ID belongs to the Google Cloud project %s: %s",
+			project, credentialsURL(project))
+	}
+}
+
+// rejectedClientKeys returns the keys of the client ID and secret that the
+// token endpoint rejected in errstr. The endpoint returns "The OAuth client
+// was not found." for an unknown client ID, and "Unauthorized" for a client
+// secret that does not match a known client ID. Both keys are returned when
+// the error does not tell them apart.
+func rejectedClientKeys(errstr string) []string {
+	switch {
+	case strings.Contains(errstr, "client was not found"):
+		return []string{diag.ClientID}
+	case strings.Contains(errstr, `"Unauthorized"`):
+		return []string{diag.ClientSecret}
+	default:
+		return []string{diag.ClientID, diag.ClientSecret}
+	}
+}
+
+// clientRemediation returns the recommended action of InvalidClientInfo for
+// the rejected keys of the client ID and secret.
+func clientRemediation(keys []string) string {
+	if len(keys) != 1 {
+		return remediations[InvalidClientInfo]
+	}
+	if keys[0] == diag.ClientSecret {
+		return "Replace the client secret in the configuration file. The client ID is valid."
+	}
+	return "Replace the client ID in the configuration file with an OAuth client ID that exists in your Google Cloud project."
+}
+
+// apiEnableURL returns the Google Cloud console page that enables the Google
+// Ads API in the project. The project is selected in the console when it is
+// empty.
+func apiEnableURL(project string) string {
+	url := "https://console.cloud.google.com/apis/library/googleads.googleapis.com"
+	if project != "" {
+		url += "?project=" + project
+	}
+	return url
+}
+
+// diagnoseAPIDisabled guides the user to enable the Google Ads API in the
+// Google Cloud project, and then checks the account info again until the API
+// is enabled or the user aborts. The check is skipped in non-interactive
+// mode.
+func (c *Config) diagnoseAPIDisabled(ctx context.Context, msg string) {
+	project := c.cloudProject(msg)
+	if project != "" {
+		log.Printf("Please enable the Google Ads API in the Google Cloud "+
+			"project %s: %s", project, apiEnableURL(project))
+	} else {
+		log.Print("Please enable the Google Ads API in the Google Cloud project " +
+			"of your client ID: " + apiEnableURL(""))
+	}
+	if c.NonInteractive || c.client == nil {
+		return
+	}
+
+	c.pause("Press <Enter> to continue after you enable Google Ads API")
+	if c.waitForAPIEnabled(ctx) {
+		log.Print("The Google Ads API is enabled.")
+	}
+}
+
+// waitForAPIEnabled gets the account info with the last authorized client
+// until the Google Ads API is no longer disabled, with apiEnableCheckDelay
+// between the attempts. It returns false when ctx is canceled, e.g. when the
+// user presses <Ctrl-C>.
+func (c *Config) waitForAPIEnabled(ctx context.Context) bool {
+	for ctx.Err() == nil {
+		_, err := c.getAccount(ctx, c.client)
+		if err == nil || c.decodeError(err) != GoogleAdsAPIDisabled {
+			return true
+		}
+		log.Printf("The Google Ads API is not enabled yet. It can take a few "+
+			"minutes after enabling it. Checking again in %s, press <Ctrl-C> "+
+			"to abort...", apiEnableCheckDelay)
+
+		select {
+		case <-time.After(apiEnableCheckDelay):
+		case <-ctx.Done():
+		}
+	}
+	return false
+}
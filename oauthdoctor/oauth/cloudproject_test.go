@@ -0,0 +1,107 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestProjectNumber(t *testing.T) {
+	tests := []struct {
+		clientID string
+		want     string
+		ok       bool
+	}{
+		{"123456789012-abc123def.apps.googleusercontent.com", "123456789012", true},
+		{"123456789012-abc123def.apps.googleusercontent.com ", "", false},
+		{"abc123def.apps.googleusercontent.com", "", false},
+		{"123456789012-abc123def", "", false},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+		got, ok := ProjectNumber(test.clientID)
+		if got != test.want || ok != test.ok {
+			t.Errorf("ProjectNumber(%q) - got: %q, %t, want: %q, %t",
+				test.clientID, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestCloudProject(t *testing.T) {
+	tests := []struct {
+		desc     string
+		clientID string
+		msg      string
+		want     string
+	}{
+		{
+			desc:     "Project in the error message",
+			clientID: "111111111111-abc.apps.googleusercontent.com",
+			msg:      "Google Ads API has not been used in project 222222222222 before or it is disabled.",
+			want:     "222222222222",
+		},
+		{
+			desc:     "Project of the client ID",
+			clientID: "111111111111-abc.apps.googleusercontent.com",
+			msg:      "The caller does not have permission",
+			want:     "111111111111",
+		},
+		{
+			desc:     "No project",
+			clientID: "abc.apps.googleusercontent.com",
+		},
+	}
+
+	for _, test := range tests {
+		c := &Config{}
+		c.ConfigFile.ClientID = test.clientID
+		if got := c.cloudProject(test.msg); got != test.want {
+			t.Errorf("%s: got: %q, want: %q", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestWaitForAPIEnabled(t *testing.T) {
+	defer func(d time.Duration) { apiEnableCheckDelay = d }(apiEnableCheckDelay)
+	apiEnableCheckDelay = 0
+
+	disabled := fakeResponse{
+		status: http.StatusForbidden,
+		body:   `{"error": {"code": 403, "message": "Google Ads API has not been used in project 123 before or it is disabled.", "status": "PERMISSION_DENIED"}}`,
+	}
+	transport := &sequenceTransport{responses: []fakeResponse{
+		disabled, disabled,
+		{status: http.StatusOK, body: `{"resourceName": "customers/1234567890"}`},
+	}}
+	c := &Config{CustomerID: "1234567890", client: &http.Client{Transport: transport}}
+
+	if !c.waitForAPIEnabled(context.Background()) {
+		t.Errorf("waitForAPIEnabled - got: false, want: true")
+	}
+	if transport.calls != 3 {
+		t.Errorf("requests - got: %d, want: 3", transport.calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	transport = &sequenceTransport{responses: []fakeResponse{disabled}}
+	c.client = &http.Client{Transport: transport}
+	if c.waitForAPIEnabled(ctx) {
+		t.Errorf("waitForAPIEnabled with a canceled context - got: true, want: false")
+	}
+}
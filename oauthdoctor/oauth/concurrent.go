@@ -0,0 +1,181 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains the concurrent diagnosis of many customer IDs, e.g. all
+// the client accounts of an agency. The OAuth flow runs once, and the
+// Google Ads API requests of the customer IDs share its authorized client.
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// rateGate pauses all the workers of a concurrent diagnosis after one of
+// them is rate limited, so that they back off together instead of each of
+// them exhausting its retries.
+type rateGate struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+// pause holds the requests of the workers for d, unless they are already
+// held for longer.
+func (g *rateGate) pause(d time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if t := time.Now().Add(d); t.After(g.until) {
+		g.until = t
+	}
+}
+
+// wait blocks until the pause is over or ctx is done.
+func (g *rateGate) wait(ctx context.Context) error {
+	g.mu.Lock()
+	d := time.Until(g.until)
+	g.mu.Unlock()
+	if d <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// SimulateOAuthFlowsConcurrently diagnoses the customer IDs with up to
+// concurrency workers, and returns the summary of the reports. The OAuth
+// flow runs for the first customer ID only, and the other customer IDs are
+// requested in parallel with its authorized client. When the credentials
+// fail before the client is authorized, every customer ID is reported with
+// the error of the first one. The prompts are disabled, since they cannot
+// be answered for several customer IDs at once.
+func (c *Config) SimulateOAuthFlowsConcurrently(ctx context.Context, customerIDs []string, concurrency int) Summary {
+	c.NonInteractive = true
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	s := Summary{Success: true}
+	if len(customerIDs) == 0 {
+		return s
+	}
+
+	log.Printf("Diagnosing customer ID %s (1 of %d)...", customerIDs[0], len(customerIDs))
+	c.CustomerID = customerIDs[0]
+	reports := make([]Report, len(customerIDs))
+	reports[0] = c.SimulateOAuthFlow(ctx)
+	c.onReport(reports[0])
+
+	if c.client == nil {
+		log.Print("No authorized client is available, so the other customer " +
+			"IDs are reported with the same result.")
+		for i := 1; i < len(customerIDs); i++ {
+			reports[i] = reports[0]
+			reports[i].CustomerID = customerIDs[i]
+			c.onReport(reports[i])
+		}
+	} else {
+		log.Printf("Diagnosing %d more customer IDs with %d workers...",
+			len(customerIDs)-1, concurrency)
+		gate := &rateGate{}
+		jobs := make(chan int)
+		var wg sync.WaitGroup
+		// OnReport is called by one worker at a time
+		var mu sync.Mutex
+		for w := 0; w < concurrency; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					reports[i] = c.diagnoseCustomerID(ctx, customerIDs[i], gate)
+					mu.Lock()
+					c.onReport(reports[i])
+					mu.Unlock()
+				}
+			}()
+		}
+		for i := 1; i < len(customerIDs); i++ {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+	}
+
+	for _, report := range reports {
+		s.add(report)
+	}
+	return s
+}
+
+// diagnoseCustomerID gets the account info of the customer ID with the
+// authorized client of c and diagnoses the error if there's any. It works on
+// a copy of c, so that the workers do not share the customer ID and the
+// report. A rate limited request pauses all the workers with gate and is
+// retried, up to maxFixAttempts.
+func (c *Config) diagnoseCustomerID(ctx context.Context, customerID string, gate *rateGate) Report {
+	w := *c
+	w.CustomerID = customerID
+	w.report = Report{CustomerID: customerID}
+	var tm *timer
+	if w.Timings {
+		ctx, tm = withTimer(ctx)
+	}
+
+	var accountInfo *bytes.Buffer
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = gate.wait(ctx); err != nil {
+			break
+		}
+		accountInfo, err = w.getAccount(ctx, c.client)
+		if err == nil || w.decodeError(err) != RateLimited || attempt >= maxFixAttempts {
+			break
+		}
+		d := w.rateLimitDelay(err, attempt)
+		log.Printf("Customer ID %s is rate limited. Pausing all the requests for %s...", customerID, d)
+		gate.pause(d)
+	}
+
+	if err != nil {
+		w.diagnose(ctx, err)
+	}
+	w.finish(accountInfo, err)
+	w.checkDeadline(ctx)
+	w.checkCanceled(ctx)
+	w.recordTimings(tm)
+	log.Printf("Diagnosed customer ID %s.", customerID)
+	return w.report
+}
+
+// rateLimitDelay returns the delay after the given number of rate limited
+// attempts, which is the delay suggested by the Google Ads API if there's
+// any.
+func (c *Config) rateLimitDelay(err error, attempt int) time.Duration {
+	if e, ok := err.(*APIError); ok {
+		if after, ok := e.RetryAfter(); ok {
+			return after
+		}
+	}
+	delay := c.RetryDelay
+	if delay <= 0 {
+		delay = DefaultRetryDelay
+	}
+	return backoff(delay, attempt)
+}
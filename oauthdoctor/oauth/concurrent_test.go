@@ -0,0 +1,136 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"oauthdoctor/diag"
+)
+
+// customerTransport is a concurrency-safe http.RoundTripper that issues
+// access tokens and answers the account info of the customer IDs. The
+// customer ID in notFound is not found, and the first request of the
+// customer ID in rateLimited is rate limited.
+type customerTransport struct {
+	mu            sync.Mutex
+	tokenRequests int
+	rateLimited   string
+	notFound      string
+	limitedOnce   bool
+}
+
+func (f *customerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	status := http.StatusOK
+	body := `{"resourceName": "customers/1234567890"}`
+	switch {
+	case strings.Contains(req.URL.Path, "token"):
+		f.tokenRequests++
+		body = `{"access_token": "AccessToken", "token_type": "Bearer", "expires_in": 3600}`
+	case strings.HasSuffix(req.URL.Path, "customers/"+f.notFound):
+		status = http.StatusBadRequest
+		body = `{"error": {"code": 400, "message": "Request contains an invalid argument.", "status": "INVALID_ARGUMENT",
+			"details": [{"errors": [{"errorCode": {"authorizationError": "CUSTOMER_NOT_FOUND"}, "message": "Customer not found."}]}]}}`
+	case strings.HasSuffix(req.URL.Path, "customers/"+f.rateLimited) && !f.limitedOnce:
+		f.limitedOnce = true
+		status = http.StatusTooManyRequests
+		body = `{"error": {"code": 429, "message": "Resource has been exhausted (e.g. check quota).", "status": "RESOURCE_EXHAUSTED",
+			"details": [{"errors": [{"errorCode": {"quotaError": "RESOURCE_EXHAUSTED"}, "message": "Too many requests."}]}]}}`
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func TestSimulateOAuthFlowsConcurrently(t *testing.T) {
+	transport := &customerTransport{rateLimited: "3333333333", notFound: "2222222222"}
+	c := &Config{
+		HTTPClient:  &http.Client{Transport: transport},
+		MaxAttempts: 1,
+		OAuthType:   InstalledApp,
+		RetryDelay:  time.Millisecond,
+		ConfigFile: diag.ConfigFile{
+			Lang: "python",
+			ConfigKeys: diag.ConfigKeys{
+				DevToken:     "GoodDevToken",
+				ClientID:     "GoodClientID",
+				ClientSecret: "GoodClientSecret",
+				RefreshToken: "GoodRefreshToken",
+			},
+		},
+	}
+
+	// The reports are streamed as each customer ID finishes
+	streamed := make(map[string]bool)
+	c.OnReport = func(r Report) { streamed[r.CustomerID] = true }
+
+	cids := []string{"1234567890", "2222222222", "3333333333", "4444444444", "5555555555"}
+	got := c.SimulateOAuthFlowsConcurrently(context.Background(), cids, 3)
+	if len(streamed) != len(cids) {
+		t.Errorf("OnReport - got %d customer IDs, want: %d", len(streamed), len(cids))
+	}
+	if !c.NonInteractive {
+		t.Error("NonInteractive - got: false, want: true")
+	}
+	if got.Success || len(got.Reports) != len(cids) {
+		t.Fatalf("SimulateOAuthFlowsConcurrently - got: %+v, want %d reports with a failure", got, len(cids))
+	}
+	for i, r := range got.Reports {
+		want := cids[i] != transport.notFound
+		if r.CustomerID != cids[i] || r.Success != want {
+			t.Errorf("report %d - got: %+v, want success %t for %s", i, r, want, cids[i])
+		}
+		if !want && r.Code != CustomerNotAccessible {
+			t.Errorf("report %d - got code: %d, want: %d", i, r.Code, CustomerNotAccessible)
+		}
+	}
+	// The access token of the first customer ID is shared by the workers
+	if transport.tokenRequests != 1 {
+		t.Errorf("token requests - got: %d, want: 1", transport.tokenRequests)
+	}
+}
+
+func TestSimulateOAuthFlowsConcurrentlyUnauthorized(t *testing.T) {
+	c := fakeConfig(http.StatusBadRequest, `{"error": "invalid_grant"}`)
+	c.OAuthType = InstalledApp
+	c.ConfigFile = diag.ConfigFile{
+		Lang: "python",
+		ConfigKeys: diag.ConfigKeys{
+			DevToken:     "GoodDevToken",
+			ClientID:     "GoodClientID",
+			ClientSecret: "GoodClientSecret",
+			RefreshToken: "BadRefreshToken",
+		},
+	}
+
+	cids := []string{"1234567890", "0987654321"}
+	got := c.SimulateOAuthFlowsConcurrently(context.Background(), cids, 2)
+	for i, r := range got.Reports {
+		if r.CustomerID != cids[i] || r.Success || r.Code != InvalidRefreshToken {
+			t.Errorf("report %d - got: %+v, want code %d for %s", i, r, InvalidRefreshToken, cids[i])
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"oauthdoctor/diag"
+)
+
+// unreachableTransport is a http.RoundTripper that fails with a DNS error
+// for the unreachable host and records the other requests.
+type unreachableTransport struct {
+	host     string
+	requests []string
+}
+
+func (f *unreachableTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host == f.host {
+		return nil, &net.OpError{Op: "dial", Net: "tcp",
+			Err: &net.DNSError{Err: "no such host", Name: f.host}}
+	}
+	f.requests = append(f.requests, req.Method+" "+req.URL.String())
+	return &http.Response{
+		StatusCode: http.StatusNotFound,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+func TestCheckConnectivity(t *testing.T) {
+	transport := &unreachableTransport{}
+	c := &Config{HTTPClient: &http.Client{Transport: transport}}
+	if !c.checkConnectivity(context.Background()) {
+		t.Errorf("checkConnectivity with reachable hosts - got: false, want: true")
+	}
+	if urls := c.endpointURLs(); len(transport.requests) != len(urls) {
+		t.Errorf("requests - got: %v, want one for each of %v", transport.requests, urls)
+	}
+	// The check is only done once
+	transport.requests = nil
+	c.checkConnectivity(context.Background())
+	if len(transport.requests) != 0 {
+		t.Errorf("requests of the second check - got: %v, want none", transport.requests)
+	}
+}
+
+func TestSimulateOAuthFlowUnreachable(t *testing.T) {
+	transport := &unreachableTransport{host: "oauth2.googleapis.com"}
+	c := &Config{
+		CustomerID:     "1234567890",
+		HTTPClient:     &http.Client{Transport: transport},
+		NonInteractive: true,
+		OAuthType:      InstalledApp,
+		ConfigFile: diag.ConfigFile{
+			Lang: "python",
+			ConfigKeys: diag.ConfigKeys{
+				DevToken:     "GoodDevToken",
+				ClientID:     "GoodClientID",
+				ClientSecret: "GoodClientSecret",
+				RefreshToken: "GoodRefreshToken",
+			},
+		},
+	}
+
+	got := c.SimulateOAuthFlow(context.Background())
+	if got.Success || got.Code != NetworkUnreachable {
+		t.Errorf("got: %+v, want code: %d", got, NetworkUnreachable)
+	}
+	for _, r := range transport.requests {
+		if !strings.HasPrefix(r, "HEAD ") {
+			t.Errorf("request %s is sent although a host is unreachable", r)
+		}
+	}
+}
+
+// timeoutError is a net.Error of a dial that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestNetworkFailure(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.IPv4(142, 250, 1, 95), Port: 443}
+	dnsErr := &net.DNSError{Err: "server misbehaving", Name: "oauth2.googleapis.com"}
+	tests := []struct {
+		desc string
+		err  error
+		want string
+	}{
+		{
+			desc: "DNS lookup failure",
+			err: &url.Error{Op: "Post", URL: "https://oauth2.googleapis.com/token",
+				Err: &net.OpError{Op: "dial", Net: "tcp", Err: dnsErr}},
+			want: "The host name oauth2.googleapis.com cannot be resolved",
+		},
+		{
+			desc: "Connection refused",
+			err: &net.OpError{Op: "dial", Net: "tcp", Addr: addr,
+				Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)},
+			want: "The connection to 142.250.1.95:443 was refused",
+		},
+		{
+			desc: "Connection timeout",
+			err:  &net.OpError{Op: "dial", Net: "tcp", Addr: addr, Err: timeoutError{}},
+			want: "The connection to 142.250.1.95:443 timed out",
+		},
+		{
+			desc: "Connection reset",
+			err: &net.OpError{Op: "read", Net: "tcp", Addr: addr,
+				Err: os.NewSyscallError("read", syscall.ECONNRESET)},
+			want: "The connection to 142.250.1.95:443 was interrupted",
+		},
+		{
+			desc: "TLS handshake timeout",
+			err: &url.Error{Op: "Post", URL: "https://oauth2.googleapis.com/token",
+				Err: errors.New("net/http: TLS handshake timeout")},
+			want: "The TLS handshake timed out",
+		},
+		{
+			desc: "Error response",
+			err:  errors.New(`oauth2: cannot fetch token: 401 Unauthorized`),
+			want: "",
+		},
+	}
+
+	c := &Config{}
+	for _, test := range tests {
+		got := networkFailure(test.err)
+		if (test.want == "") != (got == "") || !strings.HasPrefix(got, test.want) {
+			t.Errorf("%s: got: %q, want prefix: %q", test.desc, got, test.want)
+		}
+		// The network errors are never diagnosed as credential errors
+		if code := c.decodeError(test.err); test.want != "" && code != NetworkUnreachable {
+			t.Errorf("%s: decodeError - got: %d, want: %d", test.desc, code, NetworkUnreachable)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains the functions to detect and diagnose the errors
+// returned in the redirect URL of the auth dialog, before any token exists,
+// the login challenges that stall the auth dialog, and the refresh tokens
+// whose consent was revoked afterwards.
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"oauthdoctor/diag"
+	"time"
+)
+
+// consentScreenURL is the OAuth consent screen page of the Google Cloud
+// console.
+const consentScreenURL = "https://console.cloud.google.com/apis/credentials/consent"
+
+// revokedRemediation is the recommended action when the refresh token has
+// been expired or revoked, which replaces the one of InvalidRefreshToken.
+const revokedRemediation = "Grant the consent again by generating a new " +
+	"refresh token with the installed app flow. The consent was revoked on " +
+	"the Google Account side, so the client ID and secret do not need to be changed."
+
+// loginChallengeErrors are the errors returned in the redirect URL when the
+// sign-in of the login email was not completed, e.g. a 2-Step Verification
+// challenge was abandoned, or the auth dialog was opened in an embedded
+// browser that Google does not allow to sign in.
+var loginChallengeErrors = []string{
+	"account_selection_required",
+	"consent_required",
+	"disallowed_useragent",
+	"interaction_required",
+	"login_required",
+}
+
+// loginHintDelay is how long to wait for the auth code before printing the
+// login challenge hints, since a stalled auth dialog is most likely waiting
+// for a sign-in challenge.
+var loginHintDelay = 2 * time.Minute
+
+// authCodeTimeout is how long to wait for the auth code before giving up, so
+// that an auth dialog that is never completed does not block the flow when
+// no deadline is set.
+var authCodeTimeout = 10 * time.Minute
+
+// redirectError is an error returned in the redirect URL instead of the
+// auth code, e.g. when the user clicks "Cancel" in the auth dialog.
+// https://tools.ietf.org/html/rfc6749#section-4.1.2.1
+type redirectError struct {
+	// Code is the value of the error parameter, e.g. access_denied.
+	Code string
+	// Description is the value of the error_description parameter.
+	Description string
+}
+
+// redirectErrorPrefix starts the message of a redirectError.
+const redirectErrorPrefix = "auth dialog returned error: "
+
+func (e *redirectError) Error() string {
+	msg := redirectErrorPrefix + e.Code
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	return msg
+}
+
+// parseRedirect returns the auth code in the query parameters of the
+// redirect URL, or a redirectError when the error parameter is set.
+func parseRedirect(query url.Values) (string, error) {
+	if code := query.Get("error"); code != "" {
+		return "", &redirectError{
+			Code:        code,
+			Description: query.Get("error_description"),
+		}
+	}
+	return query.Get("code"), nil
+}
+
+// diagnoseConsent prints the guidance about the OAuth consent screen
+// configuration for the error returned in the redirect URL.
+func (c *Config) diagnoseConsent(err error) {
+	var code string
+	if rErr, ok := err.(*redirectError); ok {
+		code = rErr.Code
+	}
+
+	if isLoginChallenge(code) {
+		diag.Error("The sign-in of your login email was not completed in " +
+			"the auth dialog, so no auth code was returned.")
+		if code == "disallowed_useragent" {
+			log.Print("Google does not allow signing in from an embedded " +
+				"browser. Please open the URL in a regular browser, e.g. Chrome, " +
+				"Firefox or Safari.")
+		}
+		printLoginHints()
+		return
+	}
+
+	switch code {
+	case "admin_policy_enforced":
+		diag.Error("The Google Workspace administrator of the login " +
+			"email restricts access to this app.\nPlease ask your administrator " +
+			"to trust the OAuth client ID " + c.ConfigFile.ClientID + " in the " +
+			"API controls of the Admin console, or login with another email.")
+	case "org_internal":
+		diag.Error("The OAuth consent screen of your Google Cloud " +
+			"project is set to \"Internal\", so only the users in its " +
+			"organization can sign in.\nPlease login with an email of the " +
+			"organization, or change the user type to \"External\": " +
+			consentScreenURL)
+	default:
+		diag.Error("The consent was denied in the auth dialog, so no " +
+			"auth code was returned. This happens when \"Cancel\" is clicked, " +
+			"or when the app is not allowed for the login email.")
+		log.Print("Please check the OAuth consent screen of your Google Cloud " +
+			"project: " + consentScreenURL)
+		log.Print("- If the publishing status is \"Testing\", add the login " +
+			"email to the test users.")
+		log.Print("- If the \"Google hasn't verified this app\" warning is " +
+			"shown, click \"Advanced\" to continue, or submit the app for " +
+			"verification.")
+		log.Print("- Grant the " + AdwordsScope + " scope when you are " +
+			"asked for permission.")
+		log.Print("- If the login email is enrolled in the Advanced " +
+			"Protection Program, most apps are blocked from its data. Please " +
+			"login with another email that can access your Google Ads account.")
+	}
+}
+
+// isLoginChallenge returns true when the error code returned in the redirect
+// URL means that the sign-in was not completed.
+func isLoginChallenge(code string) bool {
+	for _, e := range loginChallengeErrors {
+		if code == e {
+			return true
+		}
+	}
+	return false
+}
+
+// printLoginHints prints the guidance about the sign-in challenges in the
+// auth dialog, which are handled by the Google pages and not by the doctor.
+func printLoginHints() {
+	log.Print("If the sign-in asks for a security challenge, e.g. 2-Step " +
+		"Verification, please complete it in the browser. The doctor waits " +
+		"until the auth dialog returns.")
+	log.Print("- Sign in with the login email that can access your Google " +
+		"Ads account. When several Google Accounts are signed in, choose the " +
+		"right one in the account chooser, or open the URL in an incognito " +
+		"or private window to avoid selecting the wrong account.")
+	log.Print("- If the login email is enrolled in the Advanced Protection " +
+		"Program, the sign-in requires its security key, and most apps are " +
+		"blocked from its data. Please use another login email in that case.")
+	log.Print("- If the auth dialog shows \"Error 400: redirect_uri_mismatch\", " +
+		"the redirect URL of the doctor is not one of the Authorized redirect " +
+		"URIs of your OAuth client ID. Please add it, or set a registered one " +
+		"with --redirecturl in the web flow.")
+}
+
+// waitForAuthCode waits for the auth code or the error returned in the
+// redirect URL. It prints the login hints once when the auth dialog has not
+// returned after loginHintDelay, and fails after authCodeTimeout.
+func waitForAuthCode(ctx context.Context, codes <-chan string, errs <-chan error) (string, error) {
+	hint := time.After(loginHintDelay)
+	timeout := time.After(authCodeTimeout)
+	for {
+		select {
+		case code := <-codes:
+			return code, nil
+		case err := <-errs:
+			return "", err
+		case <-hint:
+			log.Print("Still waiting for the auth code...")
+			printLoginHints()
+		case <-timeout:
+			return "", fmt.Errorf("no auth code was received within %s: the auth "+
+				"dialog was not completed", authCodeTimeout)
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// isTokenRevoked returns true when the token exchange failed because the
+// refresh token has been expired or revoked, e.g. the user removed the access
+// of the app from their Google Account, or changed their password.
+func isTokenRevoked(err error) bool {
+	_, _, ok := decodeRevokedToken(err.Error())
+	return ok
+}
+
+// diagnoseRevokedToken explains that the consent of the refresh token was
+// revoked on the Google Account side, and offers to run the installed app
+// flow right away to generate a new refresh token. It returns false when the
+// user declines.
+func (c *Config) diagnoseRevokedToken() bool {
+	diag.Error("Your refresh token has been expired or revoked. This is " +
+		"a problem with the consent of the login email on the Google Account " +
+		"side, not with the client ID and secret in your configuration file.")
+	log.Print("This happens when the access of the app is removed in the " +
+		"Google Account (https://myaccount.google.com/permissions), when the " +
+		"password of the login email is changed, or when the refresh token of " +
+		"an app in \"Testing\" publishing status is older than 7 days.")
+	log.Print("Please grant the consent again to generate a new refresh token.")
+
+	if c.NonInteractive || c.OAuthType != InstalledApp {
+		return true
+	}
+	if c.confirm("Would you like to run the installed app flow now to "+
+		"generate a new refresh token?", true) {
+		return true
+	}
+	log.Print("The installed app flow is NOT run")
+	return false
+}
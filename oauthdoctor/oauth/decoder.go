@@ -0,0 +1,269 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains the decoders of the error strings, which determine the
+// error codes of the errors that are not Google Ads API error envelopes.
+
+import (
+	"context"
+	"strings"
+)
+
+// errorDecoder matches one error signature in an error string. It returns
+// the error code of the signature and its recommended action, and false when
+// errstr does not match it. Most decoders return the recommended action of
+// the code in remediations, see matched, but a signature can refine it.
+type errorDecoder func(errstr string) (int32, string, bool)
+
+// errorDecoders are the decoders of decodeErrorString in priority order. The
+// first decoder that matches determines the error code, so a signature comes
+// before the more general ones that also match it, e.g. an invalid_grant
+// about the audience before any invalid_grant. Add a new error signature as a
+// decoder in this list.
+var errorDecoders = []errorDecoder{
+	decodeRequestTimeout,
+	decodeCertificateError,
+	decodeSubjectTokenError,
+	decodeAudienceMismatch,
+	decodeImpersonationDenied,
+	decodeAccessTokenExpired,
+	decodeInsufficientScope,
+	decodeNetworkUnreachable,
+	decodeInvalidClientInfo,
+	decodeRedirectURIMismatch,
+	decodeServiceAccountUnauthorized,
+	decodeUnauthorized,
+	decodeRevokedToken,
+	decodeInvalidRefreshToken,
+	decodeConsentDenied,
+	decodeUserPermissionDenied,
+	decodeDevTokenNotApproved,
+	decodeDevTokenNotAllowlisted,
+	decodeInvalidDevToken,
+	decodeDevTokenProhibited,
+	decodeAPIDisabled,
+	decodeUnauthenticated,
+	decodeManagerAccount,
+	decodeMissingDevToken,
+	decodeCustomerNotEnabled,
+	decodeCustomerNotAccessible,
+	decodeInvalidCustomerID,
+	decodeRateLimited,
+}
+
+// decodeErrorString determines the error code by matching known substrings
+// in the error string with errorDecoders. It returns UnknownError when none
+// of them match.
+func decodeErrorString(errstr string) int32 {
+	code, _ := decodeErrorRemediation(errstr)
+	return code
+}
+
+// decodeErrorRemediation determines the error code and its recommended
+// action with the first of errorDecoders that matches the error string. It
+// returns UnknownError when none of them match.
+func decodeErrorRemediation(errstr string) (int32, string) {
+	for _, decode := range errorDecoders {
+		if code, remediation, ok := decode(errstr); ok {
+			return code, remediation
+		}
+	}
+	return UnknownError, remediations[UnknownError]
+}
+
+// matched returns the result of a decoder of code, with the recommended
+// action of code in remediations.
+func matched(code int32, ok bool) (int32, string, bool) {
+	return code, remediations[code], ok
+}
+
+// substringDecoder returns a decoder of code that matches an error string
+// containing any of substrs.
+func substringDecoder(code int32, substrs ...string) errorDecoder {
+	return func(errstr string) (int32, string, bool) {
+		return matched(code, containsAny(errstr, substrs...))
+	}
+}
+
+// containsAny reports whether s contains any of substrs.
+func containsAny(s string, substrs ...string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeRequestTimeout matches a network call that did not complete before
+// the timeout.
+var decodeRequestTimeout = substringDecoder(RequestTimeout,
+	context.DeadlineExceeded.Error(), "Client.Timeout exceeded")
+
+// decodeCertificateError matches a server certificate that is not signed by
+// a trusted CA, e.g. when a proxy intercepts the TLS connection.
+var decodeCertificateError = substringDecoder(CertificateError,
+	"x509: ", "tls: failed to verify certificate")
+
+// decodeSubjectTokenError matches a subject token of an external account
+// that cannot be retrieved, by the errors of the credential sources in
+// golang.org/x/oauth2/google.
+var decodeSubjectTokenError = substringDecoder(SubjectTokenError,
+	"oauth2/google: unable to parse credential source",
+	"oauth2/google: failed to open credential file",
+	"oauth2/google: failed to read credential file",
+	"oauth2/google: failed to unmarshal subject token file",
+	"oauth2/google: provided subject_token_field_name not found",
+	"oauth2/google: improperly formatted subject token",
+	"oauth2/google: invalid credential_source file format type",
+	"oauth2/google: HTTP request for URL-sourced credential failed",
+	"oauth2/google: invalid response when retrieving subject token",
+	"oauth2/google: invalid body in subject token URL query",
+	"oauth2/google: unable to determine AWS region",
+	"oauth2/google: unable to retrieve AWS",
+	"oauth2/google: missing AccessKeyId credential",
+	"oauth2/google: missing SecretAccessKey credential",
+	"oauth2/google: unable to determine the AWS metadata server")
+
+// decodeAudienceMismatch matches a workload identity pool provider in the
+// audience that is not found, or that does not accept the subject token,
+// which the Security Token Service returns to the external account.
+func decodeAudienceMismatch(errstr string) (int32, string, bool) {
+	if !strings.Contains(errstr, "oauth2/google: status code") {
+		return matched(AudienceMismatch, false)
+	}
+	return matched(AudienceMismatch, strings.Contains(errstr, "invalid_target") ||
+		(strings.Contains(errstr, "invalid_grant") && strings.Contains(errstr, "audience")))
+}
+
+// decodeImpersonationDenied matches an external account that cannot
+// impersonate the service account.
+var decodeImpersonationDenied = substringDecoder(ImpersonationDenied,
+	"iam.serviceAccounts.getAccessToken")
+
+// decodeAccessTokenExpired matches an expired access token, which is only
+// reported for an access token that is not refreshed.
+var decodeAccessTokenExpired = substringDecoder(AccessTokenExpired,
+	"ACCESS_TOKEN_EXPIRED", "OAUTH_TOKEN_EXPIRED")
+
+// decodeInsufficientScope matches a valid access token that was not granted
+// the Google Ads API scope.
+var decodeInsufficientScope = substringDecoder(InsufficientScope,
+	"ACCESS_TOKEN_SCOPE_INSUFFICIENT", "insufficient_scope",
+	"insufficient authentication scopes")
+
+// decodeNetworkUnreachable matches a host that cannot be resolved or
+// reached, e.g. when it is blocked by a firewall.
+var decodeNetworkUnreachable = substringDecoder(NetworkUnreachable,
+	"no such host", "connection refused", "actively refused",
+	"network is unreachable", "no route to host", "TLS handshake timeout")
+
+// decodeInvalidClientInfo matches an invalid client ID and/or secret.
+var decodeInvalidClientInfo = substringDecoder(InvalidClientInfo, "invalid_client")
+
+// decodeRedirectURIMismatch matches a redirect URL that is not registered in
+// the OAuth client ID.
+var decodeRedirectURIMismatch = substringDecoder(RedirectURIMismatch, "redirect_uri_mismatch")
+
+// decodeServiceAccountUnauthorized matches a service account that is not
+// allowed to impersonate the given user.
+var decodeServiceAccountUnauthorized = substringDecoder(ServiceAccountUnauthorized,
+	"Client is unauthorized to retrieve access tokens using this method")
+
+// decodeUnauthorized matches a refresh token that was not generated with the
+// given client ID and secret, e.g. when they are from another Google Cloud
+// project.
+var decodeUnauthorized = substringDecoder(Unauthorized, "unauthorized_client")
+
+// decodeRevokedToken matches a refresh token that has been expired or
+// revoked, e.g. the user removed the access of the app from their Google
+// Account, or changed their password. It is an InvalidRefreshToken whose
+// consent has to be granted again, see revokedRemediation.
+func decodeRevokedToken(errstr string) (int32, string, bool) {
+	return InvalidRefreshToken, revokedRemediation, strings.Contains(errstr, "invalid_grant") &&
+		strings.Contains(strings.ToLower(errstr), "expired or revoked")
+}
+
+// decodeInvalidRefreshToken matches a refresh token that is not valid for
+// any users, or that is not set.
+var decodeInvalidRefreshToken = substringDecoder(InvalidRefreshToken,
+	"invalid_grant", "refresh token is not set")
+
+// decodeConsentDenied matches a consent that was denied, an app that is not
+// allowed in the auth dialog, or a sign-in that was not completed there. The
+// login challenges are only matched in the errors of the redirect URL, see
+// redirectError, since their codes are also used by other endpoints.
+func decodeConsentDenied(errstr string) (int32, string, bool) {
+	if containsAny(errstr, "access_denied", "admin_policy_enforced", "org_internal") {
+		return matched(ConsentDenied, true)
+	}
+	for _, e := range loginChallengeErrors {
+		if strings.Contains(errstr, redirectErrorPrefix+e) {
+			return matched(ConsentDenied, true)
+		}
+	}
+	return matched(ConsentDenied, false)
+}
+
+// decodeUserPermissionDenied matches a user that does not have permission to
+// access the Google Ads account.
+var decodeUserPermissionDenied = substringDecoder(UserPermissionDenied, "USER_PERMISSION_DENIED")
+
+// decodeDevTokenNotApproved matches a developer token that can only be used
+// with test accounts.
+var decodeDevTokenNotApproved = substringDecoder(DevTokenNotApproved, "DEVELOPER_TOKEN_NOT_APPROVED")
+
+// decodeDevTokenNotAllowlisted matches a developer token whose access level
+// does not allow the request.
+var decodeDevTokenNotAllowlisted = substringDecoder(DevTokenNotAllowlisted,
+	"DEVELOPER_TOKEN_NOT_ON_ALLOWLIST")
+
+// decodeInvalidDevToken matches a developer token that is malformed or
+// unknown, e.g. when it was reset.
+var decodeInvalidDevToken = substringDecoder(InvalidDevToken, "DEVELOPER_TOKEN_INVALID")
+
+// decodeDevTokenProhibited matches a developer token that is tied to another
+// Google Cloud project.
+var decodeDevTokenProhibited = substringDecoder(DevTokenProhibited, "DEVELOPER_TOKEN_PROHIBITED")
+
+// decodeAPIDisabled matches the PERMISSION_DENIED status, which is most
+// likely a Google Ads API that is not enabled in the Google Cloud project.
+var decodeAPIDisabled = substringDecoder(GoogleAdsAPIDisabled, "\"PERMISSION_DENIED\"")
+
+// decodeUnauthenticated matches the UNAUTHENTICATED status.
+var decodeUnauthenticated = substringDecoder(Unauthenticated, "UNAUTHENTICATED")
+
+// decodeManagerAccount matches a request that cannot be executed by a
+// manager account.
+var decodeManagerAccount = substringDecoder(AccessNotPermittedForManagerAccount,
+	"CANNOT_BE_EXECUTED_BY_MANAGER_ACCOUNT")
+
+// decodeMissingDevToken matches a request without a developer token.
+var decodeMissingDevToken = substringDecoder(MissingDevToken, "DEVELOPER_TOKEN_PARAMETER_MISSING")
+
+// decodeCustomerNotEnabled matches an account that is canceled, suspended or
+// not set up yet.
+var decodeCustomerNotEnabled = substringDecoder(CustomerNotEnabled,
+	"CUSTOMER_NOT_ENABLED", "INCOMPLETE_SIGNUP")
+
+// decodeCustomerNotAccessible matches a well-formed customer ID that cannot
+// be accessed.
+var decodeCustomerNotAccessible = substringDecoder(CustomerNotAccessible, "CUSTOMER_NOT_FOUND")
+
+// decodeInvalidCustomerID matches a malformed customer ID.
+var decodeInvalidCustomerID = substringDecoder(InvalidCustomerID, "INVALID_CUSTOMER_ID")
+
+// decodeRateLimited matches a request that exceeded a quota or a rate limit.
+var decodeRateLimited = substringDecoder(RateLimited, "RESOURCE_EXHAUSTED")
@@ -0,0 +1,182 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestErrorDecoders(t *testing.T) {
+	tests := []struct {
+		desc        string
+		decode      errorDecoder
+		errstr      string
+		want        int32
+		remediation string
+		match       bool
+	}{
+		{
+			desc:   "Subject token of an AWS credential source",
+			decode: decodeSubjectTokenError,
+			errstr: "oauth2/google: unable to retrieve AWS region",
+			want:   SubjectTokenError,
+			match:  true,
+		},
+		{
+			desc:   "AWS error that is not from the external account",
+			decode: decodeSubjectTokenError,
+			errstr: "AWS credentials are not used",
+		},
+		{
+			desc:   "Other oauth2/google error mentioning AWS",
+			decode: decodeSubjectTokenError,
+			errstr: "oauth2/google: no credentials found for the AWS account",
+		},
+		{
+			desc:   "invalid_grant about the audience",
+			decode: decodeAudienceMismatch,
+			errstr: "oauth2/google: status code 400: " +
+				`{"error": "invalid_grant", "error_description": "The audience in the token is invalid"}`,
+			want:  AudienceMismatch,
+			match: true,
+		},
+		{
+			desc:   "invalid_grant of a refresh token",
+			decode: decodeAudienceMismatch,
+			errstr: `{"error": "invalid_grant", "error_description": "Bad Request"}`,
+		},
+		{
+			desc:   "invalid_grant about the audience of an ID token",
+			decode: decodeAudienceMismatch,
+			errstr: `{"error": "invalid_grant", "error_description": "Invalid audience"}`,
+		},
+		{
+			desc:   "Login challenge returned in the redirect URL",
+			decode: decodeConsentDenied,
+			errstr: (&redirectError{Code: "interaction_required"}).Error(),
+			want:   ConsentDenied,
+			match:  true,
+		},
+		{
+			desc:   "Login challenge code in another error",
+			decode: decodeConsentDenied,
+			errstr: `oauth2: cannot fetch token: 400 Bad Request Response: {"error": "invalid_grant", "error_description": "login_required"}`,
+		},
+		{
+			desc:        "Refresh token expired or revoked",
+			decode:      decodeRevokedToken,
+			errstr:      `{"error": "invalid_grant", "error_description": "Token has been expired or revoked."}`,
+			want:        InvalidRefreshToken,
+			remediation: revokedRemediation,
+			match:       true,
+		},
+		{
+			desc:   "invalid_grant of a refresh token that is not revoked",
+			decode: decodeRevokedToken,
+			errstr: `{"error": "invalid_grant", "error_description": "Bad Request"}`,
+		},
+		{
+			desc:   "Substring decoder matches any of its substrings",
+			decode: decodeNetworkUnreachable,
+			errstr: "dial tcp: connect: no route to host",
+			want:   NetworkUnreachable,
+			match:  true,
+		},
+		{
+			desc:   "Substring decoder does not match other errors",
+			decode: decodeInvalidClientInfo,
+			errstr: "unauthorized_client",
+		},
+	}
+
+	for _, test := range tests {
+		code, remediation, ok := test.decode(test.errstr)
+		if ok != test.match {
+			t.Errorf("%s: match - got: %t, want: %t", test.desc, ok, test.match)
+		}
+		if ok && code != test.want {
+			t.Errorf("%s: code - got: %s, want: %s", test.desc, errorNames[code], errorNames[test.want])
+		}
+		want := test.remediation
+		if want == "" {
+			want = remediations[test.want]
+		}
+		if ok && remediation != want {
+			t.Errorf("%s: remediation - got: %q, want: %q", test.desc, remediation, want)
+		}
+	}
+}
+
+func TestDecodeErrorStringPriority(t *testing.T) {
+	tests := []struct {
+		desc   string
+		errstr string
+		want   int32
+	}{
+		{
+			desc: "Audience mismatch before an invalid refresh token",
+			errstr: "oauth2/google: status code 400: " +
+				`{"error": "invalid_grant", "error_description": "The audience in the token is invalid"}`,
+			want: AudienceMismatch,
+		},
+		{
+			desc:   "Service account impersonation before an unauthorized client",
+			errstr: `{"error": "unauthorized_client", "error_description": "Client is unauthorized to retrieve access tokens using this method"}`,
+			want:   ServiceAccountUnauthorized,
+		},
+		{
+			desc:   "Developer token error before the UNAUTHENTICATED status",
+			errstr: `{"status": "UNAUTHENTICATED", "errorCode": {"authenticationError": "DEVELOPER_TOKEN_INVALID"}}`,
+			want:   InvalidDevToken,
+		},
+		{
+			desc:   "No decoder matches",
+			errstr: "unexpected EOF",
+			want:   UnknownError,
+		},
+	}
+
+	for _, test := range tests {
+		if got := decodeErrorString(test.errstr); got != test.want {
+			t.Errorf("%s: decodeErrorString - got: %s, want: %s", test.desc, errorNames[got], errorNames[test.want])
+		}
+	}
+}
+
+func TestCustomErrorDecoder(t *testing.T) {
+	defer func(decoders []errorDecoder) { errorDecoders = decoders }(errorDecoders)
+	const remediation = "Allow oauth2.googleapis.com in the proxy."
+	errorDecoders = append([]errorDecoder{func(errstr string) (int32, string, bool) {
+		return NetworkUnreachable, remediation, strings.Contains(errstr, "blocked by proxy")
+	}}, errorDecoders...)
+
+	err := errors.New("Post https://oauth2.googleapis.com/token: blocked by proxy")
+	if got := decodeErrorString(err.Error()); got != NetworkUnreachable {
+		t.Errorf("decodeErrorString - got: %s, want: %s", errorNames[got], errorNames[NetworkUnreachable])
+	}
+	// The remediation of the decoder is in the diagnosis and in the report
+	if d := DiagnoseError(nil, err); d.Code != NetworkUnreachable || d.Remediation != remediation {
+		t.Errorf("DiagnoseError - got: %s, %q, want: %s, %q", d.Error, d.Remediation,
+			errorNames[NetworkUnreachable], remediation)
+	}
+	c := &Config{}
+	c.finish(&bytes.Buffer{}, err)
+	if c.report.Code != NetworkUnreachable || c.report.Remediation != remediation {
+		t.Errorf("report - got: %s, %q, want: %s, %q", c.report.Error, c.report.Remediation,
+			errorNames[NetworkUnreachable], remediation)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains the classification of an error without any prompt or
+// network call, so that other programs can reuse the diagnosis.
+
+import (
+	"log"
+	"strings"
+)
+
+// Diagnosis is the classification of an error, which is returned by
+// DiagnoseError.
+type Diagnosis struct {
+	// Code is the error code, e.g. InvalidRefreshToken.
+	Code int32 `json:"code"`
+	// Error is the name of the error code, e.g. "InvalidRefreshToken".
+	Error string `json:"error"`
+	// Message is the error message returned by the server, with the secret
+	// values redacted.
+	Message string `json:"message,omitempty"`
+	// ErrorCode is the error category and enum value in the Google Ads API
+	// error envelope, e.g. authenticationError.DEVELOPER_TOKEN_PARAMETER_MISSING.
+	ErrorCode string `json:"errorCode,omitempty"`
+	// Field is the path of the request field that caused the error.
+	Field string `json:"field,omitempty"`
+	// Trigger is the value that triggered the error, with the secret values
+	// redacted.
+	Trigger string `json:"trigger,omitempty"`
+	// Fields are the keys in the configuration file that are likely to
+	// cause the error, named as in the configuration file.
+	Fields []string `json:"fields,omitempty"`
+	// Remediation is the recommended action to fix the error.
+	Remediation string `json:"remediation"`
+	// RateName is the name of the exceeded rate limit, e.g. "Requests per
+	// developer token".
+	RateName string `json:"rateName,omitempty"`
+	// RetryAfter is the delay suggested before retrying, e.g. 30s.
+	RetryAfter string `json:"retryAfter,omitempty"`
+}
+
+// DiagnoseError classifies err, an error returned by the token exchange or
+// by a Google Ads API request made with the configuration in c. It neither
+// prompts nor makes any network call. c may be nil, in which case the keys
+// in Fields are not named as in a configuration file and no secret value is
+// redacted.
+func DiagnoseError(c *Config, err error) Diagnosis {
+	if c == nil {
+		c = &Config{}
+	}
+	code, detail := c.decodeErrorDetail(err)
+
+	d := Diagnosis{
+		Code:        code,
+		Error:       ErrorName(code),
+		Message:     c.redact(detail.Message),
+		ErrorCode:   detail.ErrorCode,
+		Field:       detail.Field,
+		Trigger:     c.redact(detail.Trigger),
+		Remediation: detail.Remediation,
+		RateName:    detail.RateName,
+		RetryAfter:  detail.RetryDelay,
+	}
+	keys := errorKeys(code, err)
+	for _, k := range keys {
+		name := k
+		if c.ConfigFile.Lang != "" || c.ConfigFile.FromEnv {
+			name = c.ConfigFile.GetConfigKeysInLang(k)
+		}
+		d.Fields = append(d.Fields, name)
+	}
+	if code == InvalidClientInfo {
+		d.Remediation = clientRemediation(keys)
+	}
+	if apiErr, ok := err.(*APIError); ok {
+		if after, ok := apiErr.RetryAfter(); ok {
+			d.RetryAfter = after.String()
+		}
+	}
+	return d
+}
+
+// Print logs the diagnosis as prose, e.g. for an error pasted in
+// --diagnoseerror.
+func (d Diagnosis) Print() {
+	log.Printf("Error: %s (%d)", d.Error, d.Code)
+	if d.ErrorCode != "" {
+		log.Printf("Error code: %s", d.ErrorCode)
+	}
+	if d.Message != "" {
+		log.Printf("Message: %s", d.Message)
+	}
+	if d.Trigger != "" {
+		log.Printf("Trigger: %s", d.Trigger)
+	}
+	if len(d.Fields) > 0 {
+		log.Printf("Check these values in the config file: %s", strings.Join(d.Fields, ", "))
+	}
+	if d.RetryAfter != "" {
+		log.Printf("Retry after: %s", d.RetryAfter)
+	}
+	log.Printf("Recommended action: %s", d.Remediation)
+}
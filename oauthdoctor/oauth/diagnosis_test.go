@@ -0,0 +1,261 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"oauthdoctor/diag"
+)
+
+// revokedError is the token exchange error of a revoked refresh token.
+const revokedError = `oauth2: cannot fetch token: 400 Bad Request Response: {"error": "invalid_grant", "error_description": "Token has been expired or revoked."}`
+
+// invalidSecretError is the token exchange error of a client secret that
+// does not match the client ID.
+const invalidSecretError = `oauth2: cannot fetch token: 401 Unauthorized Response: {"error": "invalid_client", "error_description": "Unauthorized"}`
+
+// mismatchError is the token exchange error of a refresh token generated
+// with another client ID.
+const mismatchError = `oauth2: cannot fetch token: 401 Unauthorized Response: {"error": "unauthorized_client", "error_description": "Unauthorized"}`
+
+// clientNotFoundError is the token exchange error of an unknown client ID.
+const clientNotFoundError = `oauth2: cannot fetch token: 401 Unauthorized Response: {"error": "invalid_client", "error_description": "The OAuth client was not found."}`
+
+func TestDiagnoseError(t *testing.T) {
+	refreshToken := "1//0RefreshTokenValue"
+	python := &Config{ConfigFile: diag.ConfigFile{
+		Lang:       "python",
+		ConfigKeys: diag.ConfigKeys{RefreshToken: refreshToken},
+	}}
+
+	tests := []struct {
+		desc string
+		c    *Config
+		err  error
+		want Diagnosis
+	}{
+		{
+			desc: "Invalid refresh token without a configuration",
+			err:  errors.New(`oauth2: cannot fetch token: 400 Bad Request Response: {"error": "invalid_grant"}`),
+			want: Diagnosis{
+				Code:        InvalidRefreshToken,
+				Error:       "InvalidRefreshToken",
+				Message:     `oauth2: cannot fetch token: 400 Bad Request Response: {"error": "invalid_grant"}`,
+				Fields:      []string{diag.RefreshToken},
+				Remediation: remediations[InvalidRefreshToken],
+			},
+		},
+		{
+			desc: "Secret values are redacted and fields are named as in the configuration file",
+			c:    python,
+			err:  errors.New("invalid_grant: " + refreshToken),
+			want: Diagnosis{
+				Code:        InvalidRefreshToken,
+				Error:       "InvalidRefreshToken",
+				Message:     "invalid_grant: " + diag.Mask,
+				Fields:      []string{"refresh_token"},
+				Remediation: remediations[InvalidRefreshToken],
+			},
+		},
+		{
+			desc: "Expired or revoked refresh token",
+			err:  errors.New(revokedError),
+			want: Diagnosis{
+				Code:        InvalidRefreshToken,
+				Error:       "InvalidRefreshToken",
+				Message:     revokedError,
+				Fields:      []string{diag.RefreshToken},
+				Remediation: revokedRemediation,
+			},
+		},
+		{
+			desc: "Client secret rejected for a valid client ID",
+			err:  errors.New(invalidSecretError),
+			want: Diagnosis{
+				Code:        InvalidClientInfo,
+				Error:       "InvalidClientInfo",
+				Message:     invalidSecretError,
+				Fields:      []string{diag.ClientSecret},
+				Remediation: clientRemediation([]string{diag.ClientSecret}),
+			},
+		},
+		{
+			desc: "Client ID not found",
+			err:  errors.New(clientNotFoundError),
+			want: Diagnosis{
+				Code:        InvalidClientInfo,
+				Error:       "InvalidClientInfo",
+				Message:     clientNotFoundError,
+				Fields:      []string{diag.ClientID},
+				Remediation: clientRemediation([]string{diag.ClientID}),
+			},
+		},
+		{
+			desc: "Refresh token generated with another client ID",
+			err:  errors.New(mismatchError),
+			want: Diagnosis{
+				Code:        Unauthorized,
+				Error:       "Unauthorized",
+				Message:     mismatchError,
+				Fields:      []string{diag.RefreshToken},
+				Remediation: remediations[Unauthorized],
+			},
+		},
+		{
+			desc: "Rate limited with a Retry-After header",
+			err: &APIError{
+				StatusCode: http.StatusTooManyRequests,
+				Header:     http.Header{"Retry-After": {"10"}},
+				Body: `{"error": {"code": 429, "message": "Resource has been exhausted (e.g. check quota).", "status": "RESOURCE_EXHAUSTED",
+					"details": [{"errors": [{"errorCode": {"quotaError": "RESOURCE_EXHAUSTED"}, "message": "Too many requests.",
+					"details": {"quotaErrorDetails": {"rateName": "Requests per developer token", "retryDelay": "30s"}}}]}]}}`,
+			},
+			want: Diagnosis{
+				Code:        RateLimited,
+				Error:       "RateLimited",
+				Message:     "Too many requests.",
+				ErrorCode:   "quotaError.RESOURCE_EXHAUSTED",
+				Remediation: remediations[RateLimited],
+				RateName:    "Requests per developer token",
+				RetryAfter:  "10s",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		if got := DiagnoseError(test.c, test.err); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s:\ngot:  %+v\nwant: %+v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestDiagnosisPrint(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	DiagnoseError(nil, errors.New(clientNotFoundError)).Print()
+
+	for _, want := range []string{"Error: InvalidClientInfo", clientNotFoundError, diag.ClientID, clientRemediation([]string{diag.ClientID})} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("Print - got: %s, want it to contain: %s", logs.String(), want)
+		}
+	}
+}
+
+func TestDiagnoseRevokedToken(t *testing.T) {
+	tests := []struct {
+		desc string
+		c    *Config
+		want bool
+	}{
+		{
+			desc: "Installed app flow is run when confirmed",
+			c:    &Config{AssumeYes: true, OAuthType: InstalledApp},
+			want: true,
+		},
+		{
+			desc: "Non-interactive mode is not retried",
+			c:    &Config{NonInteractive: true, OAuthType: InstalledApp},
+			want: false,
+		},
+	}
+
+	for _, test := range tests {
+		if got := test.c.diagnose(context.Background(), errors.New(revokedError)); got != test.want {
+			t.Errorf("%s: diagnose - got: %t, want: %t", test.desc, got, test.want)
+		}
+		if got := test.c.report.Remediation; got != revokedRemediation {
+			t.Errorf("%s: remediation - got: %q, want: %q", test.desc, got, revokedRemediation)
+		}
+	}
+}
+
+func TestDiagnoseClientMismatch(t *testing.T) {
+	tests := []struct {
+		desc string
+		c    *Config
+		want bool
+	}{
+		{
+			desc: "Installed app flow is run when confirmed",
+			c:    &Config{Prompter: &scriptedPrompter{answers: []string{"y"}}, OAuthType: InstalledApp},
+			want: true,
+		},
+		{
+			desc: "Installed app flow is not run when declined",
+			c:    &Config{Prompter: &scriptedPrompter{answers: []string{"n"}}, OAuthType: InstalledApp},
+			want: false,
+		},
+		{
+			desc: "Non-interactive mode is not retried",
+			c:    &Config{NonInteractive: true, OAuthType: InstalledApp},
+			want: false,
+		},
+	}
+
+	for _, test := range tests {
+		if got := test.c.diagnose(context.Background(), errors.New(mismatchError)); got != test.want {
+			t.Errorf("%s: diagnose - got: %t, want: %t", test.desc, got, test.want)
+		}
+		if got, want := test.c.report.Remediation, remediations[Unauthorized]; got != want {
+			t.Errorf("%s: remediation - got: %q, want: %q", test.desc, got, want)
+		}
+	}
+}
+
+func TestWaitForAuthCode(t *testing.T) {
+	defer func(d time.Duration) { loginHintDelay = d }(loginHintDelay)
+	loginHintDelay = time.Millisecond
+
+	// The auth code still arrives after the login hints are printed
+	codes := make(chan string)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		codes <- "GoodAuthCode"
+	}()
+	code, err := waitForAuthCode(context.Background(), codes, make(chan error))
+	if code != "GoodAuthCode" || err != nil {
+		t.Errorf("waitForAuthCode - got: %q, %v, want: GoodAuthCode, nil", code, err)
+	}
+
+	errs := make(chan error, 1)
+	errs <- &redirectError{Code: "login_required"}
+	if _, err := waitForAuthCode(context.Background(), make(chan string), errs); err == nil {
+		t.Errorf("waitForAuthCode with a redirect error - got: nil, want: an error")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := waitForAuthCode(ctx, make(chan string), make(chan error)); err != context.Canceled {
+		t.Errorf("waitForAuthCode with a canceled context - got: %v, want: %v", err, context.Canceled)
+	}
+
+	// The wait fails when the auth dialog is never completed
+	defer func(d time.Duration) { authCodeTimeout = d }(authCodeTimeout)
+	authCodeTimeout = 10 * time.Millisecond
+	if _, err := waitForAuthCode(context.Background(), make(chan string), make(chan error)); err == nil {
+		t.Errorf("waitForAuthCode after the timeout - got: nil, want: an error")
+	}
+}
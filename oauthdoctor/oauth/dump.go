@@ -0,0 +1,85 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains the HTTP wire dump of the requests in verbose mode.
+
+import (
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"regexp"
+	"strings"
+
+	"oauthdoctor/diag"
+)
+
+// dumpSecretRes match the secrets in a dumped request or response that are
+// not in the configuration file: the access token in the Authorization
+// header, the tokens in the token response, and the authorization code and
+// PKCE code verifier in the exchange request.
+var dumpSecretRes = []*regexp.Regexp{
+	regexp.MustCompile(`(?im)^(Authorization:\s*\S+\s+)[^\r\n]*`),
+	regexp.MustCompile(`("(?:access_token|id_token|refresh_token)"\s*:\s*")[^"]*`),
+	regexp.MustCompile(`(?m)((?:^|&)(?:client_secret|code|code_verifier|refresh_token)=)[^&\s]*`),
+}
+
+// dumpTransport is an http.RoundTripper that logs the requests and the
+// responses sent through the base RoundTripper.
+type dumpTransport struct {
+	c    *Config
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *dumpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	log.Printf("HTTP request: %s %s", req.Method, t.c.redactDump([]byte(req.URL.String())))
+	if dump, err := httputil.DumpRequestOut(req, true); err == nil {
+		log.Printf("\n%s", t.c.redactDump(dump))
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		log.Printf("HTTP request failed: %s", t.c.redact(err.Error()))
+		return nil, err
+	}
+
+	log.Printf("HTTP response: %s", resp.Status)
+	if dump, err := httputil.DumpResponse(resp, true); err == nil {
+		log.Printf("\n%s", t.c.redactDump(dump))
+	}
+	return resp, nil
+}
+
+// redactDump returns the dumped request or response with the secrets
+// masked, unless ShowSecrets is set.
+func (c *Config) redactDump(dump []byte) string {
+	if c.ShowSecrets {
+		return string(dump)
+	}
+	return c.RedactLog(string(dump))
+}
+
+// RedactLog returns s with the secrets in the configuration file and in the
+// dumped requests and responses, and the new refresh token that was kept,
+// masked, even when ShowSecrets is set, e.g. for the log file.
+func (c *Config) RedactLog(s string) string {
+	for _, re := range dumpSecretRes {
+		s = re.ReplaceAllString(s, "${1}"+diag.Mask)
+	}
+	if c.newRefreshToken != "" {
+		s = strings.Replace(s, c.newRefreshToken, diag.Mask, -1)
+	}
+	return c.redactAccessToken(c.ConfigFile.Redact(s))
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"oauthdoctor/diag"
+)
+
+func TestRedactDump(t *testing.T) {
+	c := &Config{ConfigFile: diag.ConfigFile{ConfigKeys: diag.ConfigKeys{
+		ClientSecret: "mysecret", DevToken: "mydevtoken"}}}
+
+	tests := []struct {
+		dump string
+		want string
+	}{
+		{
+			dump: "GET /v17/customers/1234567890 HTTP/1.1\r\nAuthorization: Bearer ya29.token\r\nDeveloper-Token: mydevtoken\r\n\r\n",
+			want: "GET /v17/customers/1234567890 HTTP/1.1\r\nAuthorization: Bearer *****\r\nDeveloper-Token: *****\r\n\r\n",
+		},
+		{
+			dump: "POST /token HTTP/1.1\r\n\r\nclient_id=id&client_secret=mysecret&code=4%2Fcode&code_verifier=verifier&grant_type=authorization_code",
+			want: "POST /token HTTP/1.1\r\n\r\nclient_id=id&client_secret=*****&code=*****&code_verifier=*****&grant_type=authorization_code",
+		},
+		{
+			dump: `{"access_token": "ya29.token", "expires_in": 3599, "refresh_token":"1/refresh"}`,
+			want: `{"access_token": "*****", "expires_in": 3599, "refresh_token":"*****"}`,
+		},
+	}
+
+	for _, test := range tests {
+		if got := c.redactDump([]byte(test.dump)); got != test.want {
+			t.Errorf("redactDump(%q) - got: %q, want: %q", test.dump, got, test.want)
+		}
+	}
+
+	c.ShowSecrets = true
+	if got := c.redactDump([]byte(tests[0].dump)); got != tests[0].dump {
+		t.Errorf("redactDump with ShowSecrets - got: %q, want: %q", got, tests[0].dump)
+	}
+}
+
+func TestDumpTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"resourceName": "customers/1234567890"}`))
+	}))
+	defer srv.Close()
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	c := &Config{Verbose: true}
+	req, _ := http.NewRequest("GET", srv.URL+"/v17/customers/1234567890", nil)
+	req.Header.Set("Authorization", "Bearer ya29.token")
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		t.Fatalf("request returned error: %s", err)
+	}
+	defer resp.Body.Close()
+
+	// The response body can still be read after it is dumped
+	body, _ := ioutil.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "customers/1234567890") {
+		t.Errorf("response body - got: %s, want the customer resource name", body)
+	}
+
+	for _, want := range []string{srv.URL + "/v17/customers/1234567890", "Authorization: Bearer *****", "200 OK"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("dump - got: %s, want it to contain: %s", logs.String(), want)
+		}
+	}
+	if strings.Contains(logs.String(), "ya29.token") {
+		t.Errorf("dump - got: %s, want the access token redacted", logs.String())
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains the overrides of the Google Ads API and the OAuth2 token
+// endpoints, e.g. to diagnose against a local mock server in integration
+// tests.
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// ParseEndpoint verifies the URL of an endpoint override, e.g.
+// http://localhost:8080. The scheme must be http or https.
+func ParseEndpoint(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid endpoint URL %q: %s", endpoint, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("invalid endpoint URL %q: the scheme must be http or https", endpoint)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid endpoint URL %q: missing host", endpoint)
+	}
+	return endpoint, nil
+}
+
+// endpoint returns the base URL of the Google Ads API requests, which ends
+// with a slash so that the paths can be appended to it.
+func (c *Config) endpoint() string {
+	if c.Endpoint == "" {
+		return apiEndpoint
+	}
+	if !strings.HasSuffix(c.Endpoint, "/") {
+		return c.Endpoint + "/"
+	}
+	return c.Endpoint
+}
+
+// tokenURL returns the URL of the OAuth2 token endpoint.
+func (c *Config) tokenURL() string {
+	if c.TokenEndpoint == "" {
+		return google.Endpoint.TokenURL
+	}
+	return c.TokenEndpoint
+}
+
+// oauth2Endpoint returns the Google OAuth2 endpoint with the token endpoint
+// in Config.
+func (c *Config) oauth2Endpoint() oauth2.Endpoint {
+	endpoint := google.Endpoint
+	endpoint.TokenURL = c.tokenURL()
+	return endpoint
+}
+
+// endpointURLs returns the root URLs of the endpoints that the flow uses: the
+// auth dialog of the installed app and web flows, the token exchange and the
+// Google Ads API. The auth dialog is skipped when the token endpoint is
+// overridden, e.g. by an offline mock server, and the token exchange is
+// skipped with an access token.
+func (c *Config) endpointURLs() []string {
+	var endpoints []string
+	switch {
+	case c.AccessToken != "":
+	case c.OAuthType == ServiceAccount:
+		endpoints = append(endpoints, c.tokenURL())
+	case c.TokenEndpoint == "":
+		endpoints = append(endpoints, google.Endpoint.AuthURL, c.tokenURL())
+	default:
+		endpoints = append(endpoints, c.tokenURL())
+	}
+	endpoints = append(endpoints, c.endpoint())
+
+	var urls []string
+	for _, endpoint := range endpoints {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			continue
+		}
+		urls = append(urls, u.Scheme+"://"+u.Host+"/")
+	}
+	return urls
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"oauthdoctor/diag"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+		valid    bool
+	}{
+		{endpoint: "http://localhost:8080", want: "http://localhost:8080", valid: true},
+		{endpoint: "https://googleads.googleapis.com/", want: "https://googleads.googleapis.com/", valid: true},
+		{endpoint: "localhost:8080", valid: false},
+		{endpoint: "ftp://localhost", valid: false},
+		{endpoint: "http://", valid: false},
+	}
+
+	for _, test := range tests {
+		got, err := ParseEndpoint(test.endpoint)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("ParseEndpoint(%q) - got valid: %t, want valid: %t, err: %v",
+				test.endpoint, valid, test.valid, err)
+		}
+		if got != test.want {
+			t.Errorf("ParseEndpoint(%q) - got: %q, want: %q", test.endpoint, got, test.want)
+		}
+	}
+}
+
+func TestConnectWithRefreshTokenCustomEndpoint(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/token" {
+			fmt.Fprint(w, `{"access_token": "AccessToken", "token_type": "Bearer", "expires_in": 3600}`)
+			return
+		}
+		fmt.Fprint(w, `{"resourceName": "customers/1234567890"}`)
+	}))
+	defer server.Close()
+
+	c := &Config{
+		CustomerID:    "1234567890",
+		Endpoint:      server.URL,
+		HTTPClient:    server.Client(),
+		TokenEndpoint: server.URL + "/token",
+		ConfigFile: diag.ConfigFile{
+			ConfigKeys: diag.ConfigKeys{RefreshToken: "GoodRefreshToken"},
+		},
+	}
+	if _, err := c.connectWithRefreshToken(context.Background()); err != nil {
+		t.Fatalf("connectWithRefreshToken - got error: %s", err)
+	}
+
+	want := []string{"POST /token", "GET /" + DefaultAPIVersion + "/customers/1234567890"}
+	if fmt.Sprint(requests) != fmt.Sprint(want) {
+		t.Errorf("requests - got: %v, want: %v", requests, want)
+	}
+}
+
+func TestEndpointURLs(t *testing.T) {
+	tests := []struct {
+		desc string
+		c    *Config
+		want []string
+	}{
+		{
+			desc: "Installed app flow",
+			c:    &Config{OAuthType: InstalledApp},
+			want: []string{"https://accounts.google.com/", "https://oauth2.googleapis.com/", "https://googleads.googleapis.com/"},
+		},
+		{
+			desc: "Service account flow",
+			c:    &Config{OAuthType: ServiceAccount},
+			want: []string{"https://oauth2.googleapis.com/", "https://googleads.googleapis.com/"},
+		},
+		{
+			desc: "Overridden endpoints",
+			c:    &Config{OAuthType: Web, Endpoint: "http://localhost:8080", TokenEndpoint: "http://localhost:8080/token"},
+			want: []string{"http://localhost:8080/", "http://localhost:8080/"},
+		},
+		{
+			desc: "Access token",
+			c:    &Config{OAuthType: InstalledApp, AccessToken: "AccessToken"},
+			want: []string{"https://googleads.googleapis.com/"},
+		},
+	}
+
+	for _, test := range tests {
+		if got := test.c.endpointURLs(); fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%s: endpointURLs - got: %v, want: %v", test.desc, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains the structures and functions to parse the error
+// envelope returned by the Google Ads API.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIError is an error response of the Google Ads API. Its error string is
+// the response body with the secret values redacted.
+type APIError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Header contains the Retry-After and the quota headers of the response.
+	Header http.Header
+	// Body is the response body with the secret values redacted.
+	Body string
+}
+
+func (e *APIError) Error() string {
+	return e.Body
+}
+
+// newAPIError returns an APIError from the response and its redacted body.
+func newAPIError(resp *http.Response, body string) *APIError {
+	header := make(http.Header)
+	for k, v := range resp.Header {
+		if k == "Retry-After" || strings.HasPrefix(k, "X-Goog-") ||
+			strings.Contains(strings.ToLower(k), "quota") ||
+			strings.HasPrefix(k, "X-Ratelimit-") {
+			header[k] = v
+		}
+	}
+	return &APIError{StatusCode: resp.StatusCode, Header: header, Body: body}
+}
+
+// RetryAfter returns the delay before retrying that is suggested in the
+// Retry-After header or in the retry delay of the error envelope. It returns
+// false when there's no suggestion.
+func (e *APIError) RetryAfter() (time.Duration, bool) {
+	if v := e.Header.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second, true
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			if d := time.Until(t); d > 0 {
+				return d, true
+			}
+			return 0, true
+		}
+	}
+
+	if ae, ok := parseAPIError(e.Body); ok {
+		if _, detail, _ := decodeAPIError(ae); detail.RetryDelay != "" {
+			if d, err := time.ParseDuration(detail.RetryDelay); err == nil {
+				return d, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// apiError is the error envelope of a Google Ads API JSON response.
+// https://developers.google.com/google-ads/api/docs/best-practices/error-types
+type apiError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+		Details []struct {
+			// RetryDelay is set in the google.rpc.RetryInfo detail.
+			RetryDelay string `json:"retryDelay"`
+			// Reason is set in the google.rpc.ErrorInfo detail, e.g.
+			// ACCESS_TOKEN_SCOPE_INSUFFICIENT.
+			Reason string         `json:"reason"`
+			Errors []apiErrorItem `json:"errors"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+// apiErrorItem is a single GoogleAdsError in the error envelope.
+type apiErrorItem struct {
+	// ErrorCode maps the error category (e.g. authenticationError) to the
+	// enum value (e.g. DEVELOPER_TOKEN_PARAMETER_MISSING).
+	ErrorCode map[string]string      `json:"errorCode"`
+	Message   string                 `json:"message"`
+	Trigger   map[string]interface{} `json:"trigger"`
+	Location  struct {
+		FieldPathElements []struct {
+			FieldName string `json:"fieldName"`
+		} `json:"fieldPathElements"`
+	} `json:"location"`
+	Details struct {
+		QuotaErrorDetails struct {
+			RateScope  string `json:"rateScope"`
+			RateName   string `json:"rateName"`
+			RetryDelay string `json:"retryDelay"`
+		} `json:"quotaErrorDetails"`
+	} `json:"details"`
+}
+
+// errorDetail is the information extracted from an error that is useful
+// for diagnosing it.
+type errorDetail struct {
+	// Status is the RPC status, e.g. PERMISSION_DENIED.
+	Status string
+	// ErrorCode is the error category and enum value, e.g.
+	// authenticationError.DEVELOPER_TOKEN_PARAMETER_MISSING.
+	ErrorCode string
+	// Message is the human readable error message.
+	Message string
+	// Field is the path of the request field that caused the error.
+	Field string
+	// Trigger is the value that triggered the error.
+	Trigger string
+	// RateName is the name of the exceeded rate limit, e.g. "Requests per
+	// developer token".
+	RateName string
+	// RetryDelay is the delay suggested before retrying, e.g. 30s.
+	RetryDelay string
+	// Remediation is the recommended action to fix the error.
+	Remediation string
+}
+
+// errorCodes maps the Google Ads API error enum values to the error codes.
+var errorCodes = map[string]int32{
+	"CANNOT_BE_EXECUTED_BY_MANAGER_ACCOUNT": AccessNotPermittedForManagerAccount,
+	"CUSTOMER_NOT_ENABLED":                  CustomerNotEnabled,
+	"CUSTOMER_NOT_FOUND":                    CustomerNotAccessible,
+	"DEVELOPER_TOKEN_INVALID":               InvalidDevToken,
+	"DEVELOPER_TOKEN_NOT_APPROVED":          DevTokenNotApproved,
+	"DEVELOPER_TOKEN_NOT_ON_ALLOWLIST":      DevTokenNotAllowlisted,
+	"DEVELOPER_TOKEN_PARAMETER_MISSING":     MissingDevToken,
+	"DEVELOPER_TOKEN_PROHIBITED":            DevTokenProhibited,
+	"INCOMPLETE_SIGNUP":                     CustomerNotEnabled,
+	"INVALID_CUSTOMER_ID":                   InvalidCustomerID,
+	"OAUTH_TOKEN_EXPIRED":                   AccessTokenExpired,
+	"RESOURCE_EXHAUSTED":                    RateLimited,
+	"RESOURCE_TEMPORARILY_EXHAUSTED":        RateLimited,
+	"USER_PERMISSION_DENIED":                UserPermissionDenied,
+}
+
+// errorReasons maps the reasons in the google.rpc.ErrorInfo detail to the
+// error codes. They are used when none of the error enum values are
+// recognized, since an error with a reason has no GoogleAdsError.
+var errorReasons = map[string]int32{
+	"ACCESS_TOKEN_EXPIRED":            AccessTokenExpired,
+	"ACCESS_TOKEN_SCOPE_INSUFFICIENT": InsufficientScope,
+}
+
+// statusCodes maps the RPC status to the error codes. It is only used when
+// none of the error enum values are recognized.
+var statusCodes = map[string]int32{
+	"PERMISSION_DENIED":  GoogleAdsAPIDisabled,
+	"RESOURCE_EXHAUSTED": RateLimited,
+	"UNAUTHENTICATED":    Unauthenticated,
+}
+
+// parseAPIError unmarshals the Google Ads API error envelope in errstr.
+// It returns false when errstr is not an error envelope.
+func parseAPIError(errstr string) (*apiError, bool) {
+	var e apiError
+	if err := json.Unmarshal([]byte(errstr), &e); err != nil {
+		return nil, false
+	}
+	if e.Error.Status == "" && e.Error.Message == "" {
+		return nil, false
+	}
+	return &e, true
+}
+
+// decodeAPIError determines the error code and the error detail from the
+// Google Ads API error envelope. It returns false when no error code can be
+// determined from the envelope.
+func decodeAPIError(e *apiError) (int32, *errorDetail, bool) {
+	detail := &errorDetail{Status: e.Error.Status, Message: e.Error.Message}
+	for _, d := range e.Error.Details {
+		if d.RetryDelay != "" {
+			detail.RetryDelay = d.RetryDelay
+		}
+	}
+
+	for _, d := range e.Error.Details {
+		for _, item := range d.Errors {
+			for category, value := range item.ErrorCode {
+				if code, ok := errorCodes[value]; ok {
+					detail.ErrorCode = category + "." + value
+					detail.Message = item.Message
+					detail.Field = item.field()
+					detail.Trigger = item.trigger()
+					if q := item.Details.QuotaErrorDetails; q.RetryDelay != "" {
+						detail.RetryDelay = q.RetryDelay
+					}
+					detail.RateName = item.Details.QuotaErrorDetails.RateName
+					return code, detail, true
+				}
+			}
+		}
+	}
+
+	for _, d := range e.Error.Details {
+		if code, ok := errorReasons[d.Reason]; ok {
+			detail.ErrorCode = d.Reason
+			return code, detail, true
+		}
+	}
+
+	if code, ok := statusCodes[e.Error.Status]; ok {
+		return code, detail, true
+	}
+	return UnknownError, detail, false
+}
+
+// field returns the dot separated path of the field that caused the error.
+func (item *apiErrorItem) field() string {
+	var names []string
+	for _, e := range item.Location.FieldPathElements {
+		names = append(names, e.FieldName)
+	}
+	return strings.Join(names, ".")
+}
+
+// trigger returns the value that triggered the error, regardless of its
+// type (e.g. stringValue or int64Value).
+func (item *apiErrorItem) trigger() string {
+	keys := make([]string, 0, len(item.Trigger))
+	for k := range item.Trigger {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var values []string
+	for _, k := range keys {
+		values = append(values, fmt.Sprint(item.Trigger[k]))
+	}
+	return strings.Join(values, ", ")
+}
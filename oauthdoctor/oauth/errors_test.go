@@ -0,0 +1,269 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDecodeErrorDetail(t *testing.T) {
+	tests := []struct {
+		desc       string
+		err        string
+		want       int32
+		errorCode  string
+		field      string
+		trigger    string
+		retryDelay string
+	}{
+		{
+			desc: "Missing developer token with UNAUTHENTICATED status",
+			err: `{"error": {"code": 401, "message": "Request is missing required authentication credential.", "status": "UNAUTHENTICATED",
+				"details": [{"errors": [{"errorCode": {"authenticationError": "DEVELOPER_TOKEN_PARAMETER_MISSING"},
+				"message": "Developer token parameter is missing."}]}]}}`,
+			want:      MissingDevToken,
+			errorCode: "authenticationError.DEVELOPER_TOKEN_PARAMETER_MISSING",
+		},
+		{
+			desc: "Developer token not approved for non-test accounts",
+			err: `{"error": {"code": 403, "message": "The caller does not have permission", "status": "PERMISSION_DENIED",
+				"details": [{"errors": [{"errorCode": {"authorizationError": "DEVELOPER_TOKEN_NOT_APPROVED"},
+				"message": "The developer token is only approved for use with test accounts. To access non-test accounts, apply for Basic or Standard access."}]}]}}`,
+			want:      DevTokenNotApproved,
+			errorCode: "authorizationError.DEVELOPER_TOKEN_NOT_APPROVED",
+		},
+		{
+			desc: "Developer token access level does not allow the request",
+			err: `{"error": {"code": 403, "message": "The caller does not have permission", "status": "PERMISSION_DENIED",
+				"details": [{"errors": [{"errorCode": {"authorizationError": "DEVELOPER_TOKEN_NOT_ON_ALLOWLIST"},
+				"message": "The developer token is not on the allow-list."}]}]}}`,
+			want:      DevTokenNotAllowlisted,
+			errorCode: "authorizationError.DEVELOPER_TOKEN_NOT_ON_ALLOWLIST",
+		},
+		{
+			desc: "Developer token used with another Google Cloud project",
+			err: `{"error": {"code": 403, "message": "The caller does not have permission", "status": "PERMISSION_DENIED",
+				"details": [{"errors": [{"errorCode": {"authorizationError": "DEVELOPER_TOKEN_PROHIBITED"},
+				"message": "Developer token is not allowed with project sent in the request."}]}]}}`,
+			want:      DevTokenProhibited,
+			errorCode: "authorizationError.DEVELOPER_TOKEN_PROHIBITED",
+		},
+		{
+			desc: "Developer token is not valid",
+			err: `{"error": {"code": 401, "message": "Request is missing required authentication credential.", "status": "UNAUTHENTICATED",
+				"details": [{"errors": [{"errorCode": {"authenticationError": "DEVELOPER_TOKEN_INVALID"},
+				"message": "The developer token is not valid."}]}]}}`,
+			want:      InvalidDevToken,
+			errorCode: "authenticationError.DEVELOPER_TOKEN_INVALID",
+		},
+		{
+			desc: "User permission denied with PERMISSION_DENIED status",
+			err: `{"error": {"code": 403, "message": "The caller does not have permission", "status": "PERMISSION_DENIED",
+				"details": [{"errors": [{"errorCode": {"authorizationError": "USER_PERMISSION_DENIED"},
+				"message": "User doesn't have permission to access customer."}]}]}}`,
+			want:      UserPermissionDenied,
+			errorCode: "authorizationError.USER_PERMISSION_DENIED",
+		},
+		{
+			desc: "Message containing a misleading substring",
+			err: `{"error": {"code": 400, "message": "Account invalid_grant is not valid", "status": "INVALID_ARGUMENT",
+				"details": [{"errors": [{"errorCode": {"requestError": "INVALID_CUSTOMER_ID"},
+				"message": "Invalid customer ID.", "trigger": {"stringValue": "123"},
+				"location": {"fieldPathElements": [{"fieldName": "customer_id"}]}}]}]}}`,
+			want:      InvalidCustomerID,
+			errorCode: "requestError.INVALID_CUSTOMER_ID",
+			field:     "customer_id",
+			trigger:   "123",
+		},
+		{
+			desc: "Well-formed customer ID that cannot be found",
+			err: `{"error": {"code": 400, "message": "Request contains an invalid argument.", "status": "INVALID_ARGUMENT",
+				"details": [{"errors": [{"errorCode": {"requestError": "CUSTOMER_NOT_FOUND"},
+				"message": "Customer not found."}]}]}}`,
+			want:      CustomerNotAccessible,
+			errorCode: "requestError.CUSTOMER_NOT_FOUND",
+		},
+		{
+			desc: "Customer account not enabled",
+			err: `{"error": {"code": 403, "message": "The caller does not have permission", "status": "PERMISSION_DENIED",
+				"details": [{"errors": [{"errorCode": {"authorizationError": "CUSTOMER_NOT_ENABLED"},
+				"message": "The customer account can't be accessed because it is not yet enabled or has been deactivated."}]}]}}`,
+			want:      CustomerNotEnabled,
+			errorCode: "authorizationError.CUSTOMER_NOT_ENABLED",
+		},
+		{
+			desc: "Customer account with an incomplete sign-up",
+			err: `{"error": {"code": 403, "message": "The caller does not have permission", "status": "PERMISSION_DENIED",
+				"details": [{"errors": [{"errorCode": {"authorizationError": "INCOMPLETE_SIGNUP"},
+				"message": "Signup not complete."}]}]}}`,
+			want:      CustomerNotEnabled,
+			errorCode: "authorizationError.INCOMPLETE_SIGNUP",
+		},
+		{
+			desc: "Rate limit exceeded with a retry delay",
+			err: `{"error": {"code": 429, "message": "Resource has been exhausted (e.g. check quota).", "status": "RESOURCE_EXHAUSTED",
+				"details": [{"errors": [{"errorCode": {"quotaError": "RESOURCE_EXHAUSTED"},
+				"message": "Too many requests. Retry in 30 seconds.",
+				"details": {"quotaErrorDetails": {"rateScope": "DEVELOPER", "rateName": "Requests per developer token", "retryDelay": "30s"}}}]}]}}`,
+			want:       RateLimited,
+			errorCode:  "quotaError.RESOURCE_EXHAUSTED",
+			retryDelay: "30s",
+		},
+		{
+			desc: "Rate limit exceeded with RetryInfo",
+			err: `{"error": {"code": 429, "message": "Resource has been exhausted (e.g. check quota).", "status": "RESOURCE_EXHAUSTED",
+				"details": [{"@type": "type.googleapis.com/google.rpc.RetryInfo", "retryDelay": "5s"}]}}`,
+			want:       RateLimited,
+			retryDelay: "5s",
+		},
+		{
+			desc: "Google Ads API disabled without details",
+			err:  `{"error": {"code": 403, "message": "Google Ads API has not been used in project 123.", "status": "PERMISSION_DENIED"}}`,
+			want: GoogleAdsAPIDisabled,
+		},
+		{
+			desc: "Token endpoint error falls back to substring matching",
+			err: "oauth2: cannot fetch token: 400 Bad Request\n" +
+				`Response: {"error": "invalid_grant", "error_description": "Bad Request"}`,
+			want: InvalidRefreshToken,
+		},
+		{
+			desc: "Consent denied in the auth dialog",
+			err:  (&redirectError{Code: "access_denied"}).Error(),
+			want: ConsentDenied,
+		},
+		{
+			desc: "App restricted by the Google Workspace administrator",
+			err:  (&redirectError{Code: "admin_policy_enforced", Description: "Access blocked"}).Error(),
+			want: ConsentDenied,
+		},
+		{
+			desc: "Sign-in not completed in the auth dialog",
+			err:  (&redirectError{Code: "login_required"}).Error(),
+			want: ConsentDenied,
+		},
+		{
+			desc: "Auth dialog opened in an embedded browser",
+			err:  (&redirectError{Code: "disallowed_useragent"}).Error(),
+			want: ConsentDenied,
+		},
+		{
+			desc: "Subject token file of an external account is missing",
+			err:  `oauth2/google: failed to open credential file "/var/run/token"`,
+			want: SubjectTokenError,
+		},
+		{
+			desc: "Workload identity pool provider rejects the audience",
+			err: "oauth2/google: status code 400: " +
+				`{"error": "invalid_grant", "error_description": "The audience in ID Token does not match the expected audience."}`,
+			want: AudienceMismatch,
+		},
+		{
+			desc: "External account cannot impersonate the service account",
+			err: "oauth2/google: status code 403: " +
+				`{"error": {"code": 403, "message": "Permission 'iam.serviceAccounts.getAccessToken' denied on resource", "status": "PERMISSION_DENIED"}}`,
+			want: ImpersonationDenied,
+		},
+		{
+			desc: "Access token without the Google Ads API scope",
+			err: `{"error": {"code": 403, "message": "Request had insufficient authentication scopes.", "status": "PERMISSION_DENIED",
+				"details": [{"@type": "type.googleapis.com/google.rpc.ErrorInfo", "reason": "ACCESS_TOKEN_SCOPE_INSUFFICIENT"}]}}`,
+			want:      InsufficientScope,
+			errorCode: "ACCESS_TOKEN_SCOPE_INSUFFICIENT",
+		},
+		{
+			desc: "Refresh token granted without the Google Ads API scope",
+			err:  "insufficient_scope: the access token was granted https://www.googleapis.com/auth/drive without the https://www.googleapis.com/auth/adwords scope",
+			want: InsufficientScope,
+		},
+		{
+			desc: "Access token given directly has expired",
+			err: `{"error": {"code": 401, "message": "Request had invalid authentication credentials.", "status": "UNAUTHENTICATED",
+				"details": [{"errors": [{"errorCode": {"authenticationError": "OAUTH_TOKEN_EXPIRED"},
+				"message": "The OAuth access token has expired."}]}]}}`,
+			want:      AccessTokenExpired,
+			errorCode: "authenticationError.OAUTH_TOKEN_EXPIRED",
+		},
+		{
+			desc: "TLS handshake timeout",
+			err:  `Post "https://oauth2.googleapis.com/token": net/http: TLS handshake timeout`,
+			want: NetworkUnreachable,
+		},
+		{
+			desc: "Connection refused on Windows",
+			err: `Post "https://oauth2.googleapis.com/token": dial tcp 142.250.1.95:443: connectex: ` +
+				`No connection could be made because the target machine actively refused it.`,
+			want: NetworkUnreachable,
+		},
+	}
+
+	c := &Config{}
+	for _, test := range tests {
+		got, detail := c.decodeErrorDetail(errors.New(test.err))
+		if got != test.want {
+			t.Errorf("%s: code - got: %d, want: %d", test.desc, got, test.want)
+		}
+		if detail.ErrorCode != test.errorCode || detail.Field != test.field ||
+			detail.Trigger != test.trigger || detail.RetryDelay != test.retryDelay {
+			t.Errorf("%s: detail - got: %+v, want error code: %q, field: %q, trigger: %q, retry delay: %q",
+				test.desc, detail, test.errorCode, test.field, test.trigger, test.retryDelay)
+		}
+	}
+}
+
+func TestAPIErrorRetryAfter(t *testing.T) {
+	tests := []struct {
+		desc   string
+		header http.Header
+		body   string
+		want   time.Duration
+		wantOK bool
+	}{
+		{
+			desc:   "Retry-After in seconds",
+			header: http.Header{"Retry-After": {"30"}},
+			want:   30 * time.Second,
+			wantOK: true,
+		},
+		{
+			desc:   "Retry-After date in the past",
+			header: http.Header{"Retry-After": {"Wed, 21 Oct 2015 07:28:00 GMT"}},
+			want:   0,
+			wantOK: true,
+		},
+		{
+			desc: "Retry delay in the error envelope",
+			body: `{"error": {"code": 429, "status": "RESOURCE_EXHAUSTED",
+				"details": [{"errors": [{"errorCode": {"quotaError": "RESOURCE_EXHAUSTED"},
+				"details": {"quotaErrorDetails": {"retryDelay": "45s"}}}]}]}}`,
+			want:   45 * time.Second,
+			wantOK: true,
+		},
+		{
+			desc: "No suggestion",
+			body: `{"error": {"code": 503, "status": "UNAVAILABLE"}}`,
+		},
+	}
+
+	for _, test := range tests {
+		e := &APIError{StatusCode: http.StatusTooManyRequests, Header: test.header, Body: test.body}
+		got, ok := e.RetryAfter()
+		if got != test.want || ok != test.wantOK {
+			t.Errorf("%s: got: %s, %t, want: %s, %t", test.desc, got, ok, test.want, test.wantOK)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains the process exit codes of the diagnosed errors.
+
+// These are the stable exit codes of the diagnosed errors, so that scripts
+// and monitoring can tell the class of an error. 1 is used when the doctor
+// cannot run, e.g. with an invalid flag.
+//
+//	 0     Success
+//	 2     Unknown error
+//	10-19  OAuth2 credentials and Google Cloud project
+//	20-29  Network
+//	30-39  Google Ads account access
+//	40-49  Developer token
+//	50-59  Configuration file
+//	60-69  OAuth2 access tokens
+//	70-79  Interrupted diagnosis
+const (
+	ExitSuccess      = 0
+	ExitUnknownError = 2
+
+	ExitInvalidClientInfo                   = 10
+	ExitInvalidRefreshToken                 = 11
+	ExitGoogleAdsAPIDisabled                = 12
+	ExitUnauthorized                        = 13
+	ExitServiceAccountUnauthorized          = 14
+	ExitConsentDenied                       = 15
+	ExitAccessNotPermittedForManagerAccount = 16
+	ExitSubjectTokenError                   = 17
+	ExitAudienceMismatch                    = 18
+	ExitImpersonationDenied                 = 19
+
+	ExitNetworkUnreachable = 20
+	ExitRequestTimeout     = 21
+	ExitCertificateError   = 22
+	ExitRateLimited        = 23
+	ExitClockSkew          = 25
+
+	ExitInvalidCustomerID     = 30
+	ExitCustomerNotAccessible = 31
+	ExitUserPermissionDenied  = 32
+	ExitUnauthenticated       = 33
+	ExitCustomerNotEnabled    = 34
+
+	ExitMissingDevToken        = 40
+	ExitDevTokenNotApproved    = 41
+	ExitDevTokenNotAllowlisted = 42
+	ExitDevTokenProhibited     = 43
+	ExitInvalidDevToken        = 44
+
+	ExitUnfilledConfigValue = 50
+	ExitConfigFileError     = 51
+	ExitConfigWarning       = 52
+	ExitRedirectURIMismatch = 53
+
+	ExitInsufficientScope  = 60
+	ExitAccessTokenExpired = 61
+
+	ExitDeadlineExceeded = 70
+	ExitCanceled         = 71
+)
+
+// exitCodes maps the error codes to the exit codes.
+var exitCodes = map[int32]int{
+	AccessNotPermittedForManagerAccount: ExitAccessNotPermittedForManagerAccount,
+	AccessTokenExpired:                  ExitAccessTokenExpired,
+	AudienceMismatch:                    ExitAudienceMismatch,
+	Canceled:                            ExitCanceled,
+	CertificateError:                    ExitCertificateError,
+	ClockSkew:                           ExitClockSkew,
+	ConfigFileError:                     ExitConfigFileError,
+	ConfigWarning:                       ExitConfigWarning,
+	ConsentDenied:                       ExitConsentDenied,
+	CustomerNotAccessible:               ExitCustomerNotAccessible,
+	CustomerNotEnabled:                  ExitCustomerNotEnabled,
+	DeadlineExceeded:                    ExitDeadlineExceeded,
+	DevTokenNotAllowlisted:              ExitDevTokenNotAllowlisted,
+	DevTokenNotApproved:                 ExitDevTokenNotApproved,
+	DevTokenProhibited:                  ExitDevTokenProhibited,
+	GoogleAdsAPIDisabled:                ExitGoogleAdsAPIDisabled,
+	ImpersonationDenied:                 ExitImpersonationDenied,
+	InsufficientScope:                   ExitInsufficientScope,
+	InvalidClientInfo:                   ExitInvalidClientInfo,
+	InvalidDevToken:                     ExitInvalidDevToken,
+	InvalidCustomerID:                   ExitInvalidCustomerID,
+	InvalidRefreshToken:                 ExitInvalidRefreshToken,
+	MissingDevToken:                     ExitMissingDevToken,
+	NetworkUnreachable:                  ExitNetworkUnreachable,
+	RateLimited:                         ExitRateLimited,
+	RedirectURIMismatch:                 ExitRedirectURIMismatch,
+	RequestTimeout:                      ExitRequestTimeout,
+	ServiceAccountUnauthorized:          ExitServiceAccountUnauthorized,
+	SubjectTokenError:                   ExitSubjectTokenError,
+	Unauthenticated:                     ExitUnauthenticated,
+	Unauthorized:                        ExitUnauthorized,
+	UnfilledConfigValue:                 ExitUnfilledConfigValue,
+	UnknownError:                        ExitUnknownError,
+	UserPermissionDenied:                ExitUserPermissionDenied,
+}
+
+// ExitCode returns the process exit code of the given error code. Every
+// error code has a distinct non-zero exit code.
+func ExitCode(code int32) int {
+	if exit, ok := exitCodes[code]; ok {
+		return exit
+	}
+	return ExitUnknownError
+}
+
+// exitCategories are the classes of the exit codes in the ranges above,
+// keyed by their tens digit.
+var exitCategories = map[int]string{
+	1: "credentials",
+	2: "network",
+	3: "account access",
+	4: "developer token",
+	5: "config file",
+	6: "access token",
+	7: "interrupted",
+}
+
+// ErrorCategory returns the class of the given error code as in the exit
+// code ranges, e.g. "credentials" for InvalidRefreshToken, or "unknown".
+func ErrorCategory(code int32) string {
+	if category, ok := exitCategories[ExitCode(code)/10]; ok {
+		return category
+	}
+	return "unknown"
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import "testing"
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		code int32
+		want int
+	}{
+		{InvalidClientInfo, 10},
+		{InvalidRefreshToken, 11},
+		{GoogleAdsAPIDisabled, 12},
+		{NetworkUnreachable, 20},
+		{ClockSkew, 25},
+		{CustomerNotEnabled, 34},
+		{InvalidDevToken, 44},
+		{ConfigWarning, 52},
+		{RedirectURIMismatch, 53},
+		{InsufficientScope, 60},
+		{AccessTokenExpired, 61},
+		{DeadlineExceeded, 70},
+		{Canceled, 71},
+		{UnknownError, 2},
+		{-1, 2},
+	}
+
+	for _, tt := range tests {
+		if got := ExitCode(tt.code); got != tt.want {
+			t.Errorf("ExitCode(%d) = %d, want %d", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestExitCodeDistinct(t *testing.T) {
+	seen := make(map[int]int32)
+	for code := range errorNames {
+		exit := ExitCode(code)
+		if exit == ExitSuccess || exit == 1 {
+			t.Errorf("ExitCode(%d) = %d, want a code other than 0 and 1", code, exit)
+		}
+		if other, ok := seen[exit]; ok {
+			t.Errorf("ExitCode(%d) = ExitCode(%d) = %d, want distinct codes", code, other, exit)
+		}
+		seen[exit] = code
+	}
+}
+
+func TestErrorCategory(t *testing.T) {
+	tests := []struct {
+		code int32
+		want string
+	}{
+		{InvalidRefreshToken, "credentials"},
+		{RequestTimeout, "network"},
+		{CustomerNotAccessible, "account access"},
+		{DevTokenNotApproved, "developer token"},
+		{UnfilledConfigValue, "config file"},
+		{AccessTokenExpired, "access token"},
+		{Canceled, "interrupted"},
+		{DeadlineExceeded, "interrupted"},
+		{UnknownError, "unknown"},
+	}
+
+	for _, tt := range tests {
+		if got := ErrorCategory(tt.code); got != tt.want {
+			t.Errorf("ErrorCategory(%d) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
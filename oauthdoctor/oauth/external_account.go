@@ -0,0 +1,195 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains functions that are specific to Workload Identity
+// Federation, where the JSON key file is an external account credential
+// file. The workload exchanges a token of its own identity provider, e.g.
+// AWS, Azure or an OIDC provider, for a Google access token, instead of using
+// a service account key.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"oauthdoctor/diag"
+	"regexp"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// externalAccountType is the type of the external account credential files.
+const externalAccountType = "external_account"
+
+// workloadIdentityURL is the guide to configure Workload Identity Federation.
+const workloadIdentityURL = "https://cloud.google.com/iam/docs/workload-identity-federation"
+
+// impersonationRe matches the service account email in the service account
+// impersonation URL of an external account credential file.
+var impersonationRe = regexp.MustCompile(`/serviceAccounts/([^/:]+):generateAccessToken`)
+
+// externalAccountFile is the part of an external account credential file
+// that is used in the guidance.
+type externalAccountFile struct {
+	Type                           string `json:"type"`
+	Audience                       string `json:"audience"`
+	ServiceAccountImpersonationURL string `json:"service_account_impersonation_url"`
+	CredentialSource               struct {
+		EnvironmentID string `json:"environment_id"`
+		File          string `json:"file"`
+		URL           string `json:"url"`
+	} `json:"credential_source"`
+}
+
+// readExternalAccount reads the JSON key file in the configuration file. It
+// returns false when the file cannot be read or is not an external account
+// credential file.
+func (c *Config) readExternalAccount() (*externalAccountFile, bool) {
+	if c.ConfigFile.JSONKeyFilePath == "" {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(c.ConfigFile.JSONKeyFilePath)
+	if err != nil {
+		return nil, false
+	}
+	var f externalAccountFile
+	if err := json.Unmarshal(data, &f); err != nil || f.Type != externalAccountType {
+		return nil, false
+	}
+	return &f, true
+}
+
+// isExternalAccount returns true when the JSON key file in the configuration
+// file is an external account credential file.
+func (c *Config) isExternalAccount() bool {
+	_, ok := c.readExternalAccount()
+	return ok
+}
+
+// simulateExternalAccountFlow simulates the Workload Identity Federation flow
+// to see if it succeeds or fails. If it fails, it will try to examine the
+// error and guide the user to fix it. Then it retries to connect again and
+// prints the result of the last attempt, see fixAndRetry.
+func (c *Config) simulateExternalAccountFlow(ctx context.Context) {
+	log.Print("The JSON key file is an external account credential file for " +
+		"Workload Identity Federation.")
+	if c.ConfigFile.ImpersonatedEmail != "" {
+		c.warnf("%s (%s) is not used with an external account credential "+
+			"file, since domain-wide delegation requires a service account key.",
+			diag.ImpersonatedEmail, c.ConfigFile.GetConfigKeysInLang(diag.ImpersonatedEmail))
+	}
+
+	accountInfo, err := c.connectWithExternalAccount(ctx)
+	accountInfo, err = c.fixAndRetry(ctx, accountInfo, err, func(error) (*bytes.Buffer, error) {
+		return c.connectWithExternalAccount(ctx)
+	})
+
+	c.finish(accountInfo, err)
+}
+
+// connectWithExternalAccount loads the external account credential file
+// given in the client lib config file, exchanges the subject token of the
+// workload for an access token and gets the account info.
+func (c *Config) connectWithExternalAccount(ctx context.Context) (*bytes.Buffer, error) {
+	key, err := ioutil.ReadFile(c.ConfigFile.JSONKeyFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	oauth2Ctx := c.oauth2Context(ctx)
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	creds, err := google.CredentialsFromJSON(oauth2Ctx, key, c.scopes()...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Mint the token up front, so the subject token and the token exchange
+	// errors are reported before the Google Ads API request is made.
+	// The token source of the credentials caches its token, so a new one is
+	// parsed for each new token
+	ts := c.tokenSource(func() oauth2.TokenSource {
+		if fresh, err := google.CredentialsFromJSON(oauth2Ctx, key, c.scopes()...); err == nil {
+			return fresh.TokenSource
+		}
+		return creds.TokenSource
+	})
+	if _, err := ts.Token(); err != nil {
+		return nil, err
+	}
+
+	accountInfo, err := c.getAccount(ctx, c.newClient(ts))
+	c.cacheToken(ts, err)
+	return accountInfo, err
+}
+
+// diagnoseExternalAccount prints the guidance about the external account
+// credential file for the Workload Identity Federation errors.
+func (c *Config) diagnoseExternalAccount(code int32) {
+	f, ok := c.readExternalAccount()
+	if !ok {
+		f = &externalAccountFile{}
+	}
+
+	switch code {
+	case SubjectTokenError:
+		diag.Error("The subject token of your workload cannot be retrieved, " +
+			"so it cannot be exchanged for a Google access token.")
+		source := f.CredentialSource
+		switch {
+		case strings.HasPrefix(source.EnvironmentID, "aws"):
+			log.Print("The credential file gets the subject token from AWS. " +
+				"Please check that the doctor runs on AWS with an IAM role " +
+				"attached, or that the AWS_REGION, AWS_ACCESS_KEY_ID and " +
+				"AWS_SECRET_ACCESS_KEY environment variables are set.")
+		case source.File != "":
+			log.Print("The credential file reads the subject token from " +
+				source.File + ". Please check that the file exists, is readable, " +
+				"and contains an unexpired token.")
+		case source.URL != "":
+			log.Print("The credential file gets the subject token from " +
+				source.URL + ". Please check that the doctor runs where this " +
+				"URL is available, e.g. on the Azure VM or in the GKE pod.")
+		default:
+			log.Print("The credential_source in the credential file is missing " +
+				"or not supported.")
+		}
+	case AudienceMismatch:
+		diag.Error("The token exchange rejected the audience " + f.Audience +
+			" in your credential file.")
+		log.Print("The audience must be the full resource name of the workload " +
+			"identity pool provider, e.g. //iam.googleapis.com/projects/" +
+			"PROJECT_NUMBER/locations/global/workloadIdentityPools/POOL_ID/" +
+			"providers/PROVIDER_ID, and the provider must accept the tokens of " +
+			"your workload. Please regenerate the credential file with " +
+			"`gcloud iam workload-identity-pools create-cred-config`.")
+	case ImpersonationDenied:
+		account := "the service account"
+		if m := impersonationRe.FindStringSubmatch(f.ServiceAccountImpersonationURL); m != nil {
+			account = m[1]
+		}
+		diag.Error("Your workload is not allowed to impersonate " + account + ".")
+		log.Print("Please grant the Workload Identity User role " +
+			"(roles/iam.workloadIdentityUser) on " + account + " to the " +
+			"principal of your workload, and check that the IAM Service Account " +
+			"Credentials API is enabled in your Google Cloud project.")
+	}
+	log.Print("Please follow this guide to configure Workload Identity " +
+		"Federation: " + workloadIdentityURL)
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"oauthdoctor/diag"
+)
+
+// writeExternalAccount writes an external account credential file whose
+// subject token is read from tokenFile and exchanged at tokenURL.
+func writeExternalAccount(t *testing.T, dir, tokenFile, tokenURL string) string {
+	path := filepath.Join(dir, "credentials.json")
+	content := fmt.Sprintf(`{
+		"type": "external_account",
+		"audience": "//iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/pool/providers/provider",
+		"subject_token_type": "urn:ietf:params:oauth:token-type:jwt",
+		"token_url": %q,
+		"credential_source": {"file": %q}
+	}`, tokenURL, tokenFile)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Error writing the credential file: %s", err)
+	}
+	return path
+}
+
+func TestSimulateExternalAccountFlow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oauthdoctor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/sts" {
+			fmt.Fprint(w, `{"access_token": "AccessToken", "issued_token_type": "urn:ietf:params:oauth:token-type:access_token",
+				"token_type": "Bearer", "expires_in": 3600}`)
+			return
+		}
+		fmt.Fprint(w, `{"resourceName": "customers/1234567890"}`)
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(dir, "token")
+	tests := []struct {
+		desc       string
+		writeToken bool
+		want       int32
+	}{
+		{desc: "Subject token exchanged", writeToken: true, want: -1},
+		{desc: "Subject token file missing", want: SubjectTokenError},
+	}
+
+	for _, test := range tests {
+		os.Remove(tokenFile)
+		if test.writeToken {
+			if err := ioutil.WriteFile(tokenFile, []byte("SubjectToken"), 0600); err != nil {
+				t.Fatalf("Error writing the subject token: %s", err)
+			}
+		}
+		c := &Config{
+			CustomerID:     "1234567890",
+			Endpoint:       server.URL,
+			HTTPClient:     server.Client(),
+			NonInteractive: true,
+			OAuthType:      ServiceAccount,
+			ConfigFile: diag.ConfigFile{
+				ConfigKeys: diag.ConfigKeys{
+					DevToken:        "GoodDevToken",
+					JSONKeyFilePath: writeExternalAccount(t, dir, tokenFile, server.URL+"/sts"),
+				},
+			},
+		}
+		c.reachable = true
+
+		got := c.SimulateOAuthFlow(context.Background())
+		if test.want < 0 {
+			if !got.Success {
+				t.Errorf("%s: got: %+v, want success", test.desc, got)
+			}
+			continue
+		}
+		if got.Success || got.Code != test.want {
+			t.Errorf("%s: got: %+v, want code: %d", test.desc, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains the setup guides of the client libraries, which are
+// linked in the remediations for the language of the configuration file.
+
+import (
+	"log"
+
+	"oauthdoctor/diag"
+)
+
+// libraryGuides are the guides of a client library.
+type libraryGuides struct {
+	// config explains the configuration file of the library.
+	config string
+	// desktop generates a refresh token for the installed app flow with the
+	// example of the library.
+	desktop string
+	// web generates a refresh token for the web flow.
+	web string
+	// service sets up a service account.
+	service string
+}
+
+const (
+	// cloudProjectGuide creates an OAuth client ID and secret.
+	cloudProjectGuide = "https://developers.google.com/google-ads/api/docs/oauth/cloud-project"
+	// devTokenGuide retrieves the developer token from the API Center.
+	devTokenGuide = "https://developers.google.com/google-ads/api/docs/get-started/dev-token"
+	// refreshTokenGuide explains the OAuth flows that generate a refresh
+	// token.
+	refreshTokenGuide = "https://developers.google.com/google-ads/api/docs/oauth/overview"
+)
+
+// clientLibGuides are the guides of the client libraries by language. The
+// Node.js library is not maintained by Google, so the generic guides are
+// used for it.
+var clientLibGuides = map[string]libraryGuides{
+	"dotnet": newLibraryGuides("dotnet"),
+	"java":   newLibraryGuides("java"),
+	"php":    newLibraryGuides("php"),
+	"python": newLibraryGuides("python"),
+	"ruby":   newLibraryGuides("ruby"),
+}
+
+// newLibraryGuides returns the guides of the client library whose docs are
+// in the given directory of the Google Ads API docs.
+func newLibraryGuides(dir string) libraryGuides {
+	base := "https://developers.google.com/google-ads/api/docs/client-libs/" + dir + "/"
+	return libraryGuides{
+		config:  base + "configuration",
+		desktop: base + "oauth-desktop",
+		web:     base + "oauth-web",
+		service: base + "oauth-service",
+	}
+}
+
+// guides returns the guides of the client library of the configuration file,
+// and false when the language is unknown.
+func (c *Config) guides() (libraryGuides, bool) {
+	g, ok := clientLibGuides[c.ConfigFile.Lang]
+	return g, ok
+}
+
+// credentialsGuide returns the guide to set up the OAuth client ID and
+// secret of the OAuth type with the client library.
+func (c *Config) credentialsGuide() string {
+	g, ok := c.guides()
+	switch {
+	case !ok:
+		return cloudProjectGuide
+	case c.OAuthType == Web:
+		return g.web
+	case c.OAuthType == ServiceAccount:
+		return g.service
+	default:
+		return g.desktop
+	}
+}
+
+// printDevTokenGuide prints the guide to retrieve the developer token, and
+// the one of the configuration file of the client library.
+func (c *Config) printDevTokenGuide() {
+	log.Print("Please follow this guide to retrieve your developer token: " + devTokenGuide)
+	if g, ok := c.guides(); ok {
+		log.Printf("It is set as %s in the configuration file of the client library: %s",
+			c.ConfigFile.GetConfigKeysInLang(diag.DevToken), g.config)
+	}
+}
+
+// printRefreshTokenGuide prints the guide to generate a refresh token with
+// the client library, e.g. to regenerate it outside of the doctor.
+func (c *Config) printRefreshTokenGuide() {
+	guide := refreshTokenGuide
+	if g, ok := c.guides(); ok {
+		guide = g.desktop
+		if c.OAuthType == Web {
+			guide = g.web
+		}
+	}
+	log.Print("To generate a refresh token with your client library, follow this guide: " + guide)
+}
@@ -0,0 +1,41 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"testing"
+
+	"oauthdoctor/diag"
+)
+
+func TestCredentialsGuide(t *testing.T) {
+	tests := []struct {
+		lang      string
+		oauthType string
+		want      string
+	}{
+		{lang: "python", oauthType: InstalledApp, want: "https://developers.google.com/google-ads/api/docs/client-libs/python/oauth-desktop"},
+		{lang: "java", oauthType: Web, want: "https://developers.google.com/google-ads/api/docs/client-libs/java/oauth-web"},
+		{lang: "dotnet", oauthType: ServiceAccount, want: "https://developers.google.com/google-ads/api/docs/client-libs/dotnet/oauth-service"},
+		{lang: "node", oauthType: InstalledApp, want: cloudProjectGuide},
+		{lang: "", oauthType: InstalledApp, want: cloudProjectGuide},
+	}
+
+	for _, test := range tests {
+		c := &Config{OAuthType: test.oauthType, ConfigFile: diag.ConfigFile{Lang: test.lang}}
+		if got := c.credentialsGuide(); got != test.want {
+			t.Errorf("credentialsGuide(%q, %q) - got: %s, want: %s", test.lang, test.oauthType, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,900 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"oauthdoctor/diag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeTransport is a http.RoundTripper that returns a canned response.
+type fakeTransport struct {
+	status int
+	body   string
+}
+
+func (f *fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: f.status,
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(strings.NewReader(f.body)),
+		Request:    req,
+	}, nil
+}
+
+// hangingTransport is a http.RoundTripper that never responds until the
+// request is canceled.
+type hangingTransport struct{}
+
+func (hangingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+// fakeConfig returns a Config whose HTTP client responds with the given
+// status and body.
+func fakeConfig(status int, body string) *Config {
+	return &Config{
+		CustomerID: "1234567890",
+		HTTPClient: &http.Client{Transport: &fakeTransport{status: status, body: body}},
+	}
+}
+
+func TestValidateAPIVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		valid   bool
+	}{
+		{version: "v17", valid: true},
+		{version: "v1", valid: true},
+		{version: "17", valid: false},
+		{version: "v0", valid: false},
+		{version: "v17.1", valid: false},
+		{version: "V17", valid: false},
+		{version: "", valid: false},
+	}
+
+	for _, test := range tests {
+		err := ValidateAPIVersion(test.version)
+		if got := err == nil; got != test.valid {
+			t.Errorf("ValidateAPIVersion(%q) - got valid: %t, want valid: %t, err: %v",
+				test.version, got, test.valid, err)
+		}
+	}
+}
+
+func TestGetAccountDecodeError(t *testing.T) {
+	tests := []struct {
+		desc string
+		body string
+		want int32
+	}{
+		{
+			desc: "Invalid customer ID",
+			body: `{"error": {"code": 400, "message": "Invalid customer ID.", "status": "INVALID_ARGUMENT",
+				"details": [{"errors": [{"errorCode": {"requestError": "INVALID_CUSTOMER_ID"}}]}]}}`,
+			want: InvalidCustomerID,
+		},
+		{
+			desc: "Google Ads API disabled",
+			body: `{"error": {"code": 403, "message": "Google Ads API has not been used in project 123.", "status": "PERMISSION_DENIED"}}`,
+			want: GoogleAdsAPIDisabled,
+		},
+	}
+
+	for _, test := range tests {
+		c := fakeConfig(http.StatusBadRequest, test.body)
+		_, err := c.getAccount(context.Background(), c.httpClient())
+		if err == nil {
+			t.Errorf("%s: getAccount returned no error", test.desc)
+			continue
+		}
+		if got := c.decodeError(err); got != test.want {
+			t.Errorf("%s: decodeError - got: %d, want: %d", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestGetAccountSuccess(t *testing.T) {
+	const body = `{"resourceName": "customers/1234567890", "id": "1234567890"}`
+	c := fakeConfig(http.StatusOK, body)
+	got, err := c.getAccount(context.Background(), c.httpClient())
+	if err != nil {
+		t.Fatalf("getAccount returned error: %s", err)
+	}
+	if got.String() != body {
+		t.Errorf("getAccount - got: %s, want: %s", got, body)
+	}
+}
+
+// headerTransport is a http.RoundTripper that records the headers of the
+// last request.
+type headerTransport struct {
+	header http.Header
+}
+
+func (f *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.header = req.Header
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader(`{"resourceName": "customers/1234567890"}`)),
+		Request:    req,
+	}, nil
+}
+
+func TestGetAccountHeaders(t *testing.T) {
+	transport := &headerTransport{}
+	c := &Config{CustomerID: "1234567890", HTTPClient: &http.Client{Transport: transport}}
+	c.ConfigFile.DevToken = "GoodDevToken"
+	c.ConfigFile.LoginCustomerID = "1111111111"
+	c.ConfigFile.LinkedCustomerID = "2222222222"
+
+	if _, err := c.getAccount(context.Background(), c.httpClient()); err != nil {
+		t.Fatalf("getAccount returned error: %s", err)
+	}
+	want := map[string]string{
+		"developer-token":    "GoodDevToken",
+		"login-customer-id":  "1111111111",
+		"linked-customer-id": "2222222222",
+	}
+	for k, v := range want {
+		if got := transport.header.Get(k); got != v {
+			t.Errorf("header %s - got: %q, want: %q", k, got, v)
+		}
+	}
+}
+
+func TestGetAccountTimeout(t *testing.T) {
+	c := &Config{
+		CustomerID: "1234567890",
+		HTTPClient: &http.Client{Transport: hangingTransport{}},
+		Timeout:    time.Millisecond,
+	}
+	_, err := c.getAccount(context.Background(), c.httpClient())
+	if err == nil {
+		t.Fatal("getAccount returned no error")
+	}
+	if got := c.decodeError(err); got != RequestTimeout {
+		t.Errorf("decodeError - got: %d, want: %d, err: %s", got, RequestTimeout, err)
+	}
+}
+
+func TestOAuth2ClientExchangeError(t *testing.T) {
+	c := fakeConfig(http.StatusBadRequest,
+		`{"error": "invalid_grant", "error_description": "Malformed auth code."}`)
+	c.ConfigFile.ClientID = "GoodClientID"
+	c.ConfigFile.ClientSecret = "GoodClientSecret"
+
+	client, refreshToken, err := c.oauth2Client(context.Background(), "http://127.0.0.1", "BadCode")
+	if err == nil {
+		t.Fatalf("oauth2Client returned no error - client: %v, refresh token: %s", client, refreshToken)
+	}
+	if got := c.decodeError(err); got != InvalidRefreshToken {
+		t.Errorf("decodeError - got: %d, want: %d, err: %s", got, InvalidRefreshToken, err)
+	}
+}
+
+func TestListAccessibleCustomers(t *testing.T) {
+	c := fakeConfig(http.StatusOK,
+		`{"resourceNames": ["customers/1234567890", "customers/9876543210"]}`)
+	got, err := c.listAccessibleCustomers(context.Background(), c.httpClient())
+	if err != nil {
+		t.Fatalf("listAccessibleCustomers returned error: %s", err)
+	}
+	want := []string{"1234567890", "9876543210"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("listAccessibleCustomers - got: %v, want: %v", got, want)
+	}
+}
+
+func TestSimulateOAuthFlow(t *testing.T) {
+	tests := []struct {
+		desc    string
+		status  int
+		body    string
+		success bool
+		code    int32
+	}{
+		{
+			desc:    "Success",
+			status:  http.StatusOK,
+			body:    `{"access_token": "AccessToken", "token_type": "Bearer", "expires_in": 3600, "resourceName": "customers/1234567890"}`,
+			success: true,
+		},
+		{
+			desc:   "Invalid refresh token",
+			status: http.StatusBadRequest,
+			body:   `{"error": "invalid_grant", "error_description": "Bad Request"}`,
+			code:   InvalidRefreshToken,
+		},
+	}
+
+	for _, test := range tests {
+		c := fakeConfig(test.status, test.body)
+		c.NonInteractive = true
+		c.OAuthType = InstalledApp
+		c.ConfigFile = diag.ConfigFile{
+			Lang: "python",
+			ConfigKeys: diag.ConfigKeys{
+				DevToken:     "GoodDevToken",
+				ClientID:     "GoodClientID",
+				ClientSecret: "GoodClientSecret",
+				RefreshToken: "GoodRefreshToken",
+			},
+		}
+
+		got := c.SimulateOAuthFlow(context.Background())
+		if got.Success != test.success {
+			t.Errorf("%s: success - got: %t, want: %t", test.desc, got.Success, test.success)
+		}
+		if !test.success && got.Code != test.code {
+			t.Errorf("%s: code - got: %d, want: %d", test.desc, got.Code, test.code)
+		}
+		if got.ConfigModified {
+			t.Errorf("%s: config is modified in non-interactive mode", test.desc)
+		}
+	}
+}
+
+func TestSimulateOAuthFlowPreflight(t *testing.T) {
+	c := fakeConfig(http.StatusOK, "")
+	c.NonInteractive = true
+	c.OAuthType = InstalledApp
+	c.ConfigFile = diag.ConfigFile{
+		Lang:       "python",
+		ConfigKeys: diag.ConfigKeys{DevToken: "INSERT_DEVELOPER_TOKEN_HERE"},
+	}
+
+	got := c.SimulateOAuthFlow(context.Background())
+	if got.Success || got.Code != UnfilledConfigValue {
+		t.Errorf("got: %+v, want code: %d", got, UnfilledConfigValue)
+	}
+	want := []string{"developer_token", "client_id", "client_secret"}
+	if !reflect.DeepEqual(got.Fields, want) {
+		t.Errorf("fields - got: %v, want: %v", got.Fields, want)
+	}
+}
+
+// tokenCountingTransport is a http.RoundTripper that issues access tokens
+// and counts the token requests. Other requests get the account info.
+type tokenCountingTransport struct {
+	tokenRequests int
+}
+
+func (f *tokenCountingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := `{"resourceName": "customers/1234567890"}`
+	if strings.Contains(req.URL.Path, "token") {
+		f.tokenRequests++
+		body = `{"access_token": "AccessToken", "token_type": "Bearer", "expires_in": 3600}`
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func TestSimulateOAuthFlows(t *testing.T) {
+	transport := &tokenCountingTransport{}
+	c := &Config{
+		HTTPClient:     &http.Client{Transport: transport},
+		NonInteractive: true,
+		OAuthType:      InstalledApp,
+		ConfigFile: diag.ConfigFile{
+			Lang: "python",
+			ConfigKeys: diag.ConfigKeys{
+				DevToken:     "GoodDevToken",
+				ClientID:     "GoodClientID",
+				ClientSecret: "GoodClientSecret",
+				RefreshToken: "GoodRefreshToken",
+			},
+		},
+	}
+
+	cids := []string{"1234567890", "0987654321", "1111111111"}
+	got := c.SimulateOAuthFlows(context.Background(), cids)
+	if !got.Success || len(got.Reports) != len(cids) {
+		t.Fatalf("SimulateOAuthFlows - got: %+v, want %d successful reports", got, len(cids))
+	}
+	for i, r := range got.Reports {
+		if r.CustomerID != cids[i] || !r.Success {
+			t.Errorf("report %d - got: %+v, want success for %s", i, r, cids[i])
+		}
+	}
+	// The access token is reused for all the customer IDs
+	if transport.tokenRequests != 1 {
+		t.Errorf("token requests - got: %d, want: 1", transport.tokenRequests)
+	}
+}
+
+func TestSimulateOAuthFlowMissingConfigFile(t *testing.T) {
+	c := fakeConfig(http.StatusOK, "")
+	c.NonInteractive = true
+	c.OAuthType = InstalledApp
+	c.ConfigFile = diag.ConfigFile{
+		Filepath: os.TempDir(),
+		Filename: "missing-google-ads.yaml",
+		Lang:     "python",
+	}
+
+	got := c.SimulateOAuthFlow(context.Background())
+	if got.Success || got.Code != ConfigFileError {
+		t.Errorf("got: %+v, want code: %d", got, ConfigFileError)
+	}
+	if !strings.Contains(got.Message, "missing-google-ads.yaml") {
+		t.Errorf("message - got: %s, want the path of the config file", got.Message)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oauthdoctor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := "refresh_token: OldRefreshToken\n"
+	configFp := filepath.Join(dir, "google-ads.yaml")
+	if err := ioutil.WriteFile(configFp, []byte(content), 0600); err != nil {
+		t.Fatalf("Error writing config file: %s", err)
+	}
+
+	c := &Config{
+		DryRun: true,
+		ConfigFile: diag.ConfigFile{
+			Filename:   "google-ads.yaml",
+			Filepath:   dir,
+			Lang:       "python",
+			ConfigKeys: diag.ConfigKeys{RefreshToken: "OldRefreshToken"},
+		},
+	}
+	c.replaceRefreshToken("NewRefreshToken")
+	c.replaceDevToken()
+	c.replaceCloudCredentials([]string{diag.ClientID, diag.ClientSecret})
+
+	if got, _ := ioutil.ReadFile(configFp); string(got) != content {
+		t.Errorf("config file is modified in dry-run mode - got: %s, want: %s", got, content)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("config file is backed up in dry-run mode - got %d files, want 1", len(files))
+	}
+	if c.ConfigFile.RefreshToken != "OldRefreshToken" {
+		t.Errorf("refresh token is replaced in dry-run mode - got: %s", c.ConfigFile.RefreshToken)
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	for _, answer := range []string{"Y\n", "y\r\n", " yes \n", "YES"} {
+		if !isYes(answer) {
+			t.Errorf("isYes(%q) - got: false, want: true", answer)
+		}
+	}
+	for _, answer := range []string{"", "\n", "n", "no", "yeah", "Y Y"} {
+		if isYes(answer) {
+			t.Errorf("isYes(%q) - got: true, want: false", answer)
+		}
+	}
+
+	c := &Config{AssumeYes: true}
+	if !c.confirm("Replace?", false) {
+		t.Errorf("confirm with AssumeYes - got: false, want: true")
+	}
+	// Non-interactive mode never asks, even with AssumeYes
+	c.NonInteractive = true
+	if c.confirm("Replace?", false) {
+		t.Errorf("confirm in non-interactive mode - got: true, want the default false")
+	}
+}
+
+func TestFixAndRetry(t *testing.T) {
+	tests := []struct {
+		desc           string
+		nonInteractive bool
+		fix            bool
+		want           int
+	}{
+		{desc: "Retried while each attempt fixes the configuration", fix: true, want: maxFixAttempts},
+		{desc: "Retried once without a fix", want: 1},
+		{desc: "Not retried in non-interactive mode", nonInteractive: true, fix: true, want: 0},
+	}
+
+	apiErr := &APIError{StatusCode: http.StatusTooManyRequests, Body: `{"error": {"code": 429, "status": "RESOURCE_EXHAUSTED"}}`}
+	for _, test := range tests {
+		c := &Config{NonInteractive: test.nonInteractive}
+		attempts := 0
+		_, err := c.fixAndRetry(context.Background(), nil, apiErr, func(error) (*bytes.Buffer, error) {
+			attempts++
+			if test.fix {
+				c.ConfigFile.DevToken = fmt.Sprintf("DevToken%d", attempts)
+			}
+			return nil, apiErr
+		})
+		if err != apiErr {
+			t.Errorf("%s: got error: %v, want: %v", test.desc, err, apiErr)
+		}
+		if attempts != test.want {
+			t.Errorf("%s: attempts - got: %d, want: %d", test.desc, attempts, test.want)
+		}
+	}
+}
+
+func TestFixAndRetryLastError(t *testing.T) {
+	rateErr := &APIError{StatusCode: http.StatusTooManyRequests, Body: `{"error": {"code": 429, "status": "RESOURCE_EXHAUSTED"}}`}
+	notApprovedErr := errors.New(`{"error": {"code": 403, "status": "PERMISSION_DENIED",
+		"details": [{"errors": [{"errorCode": {"authorizationError": "DEVELOPER_TOKEN_NOT_APPROVED"}}]}]}}`)
+	c := &Config{CustomerID: "1234567890", Prompter: &scriptedPrompter{}}
+	attempts := 0
+	_, err := c.fixAndRetry(context.Background(), nil, rateErr, func(error) (*bytes.Buffer, error) {
+		attempts++
+		return nil, notApprovedErr
+	})
+	if err != notApprovedErr {
+		t.Errorf("got error: %v, want: %v", err, notApprovedErr)
+	}
+	// The new error is diagnosed and retried once, and then diagnosed again
+	if attempts != 2 {
+		t.Errorf("attempts - got: %d, want: 2", attempts)
+	}
+	if c.report.Code != DevTokenNotApproved || c.report.Remediation != remediations[DevTokenNotApproved] {
+		t.Errorf("report - got: %s %q, want the diagnosis of DevTokenNotApproved",
+			c.report.Error, c.report.Remediation)
+	}
+}
+
+func TestGetLoginCustomerIDWithDashes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oauthdoctor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	configFp := filepath.Join(dir, "google-ads.yaml")
+	content := "developer_token: GoodDevToken\nlogin_customer_id: 111-222-3333\n"
+	if err := ioutil.WriteFile(configFp, []byte(content), 0600); err != nil {
+		t.Fatalf("Error writing config file: %s", err)
+	}
+	cfg, err := diag.ParseConfigFile("python", configFp)
+	if err != nil {
+		t.Fatalf("ParseConfigFile - got error: %s", err)
+	}
+
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("login-customer-id")
+		fmt.Fprint(w, `{"resourceName": "customers/1234567890"}`)
+	}))
+	defer server.Close()
+
+	c := &Config{CustomerID: "1234567890", Endpoint: server.URL, ConfigFile: cfg}
+	if _, err := c.getAccount(context.Background(), server.Client()); err != nil {
+		t.Fatalf("getAccount - got error: %s", err)
+	}
+	if header != "1112223333" {
+		t.Errorf("login-customer-id - got: %q, want: 1112223333", header)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oauthdoctor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	configFp := filepath.Join(dir, "google-ads.yaml")
+	if err := ioutil.WriteFile(configFp, []byte("developer_token: FileDevToken\n"), 0600); err != nil {
+		t.Fatalf("Error writing config file: %s", err)
+	}
+
+	c := &Config{
+		ConfigFile: diag.ConfigFile{
+			Filename:   "google-ads.yaml",
+			Filepath:   dir,
+			Lang:       "python",
+			ConfigKeys: diag.ConfigKeys{DevToken: "EnteredDevToken"},
+		},
+	}
+	// The values of the file are used when it does not have the entered
+	// values
+	c.reloadConfig(diag.ConfigKeys{DevToken: "OldDevToken"})
+	if got := c.ConfigFile.DevToken; got != "FileDevToken" {
+		t.Errorf("developer token - got: %s, want: FileDevToken", got)
+	}
+}
+
+func TestReloadConfigLoginCustomerIDOverride(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oauthdoctor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := "developer_token: NewDevToken\nlogin_customer_id: 1112223333\n"
+	configFp := filepath.Join(dir, "google-ads.yaml")
+	if err := ioutil.WriteFile(configFp, []byte(content), 0600); err != nil {
+		t.Fatalf("Error writing config file: %s", err)
+	}
+
+	lcid := "4445556666"
+	c := &Config{
+		LoginCustomerID: &lcid,
+		ConfigFile: diag.ConfigFile{
+			Filename:   "google-ads.yaml",
+			Filepath:   dir,
+			Lang:       "python",
+			ConfigKeys: diag.ConfigKeys{DevToken: "NewDevToken", LoginCustomerID: lcid},
+		},
+	}
+	// The override is kept after a fix of another value
+	c.reloadConfig(diag.ConfigKeys{DevToken: "OldDevToken", LoginCustomerID: lcid})
+	if got := c.ConfigFile.LoginCustomerID; got != lcid {
+		t.Errorf("login customer ID - got: %s, want: %s", got, lcid)
+	}
+
+	// A new login customer ID replaces the override, not the file
+	keys := c.ConfigFile.ConfigKeys
+	c.replaceConfig(diag.LoginCustomerID, "7778889999")
+	c.reloadConfig(keys)
+	if got := c.ConfigFile.LoginCustomerID; got != "7778889999" {
+		t.Errorf("replaced login customer ID - got: %s, want: 7778889999", got)
+	}
+	if got, _ := ioutil.ReadFile(configFp); string(got) != content {
+		t.Errorf("config file - got: %s, want: %s", got, content)
+	}
+}
+
+func TestReplaceConfigCanceled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oauthdoctor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := "developer_token: OldDevToken\n"
+	configFp := filepath.Join(dir, "google-ads.yaml")
+	if err := ioutil.WriteFile(configFp, []byte(content), 0600); err != nil {
+		t.Fatalf("Error writing config file: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := &Config{
+		AssumeYes: true,
+		ConfigFile: diag.ConfigFile{
+			Filename:   "google-ads.yaml",
+			Filepath:   dir,
+			Lang:       "python",
+			ConfigKeys: diag.ConfigKeys{DevToken: "OldDevToken"},
+		},
+		ctx: ctx,
+	}
+	c.replaceConfig(diag.DevToken, "NewDevToken")
+	if got, _ := ioutil.ReadFile(configFp); string(got) != content {
+		t.Errorf("config file - got: %s, want: %s", got, content)
+	}
+}
+
+func TestSimulateOAuthFlowsDeadline(t *testing.T) {
+	// The Google Ads API request hangs until the deadline passes
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		<-r.Context().Done()
+	}))
+
+	c := &Config{
+		AccessToken:    "ya29.GoodAccessToken",
+		Endpoint:       server.URL,
+		HTTPClient:     server.Client(),
+		NonInteractive: true,
+		OAuthType:      InstalledApp,
+		Timeout:        time.Minute,
+		reachable:      true,
+		ConfigFile: diag.ConfigFile{
+			Lang:       "python",
+			ConfigKeys: diag.ConfigKeys{DevToken: "GoodDevToken"},
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	s := c.SimulateOAuthFlows(ctx, []string{"1234567890", "1112223333"})
+	server.Close()
+
+	if s.Success || !s.DeadlineExceeded {
+		t.Errorf("summary - got success %t and deadline exceeded %t, want false and true",
+			s.Success, s.DeadlineExceeded)
+	}
+	for _, r := range s.Reports {
+		if r.Code != DeadlineExceeded || r.Error != "DeadlineExceeded" || !r.DeadlineExceeded {
+			t.Errorf("report of %s - got: %+v, want DeadlineExceeded", r.CustomerID, r)
+		}
+	}
+	// The customer ID after the deadline is not requested
+	if requests != 1 {
+		t.Errorf("requests - got: %d, want: 1", requests)
+	}
+	if got := ExitCode(s.Reports[0].Code); got != ExitDeadlineExceeded {
+		t.Errorf("exit code - got: %d, want: %d", got, ExitDeadlineExceeded)
+	}
+}
+
+func TestSimulateOAuthFlowsCanceled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oauthdoctor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	content := "developer_token: ABCDEFGHIJKLMNOPQRSTUV\nclient_id: GoodClientID\n" +
+		"client_secret: GoodClientSecret\nrefresh_token: GoodRefreshToken\n"
+	configFp := filepath.Join(dir, "google-ads.yaml")
+	if err := ioutil.WriteFile(configFp, []byte(content), 0600); err != nil {
+		t.Fatalf("Error writing config file: %s", err)
+	}
+
+	// The token request hangs until the diagnosis is canceled, e.g. with
+	// Ctrl-C. The form is read so that the server notices the client closing
+	// the connection.
+	ctx, cancel := context.WithCancel(context.Background())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		cancel()
+		<-r.Context().Done()
+	}))
+
+	p := &scriptedPrompter{answers: []string{"NewDevToken", "y"}}
+	c := &Config{
+		Endpoint:      server.URL,
+		HTTPClient:    server.Client(),
+		OAuthType:     InstalledApp,
+		Prompter:      NewDeadlinePrompter(ctx, p),
+		Timeout:       time.Minute,
+		TokenEndpoint: server.URL + "/token",
+		reachable:     true,
+		ConfigFile: diag.ConfigFile{
+			Filename: "google-ads.yaml",
+			Filepath: dir,
+			Lang:     "python",
+			ConfigKeys: diag.ConfigKeys{DevToken: "ABCDEFGHIJKLMNOPQRSTUV", ClientID: "GoodClientID",
+				ClientSecret: "GoodClientSecret", RefreshToken: "GoodRefreshToken"},
+		},
+	}
+	s := c.SimulateOAuthFlows(ctx, []string{"1234567890", "1112223333"})
+	server.Close()
+
+	if s.Success || !s.Canceled {
+		t.Errorf("summary - got success %t and canceled %t, want false and true", s.Success, s.Canceled)
+	}
+	for _, r := range s.Reports {
+		if r.Code != Canceled || r.Error != "Canceled" || !r.Canceled {
+			t.Errorf("report of %s - got: %+v, want Canceled", r.CustomerID, r)
+		}
+	}
+	// The interrupted call is not diagnosed, so nothing is prompted or
+	// written to the config file
+	if len(p.labels) != 0 {
+		t.Errorf("prompts - got: %q, want none", p.labels)
+	}
+	if got, _ := ioutil.ReadFile(configFp); string(got) != content {
+		t.Errorf("config file - got: %s, want: %s", got, content)
+	}
+	if got := ExitCode(s.Reports[0].Code); got != ExitCanceled {
+		t.Errorf("exit code - got: %d, want: %d", got, ExitCanceled)
+	}
+}
+
+func TestCheckWarningsStrict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oauthdoctor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		desc       string
+		strict     bool
+		perm       os.FileMode
+		devToken   string
+		want       bool
+		wantFields []string
+	}{
+		{
+			desc:     "No warning",
+			strict:   true,
+			perm:     0600,
+			devToken: "ABCDEFGHIJKLMNOPQRSTUV",
+			want:     true,
+		},
+		{
+			desc:     "Warnings without strict mode",
+			perm:     0644,
+			devToken: "ShortToken",
+			want:     true,
+		},
+		{
+			desc:       "Malformed developer token in strict mode",
+			strict:     true,
+			perm:       0600,
+			devToken:   "ShortToken",
+			wantFields: []string{"developer_token"},
+		},
+		{
+			desc:     "Config file readable by others in strict mode",
+			strict:   true,
+			perm:     0644,
+			devToken: "ABCDEFGHIJKLMNOPQRSTUV",
+		},
+	}
+
+	for _, test := range tests {
+		configFp := filepath.Join(dir, "google-ads.yaml")
+		content := "developer_token: " + test.devToken + "\nclient_id: GoodClientID\nclient_secret: GoodClientSecret\n"
+		if err := ioutil.WriteFile(configFp, []byte(content), test.perm); err != nil {
+			t.Fatalf("Error writing config file: %s", err)
+		}
+		// WriteFile does not change the mode of an existing file
+		if err := os.Chmod(configFp, test.perm); err != nil {
+			t.Fatalf("Error changing the mode of the config file: %s", err)
+		}
+
+		c := &Config{
+			NonInteractive: true,
+			OAuthType:      InstalledApp,
+			Strict:         test.strict,
+			ConfigFile: diag.ConfigFile{
+				Filename: "google-ads.yaml",
+				Filepath: dir,
+				Lang:     "python",
+				ConfigKeys: diag.ConfigKeys{DevToken: test.devToken, ClientID: "GoodClientID",
+					ClientSecret: "GoodClientSecret"},
+			},
+		}
+		if got := c.checkWarnings(); got != test.want {
+			t.Errorf("%s: got: %t, want: %t", test.desc, got, test.want)
+		}
+		if test.want {
+			continue
+		}
+		if c.report.Code != ConfigWarning || !reflect.DeepEqual(c.report.Fields, test.wantFields) {
+			t.Errorf("%s: report - got: %s %v, want: ConfigWarning %v", test.desc,
+				c.report.Error, c.report.Fields, test.wantFields)
+		}
+	}
+}
+
+func TestWarnfRedacted(t *testing.T) {
+	c := &Config{
+		ConfigFile: diag.ConfigFile{
+			Lang:       "python",
+			ConfigKeys: diag.ConfigKeys{ClientSecret: "GoodClientSecret"},
+		},
+	}
+	c.warnf("The client secret %s has quotes.", "GoodClientSecret")
+	if len(c.report.Warnings) != 1 || strings.Contains(c.report.Warnings[0], "GoodClientSecret") {
+		t.Errorf("warnings - got: %q, want the client secret redacted", c.report.Warnings)
+	}
+}
+
+func TestCheckPermissionsOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oauthdoctor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	configFp := filepath.Join(dir, "google-ads.yaml")
+	if err := ioutil.WriteFile(configFp, []byte("developer_token: ABCDEFGHIJKLMNOPQRSTUV\n"), 0644); err != nil {
+		t.Fatalf("Error writing config file: %s", err)
+	}
+	if err := os.Chmod(configFp, 0644); err != nil {
+		t.Fatalf("Error changing the mode of the config file: %s", err)
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	c := &Config{
+		ConfigFile: diag.ConfigFile{
+			Filename:   "google-ads.yaml",
+			Filepath:   dir,
+			Lang:       "python",
+			ConfigKeys: diag.ConfigKeys{DevToken: "ABCDEFGHIJKLMNOPQRSTUV"},
+		},
+	}
+	// e.g. once per customer ID
+	for i := 0; i < 3; i++ {
+		c.report = Report{}
+		if !c.checkPermissions() {
+			t.Errorf("check %d - got: false, want: true", i)
+		}
+		if len(c.report.Warnings) != 1 {
+			t.Errorf("check %d: warnings - got: %q, want one", i, c.report.Warnings)
+		}
+	}
+	if n := strings.Count(logs.String(), "WARN"); n != 1 {
+		t.Errorf("printed warnings - got: %d, want: 1\n%s", n, logs.String())
+	}
+}
+
+func TestCheckWarningsReport(t *testing.T) {
+	tests := []struct {
+		desc       string
+		apiVersion string
+		keys       diag.ConfigKeys
+		want       []string
+	}{
+		{
+			desc: "No warning",
+			keys: diag.ConfigKeys{DevToken: "ABCDEFGHIJKLMNOPQRSTUV"},
+		},
+		{
+			desc: "Malformed developer token",
+			keys: diag.ConfigKeys{DevToken: "ShortToken"},
+			want: []string{"developer token looks malformed"},
+		},
+		{
+			desc: "Placeholder login customer ID",
+			keys: diag.ConfigKeys{DevToken: "ABCDEFGHIJKLMNOPQRSTUV",
+				LoginCustomerID: "INSERT_LOGIN_CUSTOMER_ID_HERE"},
+			want: []string{"LoginCustomerID (login_customer_id) in the configuration file is a placeholder"},
+		},
+		{
+			desc:       "Old API version",
+			apiVersion: "v1",
+			keys:       diag.ConfigKeys{DevToken: "ABCDEFGHIJKLMNOPQRSTUV"},
+			want:       []string{"version v1 may be deprecated"},
+		},
+		{
+			desc:       "Multiple warnings",
+			apiVersion: "v1",
+			keys:       diag.ConfigKeys{DevToken: "ShortToken", LinkedCustomerID: "INSERT_LINKED_CUSTOMER_ID_HERE"},
+			want:       []string{"developer token looks malformed", "LinkedCustomerID", "version v1"},
+		},
+	}
+
+	for _, test := range tests {
+		test.keys.ClientID = "GoodClientID"
+		test.keys.ClientSecret = "GoodClientSecret"
+		c := &Config{
+			APIVersion:     test.apiVersion,
+			NonInteractive: true,
+			OAuthType:      InstalledApp,
+			ConfigFile:     diag.ConfigFile{Lang: "python", ConfigKeys: test.keys},
+		}
+		if !c.checkWarnings() {
+			t.Errorf("%s: the warnings failed the diagnosis without strict mode", test.desc)
+		}
+		if len(c.report.Warnings) != len(test.want) {
+			t.Errorf("%s: got: %q, want %d warnings", test.desc, c.report.Warnings, len(test.want))
+			continue
+		}
+		for i, w := range test.want {
+			if !strings.Contains(c.report.Warnings[i], w) {
+				t.Errorf("%s: warning %d - got: %q, want it to contain %q", test.desc, i, c.report.Warnings[i], w)
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains the functions that search the account hierarchy of the
+// accessible manager accounts for the customer ID, in order to suggest the
+// login customer ID. When the customer ID is not found because some of the
+// searches failed, the accounts of these searches are suggested instead.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"oauthdoctor/diag"
+)
+
+// hierarchySearch is the result of searchHierarchy.
+type hierarchySearch struct {
+	// manager is the first accessible manager account that has the customer
+	// ID in its hierarchy, and row is the result row of the customer ID.
+	manager string
+	row     json.RawMessage
+	found   bool
+	// failed are the accessible accounts whose hierarchy cannot be searched,
+	// so the customer ID may still be one of their clients.
+	failed []string
+}
+
+// searchHierarchy queries the fields of the customer ID in the account
+// hierarchy of the accessible manager accounts. The search stops at the first
+// manager account that has the customer ID in its hierarchy.
+func (c *Config) searchHierarchy(ctx context.Context, client *http.Client, fields string) hierarchySearch {
+	var h hierarchySearch
+	ids, err := c.listAccessibleCustomers(ctx, client)
+	if err != nil {
+		log.Printf("Cannot list accessible customers: %s", err)
+		return h
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM customer_client "+
+		"WHERE customer_client.id = %s", fields, c.CustomerID)
+	for _, id := range ids {
+		if id == c.CustomerID {
+			continue
+		}
+		// The query fails for the accounts that cannot be used as the login
+		// customer, and returns no rows for the accounts that do not have
+		// the customer ID in their hierarchy
+		buf, err := c.search(ctx, client, id, query)
+		if err != nil {
+			h.failed = append(h.failed, id)
+			continue
+		}
+		var resp struct {
+			Results []json.RawMessage `json:"results"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &resp); err == nil && len(resp.Results) > 0 {
+			h.manager, h.row, h.found = id, resp.Results[0], true
+			return h
+		}
+	}
+	return h
+}
+
+// suggestLoginCustomerID searches the account hierarchy of the accessible
+// manager accounts with the last authorized client, and suggests setting
+// the login customer ID to the manager account that has the customer ID in
+// its hierarchy. Unless in non-interactive mode, it offers to replace the
+// login customer ID in the configuration file. When the customer ID is not
+// found because some of the searches failed, the accounts of these searches
+// are suggested instead, see suggestManagers. It returns true when a login
+// customer ID is suggested.
+func (c *Config) suggestLoginCustomerID(ctx context.Context) bool {
+	if c.client == nil {
+		return false
+	}
+	log.Printf("Searching the accessible manager accounts for %s...", c.CustomerID)
+	h := c.searchHierarchy(ctx, c.client, "customer_client.id")
+	if !h.found {
+		return c.suggestManagers(h.failed)
+	}
+	manager := h.manager
+	if manager == c.ConfigFile.LoginCustomerID {
+		return false
+	}
+
+	field := c.ConfigFile.GetConfigKeysInLang(diag.LoginCustomerID)
+	log.Printf("The account %s is a client of the manager account %s, which "+
+		"the login email has access to. Set %s in the configuration file to %s, "+
+		"so that it is sent in the login-customer-id header.",
+		c.CustomerID, manager, field, manager)
+	c.report.Remediation = fmt.Sprintf("Set the login customer ID (%s) to %s.", field, manager)
+	if c.NonInteractive {
+		return true
+	}
+	if c.DryRun {
+		c.replaceConfig(diag.LoginCustomerID, manager)
+		return true
+	}
+
+	if !c.confirm(fmt.Sprintf("Set %s to %s?", field, manager), false) {
+		log.Print("Login customer ID is NOT replaced")
+		return false
+	}
+	c.replaceConfig(diag.LoginCustomerID, manager)
+	return true
+}
+
+// suggestManagers suggests setting the login customer ID to one of the
+// accessible accounts whose account hierarchy cannot be searched, since the
+// customer ID may be one of their clients. Unless in non-interactive mode, it
+// offers to replace the login customer ID in the configuration file with one
+// of them. It returns true when the login customer ID is replaced, or
+// suggested in non-interactive and dry-run modes.
+func (c *Config) suggestManagers(accounts []string) bool {
+	var managers []string
+	for _, id := range accounts {
+		if id != c.ConfigFile.LoginCustomerID {
+			managers = append(managers, id)
+		}
+	}
+	if len(managers) == 0 {
+		return false
+	}
+
+	field := c.ConfigFile.GetConfigKeysInLang(diag.LoginCustomerID)
+	list := strings.Join(managers, ", ")
+	log.Printf("The account hierarchies of %s, which the login email has "+
+		"direct access to, cannot be searched. If %s is a client of one of these "+
+		"manager accounts, set %s in the configuration file to the ID of that "+
+		"manager account, so that it is sent in the login-customer-id header.",
+		list, c.CustomerID, field)
+	if len(managers) == 1 {
+		c.report.Remediation = fmt.Sprintf("Set the login customer ID (%s) to %s.", field, managers[0])
+	} else {
+		c.report.Remediation = fmt.Sprintf("Set the login customer ID (%s) to the "+
+			"manager account of %s: one of %s.", field, c.CustomerID, list)
+	}
+	if c.NonInteractive {
+		return true
+	}
+	if c.DryRun {
+		if len(managers) == 1 {
+			c.replaceConfig(diag.LoginCustomerID, managers[0])
+		} else {
+			log.Printf("Dry run: would prompt for one of %s, and replace %s in "+
+				"the configuration file", list, field)
+		}
+		return true
+	}
+
+	if len(managers) == 1 {
+		if !c.confirm(fmt.Sprintf("Set %s to %s?", field, managers[0]), false) {
+			log.Print("Login customer ID is NOT replaced")
+			return false
+		}
+		c.replaceConfig(diag.LoginCustomerID, managers[0])
+		return true
+	}
+	for {
+		log.Printf("Enter one of the manager accounts %s, or press <Enter> to skip", list)
+		input, err := c.prompter().Prompt("New Login Customer ID")
+		if input == "" {
+			return false
+		}
+		if id, verr := diag.NormalizeCustomerID(input); verr == nil && diag.Contains(managers, id) {
+			c.replaceConfig(diag.LoginCustomerID, id)
+			return true
+		}
+		diag.Errorf("%s is not one of the manager accounts %s.", input, list)
+		if err != nil {
+			return false
+		}
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"oauthdoctor/diag"
+)
+
+// hierarchyTransport is a http.RoundTripper that serves the accessible
+// customers and the account hierarchy of the managers.
+type hierarchyTransport struct {
+	accessible string
+	// clients maps the manager IDs to the search results of their clients.
+	// The search of the other accounts fails.
+	clients map[string]string
+}
+
+func (f *hierarchyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	status, body := http.StatusOK, f.accessible
+	if strings.HasSuffix(req.URL.Path, "/googleAds:search") {
+		manager := strings.Split(strings.TrimPrefix(req.URL.Path, "/"+DefaultAPIVersion+"/customers/"), "/")[0]
+		if lcid := req.Header.Get("login-customer-id"); lcid != manager {
+			return nil, fmt.Errorf("login-customer-id is %q, want: %s", lcid, manager)
+		}
+		query, _ := ioutil.ReadAll(req.Body)
+		var ok bool
+		if !strings.Contains(string(query), "FROM customer_client") {
+			return nil, fmt.Errorf("query %q, want a customer_client query", query)
+		}
+		if body, ok = f.clients[manager]; !ok {
+			status = http.StatusForbidden
+			body = `{"error": {"code": 403, "message": "The caller does not have permission", "status": "PERMISSION_DENIED"}}`
+		}
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func TestSuggestLoginCustomerID(t *testing.T) {
+	tests := []struct {
+		desc    string
+		lcid    string
+		clients map[string]string
+		want    string
+	}{
+		{
+			desc:    "Client of an accessible manager",
+			clients: map[string]string{"2222222222": `{"results": [{"customerClient": {"id": "1234567890"}}]}`},
+			want:    "2222222222",
+		},
+		{
+			desc:    "Not in the hierarchy of any manager",
+			clients: map[string]string{"1111111111": `{}`, "2222222222": `{}`},
+		},
+		{
+			desc:    "Login customer ID is already the manager",
+			lcid:    "2222222222",
+			clients: map[string]string{"2222222222": `{"results": [{"customerClient": {"id": "1234567890"}}]}`},
+		},
+	}
+
+	for _, test := range tests {
+		transport := &hierarchyTransport{
+			accessible: `{"resourceNames": ["customers/1111111111", "customers/2222222222"]}`,
+			clients:    test.clients,
+		}
+		c := &Config{
+			CustomerID:     "1234567890",
+			NonInteractive: true,
+			ConfigFile: diag.ConfigFile{
+				Lang:       "python",
+				ConfigKeys: diag.ConfigKeys{DevToken: "GoodDevToken", LoginCustomerID: test.lcid},
+			},
+		}
+		c.client = &http.Client{Transport: transport}
+
+		if got := c.suggestLoginCustomerID(context.Background()); got != (test.want != "") {
+			t.Errorf("%s: suggestLoginCustomerID - got: %t, want: %t", test.desc, got, test.want != "")
+		}
+		if test.want != "" && !strings.Contains(c.report.Remediation, test.want) {
+			t.Errorf("%s: remediation - got: %q, want it to contain: %s",
+				test.desc, c.report.Remediation, test.want)
+		}
+	}
+}
+
+func TestSuggestManagers(t *testing.T) {
+	tests := []struct {
+		desc     string
+		lcid     string
+		clients  map[string]string
+		answers  []string
+		dryRun   bool
+		want     bool
+		wantLCID string
+	}{
+		{
+			desc:     "One failed search",
+			clients:  map[string]string{"1111111111": `{}`, "3333333333": `{}`},
+			answers:  []string{"y"},
+			want:     true,
+			wantLCID: "2222222222",
+		},
+		{
+			desc:    "Declined",
+			clients: map[string]string{"1111111111": `{}`, "3333333333": `{}`},
+			answers: []string{"n"},
+		},
+		{
+			desc:     "Several failed searches",
+			clients:  map[string]string{"1111111111": `{}`},
+			answers:  []string{"1111111111", "333-333-3333"},
+			want:     true,
+			wantLCID: "3333333333",
+		},
+		{
+			desc:     "Login customer ID is already the only failed search",
+			lcid:     "2222222222",
+			clients:  map[string]string{"1111111111": `{}`, "3333333333": `{}`},
+			wantLCID: "2222222222",
+		},
+		{
+			desc:    "Not in the hierarchy of any account",
+			clients: map[string]string{"1111111111": `{}`, "2222222222": `{}`, "3333333333": `{}`},
+		},
+		{
+			desc:    "Dry run",
+			clients: map[string]string{"1111111111": `{}`, "3333333333": `{}`},
+			dryRun:  true,
+			want:    true,
+		},
+	}
+
+	for _, test := range tests {
+		c := &Config{
+			CustomerID: "1234567890",
+			DryRun:     test.dryRun,
+			Prompter:   &scriptedPrompter{answers: test.answers},
+			ConfigFile: diag.ConfigFile{
+				Lang:       "python",
+				ConfigKeys: diag.ConfigKeys{DevToken: "GoodDevToken", LoginCustomerID: test.lcid},
+			},
+		}
+		c.client = &http.Client{Transport: &hierarchyTransport{
+			accessible: `{"resourceNames": ["customers/1111111111", "customers/2222222222", "customers/3333333333"]}`,
+			clients:    test.clients,
+		}}
+
+		if got := c.suggestLoginCustomerID(context.Background()); got != test.want {
+			t.Errorf("%s: suggestLoginCustomerID - got: %t, want: %t", test.desc, got, test.want)
+		}
+		if c.ConfigFile.LoginCustomerID != test.wantLCID {
+			t.Errorf("%s: login customer ID - got: %q, want: %q", test.desc, c.ConfigFile.LoginCustomerID, test.wantLCID)
+		}
+	}
+}
+
+func TestDiagnoseCustomerNotEnabled(t *testing.T) {
+	tests := []struct {
+		desc      string
+		errorCode string
+		clients   map[string]string
+		want      string
+	}{
+		{
+			desc:    "Suspended account",
+			clients: map[string]string{"2222222222": `{"results": [{"customerClient": {"status": "SUSPENDED"}}]}`},
+			want:    "The account is suspended. Resolve the suspension in the Google Ads UI.",
+		},
+		{
+			desc:    "Canceled account",
+			clients: map[string]string{"2222222222": `{"results": [{"customerClient": {"status": "CANCELED"}}]}`},
+			want:    "The account is canceled. Reactivate it in the Google Ads UI, or use another customer ID.",
+		},
+		{
+			desc:    "Status not found in any hierarchy",
+			clients: map[string]string{"2222222222": `{}`},
+			want:    remediations[CustomerNotEnabled],
+		},
+		{
+			desc:      "Incomplete sign-up",
+			errorCode: "authorizationError.INCOMPLETE_SIGNUP",
+			want:      "Finish the sign-up of the account in the Google Ads UI.",
+		},
+	}
+
+	for _, test := range tests {
+		c := &Config{
+			CustomerID:     "1234567890",
+			NonInteractive: true,
+			ConfigFile: diag.ConfigFile{
+				Lang:       "python",
+				ConfigKeys: diag.ConfigKeys{DevToken: "GoodDevToken"},
+			},
+		}
+		c.client = &http.Client{Transport: &hierarchyTransport{
+			accessible: `{"resourceNames": ["customers/2222222222"]}`,
+			clients:    test.clients,
+		}}
+		c.fail(CustomerNotEnabled, "The customer account can't be accessed.", nil)
+		c.diagnoseCustomerNotEnabled(context.Background(), test.errorCode)
+
+		if c.report.Remediation != test.want {
+			t.Errorf("%s: remediation - got: %q, want: %q", test.desc, c.report.Remediation, test.want)
+		}
+	}
+}
@@ -20,101 +20,266 @@ package oauth
 // flow.
 
 import (
-	"bufio"
 	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
 	"log"
-	"os"
+	"net"
+	"net/http"
+	"oauthdoctor/diag"
 	"runtime"
+	"strconv"
 
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 )
 
 const (
-	// InstalledAppRedirectURL is the redirect URL for the web flow.
-	InstalledAppRedirectURL = "urn:ietf:wg:oauth:2.0:oob"
+	// LoopbackHost is the host of the loopback redirect URL for the
+	// installed app flow.
+	// https://developers.google.com/identity/protocols/oauth2/native-app#redirect-uri_loopback
+	LoopbackHost = "127.0.0.1"
 )
 
 // This function simulates the installed app flow to see if it succeeds
 // or fails. If it fails, it will try to examine the error and prompt user
-// to fix it. Then it retries to connect again and prints the result of the
-// 2nd attempt.
-func (c *Config) simulateAppFlow() {
+// to fix it. Then it retries to connect again, see fixAndRetry, and prints
+// the result of the last attempt.
+func (c *Config) simulateAppFlow(ctx context.Context) {
 	var refreshToken string
 
-	accountInfo, err := c.connectWithRefreshToken()
-	if err != nil {
-		if c.Verbose {
-			log.Print(err)
-		}
-		c.diagnose(err)
-		accountInfo, refreshToken, err = c.reconnect(err)
+	accountInfo, err := c.connectWithRefreshToken(ctx)
+	if err != nil && c.Wizard && !c.NonInteractive {
+		accountInfo, err = c.runWizard(ctx, err)
 	}
-
-	if err == nil {
-		if c.Verbose {
-			log.Print(accountInfo)
+	accountInfo, err = c.fixAndRetry(ctx, accountInfo, err, func(err error) (*bytes.Buffer, error) {
+		info, newToken, err := c.reconnect(ctx, err)
+		// Keep the refresh token generated by a previous attempt
+		if newToken != "" {
+			refreshToken = newToken
 		}
-		log.Println("SUCCESS: OAuth test passed with given config file settings.")
+		return info, err
+	})
 
-		if refreshToken != "" {
-			replaceRefreshToken(c.ConfigFile, refreshToken)
+	c.finish(accountInfo, err)
+	// A new refresh token is kept even if the API call still fails, e.g. for
+	// the customer ID, so that the next run does not ask for consent again
+	if refreshToken != "" {
+		if err != nil {
+			log.Print("A new refresh token was generated, although the API call still fails.")
 		}
-	} else {
-		if c.Verbose {
-			log.Println(err)
-		}
-		log.Println("ERROR: OAuth test failed.")
+		c.replaceRefreshToken(refreshToken)
 	}
 }
 
 // This function connects with OAuth2 based on the given error and then
 // sends a HTTP request to Google Ads API to get account info.
-func (c *Config) reconnect(err error) (*bytes.Buffer, string, error) {
+func (c *Config) reconnect(ctx context.Context, err error) (*bytes.Buffer, string, error) {
+	// The credentials are not regenerated for an error of a skewed clock
+	if c.report.Code == ClockSkew {
+		accountInfo, oErr := c.connectWithRefreshToken(ctx)
+		return accountInfo, "", oErr
+	}
 	switch c.decodeError(err) {
 	case GoogleAdsAPIDisabled:
-		accountInfo, oErr := c.connectWithRefreshToken()
+		accountInfo, oErr := c.connectWithRefreshToken(ctx)
 		return accountInfo, "", oErr
-	case InvalidCustomerID:
-		c.CustomerID = ReadCustomerID()
-		accountInfo, oErr := c.connectWithRefreshToken()
+	case InvalidCustomerID, CustomerNotAccessible, CustomerNotEnabled, Unauthenticated:
+		accountInfo, oErr := c.connectWithRefreshToken(ctx)
 		return accountInfo, "", oErr
 	case InvalidClientInfo:
-		accountInfo, oErr := c.connectWithRefreshToken()
+		accountInfo, oErr := c.connectWithRefreshToken(ctx)
 		return accountInfo, "", oErr
 	case AccessNotPermittedForManagerAccount:
 		log.Print("Attempting to regenerate refresh token...")
-		return c.connectWithNoRefreshToken()
-	case InvalidRefreshToken:
+		return c.connectWithNoRefreshToken(ctx)
+	case InvalidRefreshToken, Unauthorized, ConsentDenied, InsufficientScope, RedirectURIMismatch:
 		log.Print("Attempting to regenerate refresh token...")
-		return c.connectWithNoRefreshToken()
-	case MissingDevToken:
-		accountInfo, oErr := c.connectWithRefreshToken()
+		return c.connectWithNoRefreshToken(ctx)
+	case UserPermissionDenied:
+		return c.reconnectPermissionDenied(ctx)
+	case MissingDevToken, DevTokenNotApproved, DevTokenNotAllowlisted, DevTokenProhibited,
+		InvalidDevToken, CertificateError, NetworkUnreachable, RateLimited:
+		accountInfo, oErr := c.connectWithRefreshToken(ctx)
 		return accountInfo, "", oErr
 	default:
 		log.Print("Attempting to regenerate refresh token...")
-		return c.connectWithNoRefreshToken()
+		return c.connectWithNoRefreshToken(ctx)
+	}
+}
+
+// reconnectPermissionDenied retries the flow with the refresh token after
+// UserPermissionDenied, which is usually fixed in the login customer ID or
+// the account linkage. When the retry is denied again, it offers to
+// regenerate the refresh token, in case it was generated with another login
+// email.
+func (c *Config) reconnectPermissionDenied(ctx context.Context) (*bytes.Buffer, string, error) {
+	accountInfo, err := c.connectWithRefreshToken(ctx)
+	if err == nil || c.decodeError(err) != UserPermissionDenied {
+		return accountInfo, "", err
 	}
+	diag.Error("The permission is still denied with the refresh token.")
+	if !c.confirm("Would you like to regenerate the refresh token, in case "+
+		"it was generated with another login email?", false) {
+		log.Print("The refresh token is NOT regenerated.")
+		return accountInfo, "", err
+	}
+	log.Print("Attempting to regenerate refresh token...")
+	return c.connectWithNoRefreshToken(ctx)
 }
 
 // This function simulates the auth code generation step during the OAuth2
-// authentication and authorization step.
-func (c *Config) genAuthCode() string {
-	conf := c.oauth2Conf(InstalledAppRedirectURL)
+// authentication and authorization step. It starts a HTTP server on the
+// loopback interface, opens the browser with the auth URL and waits for the
+// auth code sent to the loopback redirect URL. When the browser cannot be
+// opened or OpenBrowser is not set, the server is shut down, the URL is
+// printed and the user is prompted to enter the auth code instead. The PKCE
+// code challenge derived from verifier is sent with the auth request. It
+// returns the auth code and the redirect URL.
+func (c *Config) genAuthCode(ctx context.Context, verifier string) (string, string, error) {
+	state, err := newState()
+	if err != nil {
+		return "", "", err
+	}
+	srv, err := startLoopbackServer(c.RedirectPort, state)
+	if err != nil {
+		return "", "", err
+	}
+	defer srv.close()
+
+	redirectURL := srv.redirectURL()
+	c.redirectURL = redirectURL
+	conf := c.oauth2Conf(redirectURL)
 
 	// Redirect the user to Google's consent page to ask for permission
 	// for the scopes specified above.
-	url := conf.AuthCodeURL("state", oauth2.AccessTypeOffline)
-	log.Printf("Visit the URL for the auth dialog:\n%s\n", url)
+	url := conf.AuthCodeURL(state, oauth2.AccessTypeOffline,
+		oauth2.SetAuthURLParam("code_challenge", codeChallenge(verifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"))
+
+	if !c.launchBrowser(url) {
+		// The server is shut down, so that the redirected page keeps the auth
+		// code in its URL for the manual entry, instead of taking it
+		srv.close()
+		log.Print(genAuthCodePrompt(runtime.GOOS))
+		code, err := c.prompter().Prompt("Enter Code")
+		if err != nil && code == "" {
+			return "", redirectURL, err
+		}
+		return code, redirectURL, nil
+	}
+
+	log.Print("Waiting for the auth code...")
+	code, err := waitForAuthCode(ctx, srv.codes, srv.errs)
+	return code, redirectURL, err
+}
+
+// loopbackServer is a HTTP server, usually on the loopback interface, that
+// receives the auth code or the error sent to the redirect URL. Each flow
+// starts its own server, so that a late redirect of a previous flow cannot
+// block or reach the current one.
+type loopbackServer struct {
+	srv      *http.Server
+	listener net.Listener
+	codes    chan string
+	errs     chan error
+	// state is the state of the auth request, which the redirect must
+	// return.
+	state string
+}
+
+// startLoopbackServer starts a loopbackServer in the background on the given
+// port of the loopback interface for the auth request of state. An ephemeral
+// port is used when port is 0.
+func startLoopbackServer(port int, state string) (*loopbackServer, error) {
+	return startRedirectServer(net.JoinHostPort(LoopbackHost, strconv.Itoa(port)), state)
+}
+
+// startRedirectServer starts a loopbackServer in the background on the given
+// address for the auth request of state, e.g. :8080 for the web flow.
+func startRedirectServer(addr, state string) (*loopbackServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &loopbackServer{listener: listener, codes: make(chan string, 1),
+		errs: make(chan error, 1), state: state}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handle)
+	s.srv = &http.Server{Handler: mux}
+	go s.srv.Serve(listener)
+
+	return s, nil
+}
+
+// redirectURL returns the redirect URL served by the loopbackServer.
+func (s *loopbackServer) redirectURL() string {
+	return "http://" + s.listener.Addr().String()
+}
+
+// handle parses the auth code or the error from the redirect request and
+// sends it to the channel, so the flow can continue at the command line. A
+// redirect whose state does not match the auth request is rejected, since it
+// was not sent by the auth dialog of this flow.
+func (s *loopbackServer) handle(w http.ResponseWriter, r *http.Request) {
+	code, err := parseRedirect(r.URL.Query())
+	if (code != "" || err != nil) && r.URL.Query().Get("state") != s.state {
+		log.Print("Rejected a redirect whose state does not match the auth request.")
+		http.Error(w, "The state does not match the auth request of oauthdoctor.", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		select {
+		case s.errs <- err:
+		default:
+		}
+		fmt.Fprint(w, "Authorization failed: "+err.Error()+". Return to oauthdoctor for the diagnosis.")
+		return
+	}
+	if code == "" {
+		return
+	}
 
-	log.Print(genAuthCodePrompt(runtime.GOOS))
-	fmt.Print("Enter Code >> ")
+	select {
+	case s.codes <- code:
+	default:
+	}
+	fmt.Fprint(w, "Auth code received by oauthdoctor. You can close this window.")
+}
+
+// close shuts down the loopbackServer.
+func (s *loopbackServer) close() {
+	s.srv.Shutdown(context.Background())
+}
+
+// newCodeVerifier returns a random PKCE code verifier.
+// https://tools.ietf.org/html/rfc7636#section-4.1
+func newCodeVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
 
-	reader := bufio.NewReader(os.Stdin)
-	code, _ := reader.ReadString('\n')
+// newState returns a random state of an auth request, which the redirect
+// returns as is.
+func newState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
 
-	return code
+// codeChallenge returns the S256 PKCE code challenge of the code verifier.
+// https://tools.ietf.org/html/rfc7636#section-4.2
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
 }
 
 // genAuthCodePrompt returns the operating specific command prompt.
@@ -129,7 +294,8 @@ func genAuthCodePrompt(goos string) string {
 		msg += "3) Highlight the URL\n"
 		msg += "4) Right click on the highlighted area\n"
 	}
-	msg += "Copy the code here to continue:"
+	msg += "Copy the value of the \"code\" parameter in the URL of the " +
+		"redirected page here to continue:"
 	return msg
 }
 
@@ -137,25 +303,97 @@ func genAuthCodePrompt(goos string) string {
 // for the refresh token. And then, it gets the account info. This function
 // is used based on the assumption of missing/incorrect refresh token in the
 // client library config file.
-func (c *Config) connectWithNoRefreshToken() (
+func (c *Config) connectWithNoRefreshToken(ctx context.Context) (
 	*bytes.Buffer, string, error) {
-	code := c.genAuthCode()
-	client, refreshToken := c.oauth2Client(code)
-	accountInfo, err := c.getAccount(client)
+	if accountInfo, refreshToken, ok, err := c.connectWithCachedToken(ctx); ok {
+		return accountInfo, refreshToken, err
+	}
+
+	verifier, err := newCodeVerifier()
+	if err != nil {
+		return nil, "", err
+	}
+	if c.Verbose {
+		log.Printf("PKCE code verifier: %s", verifier)
+	}
+
+	code, redirectURL, err := c.genAuthCode(ctx, verifier)
+	if err != nil {
+		if _, ok := err.(*redirectError); ok {
+			c.diagnose(ctx, err)
+		}
+		return nil, "", err
+	}
+	client, refreshToken, err := c.oauth2Client(ctx, redirectURL, code,
+		oauth2.SetAuthURLParam("code_verifier", verifier))
+	if err != nil {
+		c.diagnose(ctx, err)
+		return nil, "", err
+	}
+	accountInfo, err := c.getAccount(ctx, client)
 	return accountInfo, refreshToken, err
 }
 
+// connectWithCachedToken gets the account info with the token cached by a
+// previous run. It returns false when there is no usable cached token.
+func (c *Config) connectWithCachedToken(ctx context.Context) (*bytes.Buffer, string, bool, error) {
+	oauth2Ctx := c.oauth2Context(ctx)
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	ts, refreshToken := c.cachedTokenSource(oauth2Ctx)
+	if ts == nil {
+		return nil, "", false, nil
+	}
+	accountInfo, err := c.getAccount(ctx, c.newClient(ts))
+	return accountInfo, refreshToken, true, err
+}
+
 // With refresh token given from client lib config file, it directly connects
 // with OAuth and get the account info.
-func (c *Config) connectWithRefreshToken() (
+func (c *Config) connectWithRefreshToken(ctx context.Context) (
 	*bytes.Buffer, error) {
+	// The token source outlives the timeout, which covers the Google Ads API
+	// request, so that the access token can be refreshed after it returns.
+	oauth2Ctx := c.oauth2Context(ctx)
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	ts, err := c.refreshAccessToken(oauth2Ctx)
+	if err != nil {
+		return nil, err
+	}
+	if c.TokenOnly {
+		log.Print("Skipping the Google Ads API request with --tokenonly.")
+		return &bytes.Buffer{}, nil
+	}
+	return c.getAccount(ctx, c.newClient(ts))
+}
+
+// refreshAccessToken exchanges the refresh token in the configuration file
+// for an access token, which validates the client ID, the client secret and
+// the refresh token without the Google Ads API request. The cached access
+// token is used instead when the configuration has not changed since it was
+// issued. It returns the token source of the access token.
+func (c *Config) refreshAccessToken(ctx context.Context) (oauth2.TokenSource, error) {
 	conf := &oauth2.Config{
 		ClientID:     c.ConfigFile.ClientID,
 		ClientSecret: c.ConfigFile.ClientSecret,
-		Endpoint:     google.Endpoint,
+		Endpoint:     c.oauth2Endpoint(),
 	}
 	token := &oauth2.Token{RefreshToken: c.ConfigFile.RefreshToken}
-	client := conf.Client(oauth2.NoContext, token)
+	ts := c.tokenSource(func() oauth2.TokenSource {
+		return conf.TokenSource(ctx, token)
+	})
 
-	return c.getAccount(client)
+	tok, err := ts.Token()
+	if err != nil {
+		return nil, err
+	}
+	log.Print("The refresh token is valid: it was exchanged for an access token.")
+	if err := c.checkTokenScopes(tok); err != nil {
+		return nil, err
+	}
+	c.cacheToken(ts, nil)
+	return ts, nil
 }
@@ -1,6 +1,12 @@
 package oauth
 
 import (
+  "context"
+  "errors"
+  "fmt"
+  "net/http"
+  "net/http/httptest"
+  "oauthdoctor/diag"
   "strings"
   "testing"
 )
@@ -32,3 +38,263 @@ func TestGenAuthCode(t *testing.T) {
     }
   }
 }
+
+func TestCodeChallenge(t *testing.T) {
+  // Test vector from https://tools.ietf.org/html/rfc7636#appendix-B
+  const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+  const want = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+  if got := codeChallenge(verifier); got != want {
+    t.Errorf("code challenge mismatch want=%s\ngot=%s\n", want, got)
+  }
+}
+
+func TestNewCodeVerifier(t *testing.T) {
+  v1, err := newCodeVerifier()
+  if err != nil {
+    t.Fatalf("newCodeVerifier returned error: %s", err)
+  }
+  v2, _ := newCodeVerifier()
+
+  // RFC 7636 requires 43 to 128 characters
+  if len(v1) < 43 || len(v1) > 128 {
+    t.Errorf("code verifier length is invalid: %d", len(v1))
+  }
+  if v1 == v2 {
+    t.Errorf("code verifiers are not random: %s", v1)
+  }
+}
+
+func TestLoopbackServer(t *testing.T) {
+  srv, err := startLoopbackServer(0, "state")
+  if err != nil {
+    t.Fatalf("startLoopbackServer returned error: %s", err)
+  }
+  defer srv.close()
+
+  if !strings.HasPrefix(srv.redirectURL(), "http://"+LoopbackHost+":") {
+    t.Errorf("redirect URL is not a loopback URL: %s", srv.redirectURL())
+  }
+
+  resp, err := http.Get(srv.redirectURL() + "/?state=state&code=GoodAuthCode")
+  if err != nil {
+    t.Fatalf("redirect request returned error: %s", err)
+  }
+  resp.Body.Close()
+
+  if got := <-srv.codes; got != "GoodAuthCode" {
+    t.Errorf("auth code mismatch want=GoodAuthCode\ngot=%s\n", got)
+  }
+}
+
+func TestLoopbackServerError(t *testing.T) {
+  srv, err := startLoopbackServer(0, "state")
+  if err != nil {
+    t.Fatalf("startLoopbackServer returned error: %s", err)
+  }
+  defer srv.close()
+
+  resp, err := http.Get(srv.redirectURL() + "/?state=state&error=access_denied&error_description=Cancelled")
+  if err != nil {
+    t.Fatalf("redirect request returned error: %s", err)
+  }
+  resp.Body.Close()
+
+  got, ok := (<-srv.errs).(*redirectError)
+  if !ok {
+    t.Fatalf("redirect error is not a *redirectError")
+  }
+  if got.Code != "access_denied" || got.Description != "Cancelled" {
+    t.Errorf("redirect error mismatch want=access_denied: Cancelled\ngot=%+v\n", got)
+  }
+  if code := decodeErrorString(got.Error()); code != ConsentDenied {
+    t.Errorf("decodeErrorString - got: %d, want: %d", code, ConsentDenied)
+  }
+}
+
+func TestConnectWithRefreshTokenOnly(t *testing.T) {
+  tests := []struct {
+    desc   string
+    status int
+    body   string
+    want   int32
+  }{
+    {
+      desc:   "Valid refresh token",
+      status: http.StatusOK,
+      body:   `{"access_token": "AccessToken", "token_type": "Bearer", "expires_in": 3600}`,
+      want:   -1,
+    },
+    {
+      desc:   "Invalid refresh token",
+      status: http.StatusBadRequest,
+      body:   `{"error": "invalid_grant", "error_description": "Bad Request"}`,
+      want:   InvalidRefreshToken,
+    },
+  }
+
+  for _, test := range tests {
+    var requests []string
+    c := fakeConfig(test.status, test.body)
+    c.HTTPClient.Transport = &recordingTransport{base: c.HTTPClient.Transport, requests: &requests}
+    c.TokenOnly = true
+    c.ConfigFile.RefreshToken = "GoodRefreshToken"
+
+    _, err := c.connectWithRefreshToken(context.Background())
+    if test.want < 0 {
+      if err != nil {
+        t.Errorf("%s: connectWithRefreshToken returned error: %s", test.desc, err)
+      }
+    } else if err == nil || c.decodeError(err) != test.want {
+      t.Errorf("%s: error - got: %v, want code: %d", test.desc, err, test.want)
+    }
+    if len(requests) != 1 || !strings.HasSuffix(requests[0], "/token") {
+      t.Errorf("%s: requests - got: %v, want the token request only", test.desc, requests)
+    }
+  }
+}
+
+// recordingTransport is a http.RoundTripper that records the requests sent
+// to the base transport.
+type recordingTransport struct {
+  base     http.RoundTripper
+  requests *[]string
+}
+
+func (r *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+  *r.requests = append(*r.requests, req.Method+" "+req.URL.String())
+  return r.base.RoundTrip(req)
+}
+
+func TestReconnectUserPermissionDenied(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    if r.URL.Path == "/token" {
+      fmt.Fprint(w, `{"access_token": "AccessToken", "token_type": "Bearer", "expires_in": 3600}`)
+      return
+    }
+    w.WriteHeader(http.StatusForbidden)
+    fmt.Fprint(w, `{"error": {"code": 403, "status": "PERMISSION_DENIED",
+      "details": [{"errors": [{"errorCode": {"authorizationError": "USER_PERMISSION_DENIED"}}]}]}}`)
+  }))
+  defer server.Close()
+
+  var requests []string
+  p := &scriptedPrompter{answers: []string{"n"}}
+  c := &Config{
+    CustomerID:    "1234567890",
+    Endpoint:      server.URL,
+    HTTPClient:    &http.Client{Transport: &recordingTransport{base: http.DefaultTransport, requests: &requests}},
+    OAuthType:     InstalledApp,
+    Prompter:      p,
+    TokenEndpoint: server.URL + "/token",
+    ConfigFile: diag.ConfigFile{
+      Lang: "python",
+      ConfigKeys: diag.ConfigKeys{DevToken: "GoodDevToken", ClientID: "GoodClientID",
+        ClientSecret: "GoodClientSecret", RefreshToken: "GoodRefreshToken"},
+    },
+  }
+  deniedErr := errors.New(`{"error": {"code": 403, "status": "PERMISSION_DENIED",
+    "details": [{"errors": [{"errorCode": {"authorizationError": "USER_PERMISSION_DENIED"}}]}]}}`)
+
+  // The flow is retried with the refresh token, and the regeneration is
+  // only offered after the retry is denied again
+  _, newToken, err := c.reconnect(context.Background(), deniedErr)
+  if err == nil || c.decodeError(err) != UserPermissionDenied {
+    t.Errorf("error - got: %v, want UserPermissionDenied", err)
+  }
+  if newToken != "" {
+    t.Errorf("new refresh token - got: %q, want none", newToken)
+  }
+  if len(p.labels) != 1 || !strings.Contains(p.labels[0], "regenerate the refresh token") {
+    t.Errorf("prompts - got: %q, want the offer to regenerate the refresh token", p.labels)
+  }
+  for _, r := range requests {
+    if strings.Contains(r, "/auth") {
+      t.Errorf("requests - got: %q, want no auth request", requests)
+    }
+  }
+}
+
+func TestSimulateAppFlowKeepsNewRefreshToken(t *testing.T) {
+  var calls int
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    if r.URL.Path == "/token" {
+      fmt.Fprint(w, `{"access_token": "AccessToken", "token_type": "Bearer",
+        "expires_in": 3600, "refresh_token": "NewRefreshToken"}`)
+      return
+    }
+    calls++
+    w.WriteHeader(http.StatusForbidden)
+    if calls == 1 {
+      fmt.Fprint(w, `{"error": {"code": 403, "status": "PERMISSION_DENIED",
+        "details": [{"errors": [{"errorCode": {"authorizationError": "CANNOT_BE_EXECUTED_BY_MANAGER_ACCOUNT"}}]}]}}`)
+      return
+    }
+    fmt.Fprint(w, `{"error": {"code": 403, "status": "PERMISSION_DENIED",
+      "details": [{"errors": [{"errorCode": {"authorizationError": "CUSTOMER_NOT_ENABLED"}}]}]}}`)
+  }))
+  defer server.Close()
+
+  p := &scriptedPrompter{answers: []string{"AuthCode", "1234567890", "1234567890"}}
+  c := &Config{
+    CustomerID:    "1234567890",
+    Endpoint:      server.URL,
+    HTTPClient:    server.Client(),
+    OAuthType:     InstalledApp,
+    Prompter:      p,
+    TokenEndpoint: server.URL + "/token",
+    ConfigFile: diag.ConfigFile{
+      Lang: "python",
+      ConfigKeys: diag.ConfigKeys{DevToken: "GoodDevToken", ClientID: "GoodClientID",
+        ClientSecret: "GoodClientSecret", RefreshToken: "GoodRefreshToken"},
+    },
+  }
+
+  // The refresh token is regenerated, but the API call fails for another
+  // reason: the new refresh token is still offered to be kept
+  c.simulateAppFlow(context.Background())
+  if c.report.Code != CustomerNotEnabled {
+    t.Errorf("report code - got: %d, want: %d", c.report.Code, CustomerNotEnabled)
+  }
+  if c.newRefreshToken != "NewRefreshToken" {
+    t.Errorf("new refresh token - got: %q, want: NewRefreshToken", c.newRefreshToken)
+  }
+}
+
+// redirectingPrompter follows the redirect of the auth dialog before the auth
+// code is entered, like a browser on the same machine.
+type redirectingPrompter struct {
+  c   *Config
+  err error
+}
+
+func (p *redirectingPrompter) Prompt(label string) (string, error) {
+  var resp *http.Response
+  resp, p.err = http.Get(p.c.redirectURL + "/?code=RedirectedAuthCode")
+  if p.err == nil {
+    resp.Body.Close()
+  }
+  return "EnteredAuthCode", nil
+}
+
+func (p *redirectingPrompter) Confirm(question string) bool { return false }
+
+func (p *redirectingPrompter) Notify(msg string) {}
+
+func TestGenAuthCodeManualEntry(t *testing.T) {
+  c := &Config{ConfigFile: diag.ConfigFile{ConfigKeys: diag.ConfigKeys{ClientID: "GoodClientID"}}}
+  p := &redirectingPrompter{c: c}
+  c.Prompter = p
+
+  // The loopback server is shut down for the manual entry, so the redirect
+  // cannot take the auth code that the user is asked to enter
+  code, _, err := c.genAuthCode(context.Background(), "Verifier")
+  if code != "EnteredAuthCode" || err != nil {
+    t.Errorf("genAuthCode - got: %q, %v, want: EnteredAuthCode, nil", code, err)
+  }
+  if p.err == nil {
+    t.Errorf("redirect - got no error, want the loopback server shut down")
+  }
+}
@@ -0,0 +1,232 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains the Prompter that the remediations use to interact with
+// the user, which keeps the terminal I/O out of the diagnosis logic.
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"oauthdoctor/diag"
+)
+
+// Prompter asks the user for the input of the remediations. It is
+// implemented for the terminal by NewPrompter, and may be implemented by
+// other front-ends, e.g. a GUI or scripted answers in tests.
+type Prompter interface {
+	// Prompt asks for a value with the label, e.g. "New Client ID", and
+	// returns the entered line without the surrounding whitespace. The error
+	// is set when the input ends, and the line may still be set then.
+	Prompt(label string) (string, error)
+	// Confirm asks the yes/no question and returns the answer.
+	Confirm(question string) bool
+	// Notify shows the message and waits until the user acknowledges it,
+	// e.g. after fixing the Google Cloud project in the browser.
+	Notify(msg string)
+}
+
+// linePrompter is the Prompter of a terminal, which reads the lines from in
+// and writes the prompts to out.
+type linePrompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// NewPrompter returns a Prompter that reads the answers line by line from in
+// and writes the prompts to out, e.g. os.Stdin and os.Stdout. The messages
+// are logged.
+func NewPrompter(in io.Reader, out io.Writer) Prompter {
+	return &linePrompter{in: bufio.NewReader(in), out: out}
+}
+
+func (p *linePrompter) Prompt(label string) (string, error) {
+	fmt.Fprint(p.out, label+" >> ")
+	line, err := p.in.ReadString('\n')
+	return strings.TrimSpace(line), err
+}
+
+func (p *linePrompter) Confirm(question string) bool {
+	log.Print(question)
+	answer, _ := p.Prompt("Enter Y or Yes [Anything else is No]")
+	return isYes(answer)
+}
+
+func (p *linePrompter) Notify(msg string) {
+	log.Print(msg)
+	p.in.ReadString('\n')
+}
+
+// deadlinePrompter is a Prompter that stops waiting for the answers once ctx
+// is done, so that an unanswered prompt cannot block past the deadline or
+// after the diagnosis is canceled.
+type deadlinePrompter struct {
+	ctx context.Context
+	p   Prompter
+}
+
+// stopped prints why the wait for what, e.g. the answer to a prompt, was
+// stopped: the deadline passed or the diagnosis was canceled.
+func (p *deadlinePrompter) stopped(what string) {
+	if p.ctx.Err() == context.Canceled {
+		diag.Errorf("Canceled while waiting for the %s.", what)
+		return
+	}
+	diag.Errorf("No %s before the deadline.", what)
+}
+
+// NewDeadlinePrompter returns a Prompter that asks p until ctx is done, i.e.
+// its deadline passed or it was canceled. Then Prompt returns the error of
+// ctx, Confirm returns false and Notify returns, even when p is still waiting
+// for the input. p is not asked anymore after that, so that no other prompt
+// reads the input that is still awaited.
+func NewDeadlinePrompter(ctx context.Context, p Prompter) Prompter {
+	return &deadlinePrompter{ctx: ctx, p: p}
+}
+
+// prompterAnswer is the answer of a prompt of deadlinePrompter.
+type prompterAnswer struct {
+	line string
+	err  error
+}
+
+func (p *deadlinePrompter) Prompt(label string) (string, error) {
+	if err := p.ctx.Err(); err != nil {
+		return "", err
+	}
+	answers := make(chan prompterAnswer, 1)
+	go func() {
+		line, err := p.p.Prompt(label)
+		answers <- prompterAnswer{line: line, err: err}
+	}()
+	select {
+	case a := <-answers:
+		return a.line, a.err
+	case <-p.ctx.Done():
+		p.stopped(fmt.Sprintf("answer to %q", label))
+		return "", p.ctx.Err()
+	}
+}
+
+func (p *deadlinePrompter) Confirm(question string) bool {
+	if p.ctx.Err() != nil {
+		return false
+	}
+	answers := make(chan bool, 1)
+	go func() {
+		answers <- p.p.Confirm(question)
+	}()
+	select {
+	case yes := <-answers:
+		return yes
+	case <-p.ctx.Done():
+		p.stopped(fmt.Sprintf("answer to %q", question))
+		return false
+	}
+}
+
+func (p *deadlinePrompter) Notify(msg string) {
+	if p.ctx.Err() != nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		p.p.Notify(msg)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-p.ctx.Done():
+		p.stopped("acknowledgement")
+	}
+}
+
+// nonInteractivePrompter is the Prompter of the non-interactive mode. A
+// prompt that is reached anyway fails at once and says how to supply its
+// value, instead of waiting for an input that never comes, e.g. in a CI job.
+type nonInteractivePrompter struct{}
+
+// NewNonInteractivePrompter returns a Prompter whose prompts fail with an
+// error naming the prompt, whose questions are answered no and whose
+// notifications do not wait.
+func NewNonInteractivePrompter() Prompter {
+	return nonInteractivePrompter{}
+}
+
+// promptSources tell how the values of the prompts are supplied without a
+// prompt, by the labels of the prompts.
+var promptSources = map[string]string{
+	"Customer ID": "Give it with --customerid or --customeridfile.",
+	"Enter Code": "Generate a refresh token with the installed app flow in an " +
+		"interactive session, and set it in the configuration file.",
+	"New Client ID":         configSource(diag.ClientID),
+	"New Client Secret":     configSource(diag.ClientSecret),
+	"New Developer Token":   configSource(diag.DevToken),
+	"New Login Customer ID": configSource(diag.LoginCustomerID),
+}
+
+// configSource tells how the value of the key in ConfigKeys is supplied.
+func configSource(key string) string {
+	return "Set " + key + " in the configuration file, or " + diag.EnvVars[key] +
+		" in the environment when no configuration file is used."
+}
+
+func (nonInteractivePrompter) Prompt(label string) (string, error) {
+	diag.Errorf("The prompt %q is reached in non-interactive mode, where no "+
+		"input can be entered. %s", label, promptSources[label])
+	return "", fmt.Errorf("no input for the prompt %q in non-interactive mode", label)
+}
+
+func (nonInteractivePrompter) Confirm(question string) bool {
+	diag.Errorf("The question %q is reached in non-interactive mode, and is "+
+		"answered no. Use --yes to answer yes.", question)
+	return false
+}
+
+func (nonInteractivePrompter) Notify(msg string) {
+	log.Print(msg)
+	diag.Error("The pause above is reached in non-interactive mode, so the " +
+		"diagnosis continues without waiting.")
+}
+
+// isYes returns true when the answer is y or yes in any case, ignoring the
+// surrounding whitespace.
+func isYes(answer string) bool {
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// stdPrompter is the Prompter of stdin and stdout, which is used when
+// Config.Prompter is not set. It is shared so that the input buffered by one
+// prompt is not lost for the next one.
+var stdPrompter = NewPrompter(os.Stdin, os.Stdout)
+
+// prompter returns the Prompter in Config. When it is not set, the prompts
+// fail in non-interactive mode, see NewNonInteractivePrompter, and use stdin
+// and stdout otherwise.
+func (c *Config) prompter() Prompter {
+	if c.Prompter != nil {
+		return c.Prompter
+	}
+	if c.NonInteractive {
+		return NewNonInteractivePrompter()
+	}
+	return stdPrompter
+}
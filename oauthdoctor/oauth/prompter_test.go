@@ -0,0 +1,371 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"oauthdoctor/diag"
+)
+
+// scriptedPrompter answers the prompts in order, like a user typing the
+// answers, and records the labels of the prompts.
+type scriptedPrompter struct {
+	answers []string
+	labels  []string
+	notices int
+}
+
+func (p *scriptedPrompter) Prompt(label string) (string, error) {
+	p.labels = append(p.labels, label)
+	if len(p.answers) == 0 {
+		return "", io.EOF
+	}
+	answer := p.answers[0]
+	p.answers = p.answers[1:]
+	return answer, nil
+}
+
+func (p *scriptedPrompter) Confirm(question string) bool {
+	answer, _ := p.Prompt(question)
+	return isYes(answer)
+}
+
+func (p *scriptedPrompter) Notify(msg string) {
+	p.notices++
+}
+
+func TestLinePrompter(t *testing.T) {
+	var out bytes.Buffer
+	p := NewPrompter(strings.NewReader(" NewClientID \r\nyes\n\nlast"), &out)
+
+	if got, err := p.Prompt("New Client ID"); got != "NewClientID" || err != nil {
+		t.Errorf("Prompt - got: %q, %v, want: NewClientID, nil", got, err)
+	}
+	if !p.Confirm("Replace?") {
+		t.Errorf("Confirm - got: false, want: true")
+	}
+	p.Notify("Press <Enter> to continue")
+	// The last line without a newline is returned with the end of the input
+	if got, err := p.Prompt("Customer ID"); got != "last" || err != io.EOF {
+		t.Errorf("Prompt at the end of the input - got: %q, %v, want: last, EOF", got, err)
+	}
+
+	want := "New Client ID >> Enter Y or Yes [Anything else is No] >> Customer ID >> "
+	if out.String() != want {
+		t.Errorf("prompts - got: %q, want: %q", out.String(), want)
+	}
+}
+
+func TestReadCustomerID(t *testing.T) {
+	p := &scriptedPrompter{answers: []string{"", "123-456", "123-456-7890"}}
+	if got := ReadCustomerID(p); got != "1234567890" {
+		t.Errorf("ReadCustomerID - got: %s, want: 1234567890", got)
+	}
+	if len(p.labels) != 3 {
+		t.Errorf("ReadCustomerID - got %d prompts, want 3 until the ID is valid", len(p.labels))
+	}
+}
+
+func TestPromptedRemediations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oauthdoctor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := "developer_token: OldDevToken\nclient_id: OldClientID\nclient_secret: OldClientSecret\n" +
+		"refresh_token: OldRefreshToken\nlogin_customer_id: 1112223333\n"
+	configFp := filepath.Join(dir, "google-ads.yaml")
+	if err := ioutil.WriteFile(configFp, []byte(content), 0600); err != nil {
+		t.Fatalf("Error writing config file: %s", err)
+	}
+
+	p := &scriptedPrompter{answers: []string{
+		"NewDevToken",
+		"NewClientID", "NewClientSecret",
+		"n", "n", "n",
+		"none",
+	}}
+	c := &Config{
+		CustomerID: "1234567890",
+		Prompter:   p,
+		ConfigFile: diag.ConfigFile{
+			Filename: "google-ads.yaml",
+			Filepath: dir,
+			Lang:     "python",
+			ConfigKeys: diag.ConfigKeys{DevToken: "OldDevToken", ClientID: "OldClientID",
+				ClientSecret: "OldClientSecret", RefreshToken: "OldRefreshToken",
+				LoginCustomerID: "1112223333"},
+		},
+	}
+	c.replaceDevToken()
+	c.replaceCloudCredentials([]string{diag.ClientID, diag.ClientSecret})
+	c.replaceRefreshToken("NewRefreshToken")
+	c.diagnoseLoginCustomerID()
+	c.pause("Press <Enter> to continue")
+
+	want := diag.ConfigKeys{DevToken: "NewDevToken", ClientID: "NewClientID",
+		ClientSecret: "NewClientSecret", RefreshToken: "OldRefreshToken"}
+	if c.ConfigFile.ConfigKeys != want {
+		t.Errorf("config keys - got: %+v, want: %+v", c.ConfigFile.ConfigKeys, want)
+	}
+	got, _ := ioutil.ReadFile(configFp)
+	for _, s := range []string{"NewDevToken", "NewClientID", "NewClientSecret", "OldRefreshToken"} {
+		if !strings.Contains(string(got), s) {
+			t.Errorf("config file - got: %s, want: %s", got, s)
+		}
+	}
+	if strings.Contains(string(got), "\nlogin_customer_id") {
+		t.Errorf("config file - got: %s, want the login customer ID commented out", got)
+	}
+	if len(p.answers) != 0 || p.notices != 1 {
+		t.Errorf("prompts - got %d unanswered and %d notices, want 0 and 1", len(p.answers), p.notices)
+	}
+}
+
+func TestKeepDeclinedRefreshToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oauthdoctor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := "refresh_token: OldRefreshToken\n"
+	configFp := filepath.Join(dir, "google-ads.yaml")
+	if err := ioutil.WriteFile(configFp, []byte(content), 0600); err != nil {
+		t.Fatalf("Error writing config file: %s", err)
+	}
+
+	// Decline the replacement, do not print the token and save it
+	p := &scriptedPrompter{answers: []string{"n", "n", "y"}}
+	c := &Config{
+		Prompter: p,
+		ConfigFile: diag.ConfigFile{
+			Filename:   "google-ads.yaml",
+			Filepath:   dir,
+			Lang:       "python",
+			ConfigKeys: diag.ConfigKeys{RefreshToken: "OldRefreshToken"},
+		},
+	}
+	c.replaceRefreshToken("NewRefreshToken")
+
+	if got, _ := ioutil.ReadFile(configFp); string(got) != content {
+		t.Errorf("config file - got: %s, want: %s", got, content)
+	}
+	// The refresh token is masked in the log file
+	if got := c.RedactLog("New refresh token: NewRefreshToken"); strings.Contains(got, "NewRefreshToken") {
+		t.Errorf("RedactLog - got: %s, want the refresh token masked", got)
+	}
+	path := filepath.Join(dir, refreshTokenFile)
+	if got, err := ioutil.ReadFile(path); err != nil || string(got) != "NewRefreshToken\n" {
+		t.Errorf("refresh token file - got: %q, %v, want: NewRefreshToken", got, err)
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm() != 0600 {
+		t.Errorf("refresh token file mode - got: %o, want: 600", info.Mode().Perm())
+	}
+	if len(p.answers) != 0 {
+		t.Errorf("prompts - got %d unanswered, want 0", len(p.answers))
+	}
+	// The refresh token is not in the JSON report
+	if b, _ := json.Marshal(c.report); strings.Contains(string(b), "NewRefreshToken") {
+		t.Errorf("JSON report - got: %s, want no refresh token", b)
+	}
+
+	// An existing file is not overwritten
+	p.answers = []string{"n", "n", "y"}
+	c.replaceRefreshToken("AnotherRefreshToken")
+	if got, _ := ioutil.ReadFile(path); string(got) != "NewRefreshToken\n" {
+		t.Errorf("existing refresh token file - got: %q, want: NewRefreshToken", got)
+	}
+}
+
+func TestReplaceCloudCredentialsRejectedKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oauthdoctor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := "client_id: GoodClientID\nclient_secret: BadClientSecret\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "google-ads.yaml"), []byte(content), 0600); err != nil {
+		t.Fatalf("Error writing config file: %s", err)
+	}
+
+	p := &scriptedPrompter{answers: []string{"NewClientSecret"}}
+	c := &Config{
+		Prompter: p,
+		ConfigFile: diag.ConfigFile{
+			Filename:   "google-ads.yaml",
+			Filepath:   dir,
+			Lang:       "python",
+			ConfigKeys: diag.ConfigKeys{ClientID: "GoodClientID", ClientSecret: "BadClientSecret"},
+		},
+	}
+	c.replaceCloudCredentials(errorKeys(InvalidClientInfo, errors.New(invalidSecretError)))
+
+	if want := []string{"New Client Secret"}; !reflect.DeepEqual(p.labels, want) {
+		t.Errorf("prompts - got: %q, want: %q", p.labels, want)
+	}
+	want := diag.ConfigKeys{ClientID: "GoodClientID", ClientSecret: "NewClientSecret"}
+	if c.ConfigFile.ConfigKeys != want {
+		t.Errorf("config keys - got: %+v, want: %+v", c.ConfigFile.ConfigKeys, want)
+	}
+}
+
+func TestTrimConfigValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oauthdoctor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := "developer_token: 'GoodDevToken '\nclient_id: GoodClientID\nclient_secret: '\"GoodClientSecret\"'\n"
+	configFp := filepath.Join(dir, "google-ads.yaml")
+	if err := ioutil.WriteFile(configFp, []byte(content), 0600); err != nil {
+		t.Fatalf("Error writing config file: %s", err)
+	}
+
+	p := &scriptedPrompter{answers: []string{"y", "n"}}
+	c := &Config{
+		Prompter: p,
+		ConfigFile: diag.ConfigFile{
+			Filename: "google-ads.yaml",
+			Filepath: dir,
+			Lang:     "python",
+			ConfigKeys: diag.ConfigKeys{DevToken: "GoodDevToken ", ClientID: "GoodClientID",
+				ClientSecret: `"GoodClientSecret"`},
+		},
+	}
+	// The declined value is left
+	if left := c.trimConfigValues(); !reflect.DeepEqual(left, []string{diag.ClientSecret}) {
+		t.Errorf("keys left - got: %v, want: [%s]", left, diag.ClientSecret)
+	}
+
+	want := diag.ConfigKeys{DevToken: "GoodDevToken", ClientID: "GoodClientID",
+		ClientSecret: `"GoodClientSecret"`}
+	if c.ConfigFile.ConfigKeys != want {
+		t.Errorf("config keys - got: %+v, want: %+v", c.ConfigFile.ConfigKeys, want)
+	}
+	got, _ := ioutil.ReadFile(configFp)
+	wantContent := "developer_token: 'GoodDevToken'\nclient_id: GoodClientID\nclient_secret: '\"GoodClientSecret\"'\n"
+	if string(got) != wantContent {
+		t.Errorf("config file - got: %q, want: %q", got, wantContent)
+	}
+	if len(p.answers) != 0 {
+		t.Errorf("prompts - got %d unanswered, want 0", len(p.answers))
+	}
+}
+
+// blockingPrompter never answers, like a terminal that nobody types in, and
+// counts the prompts.
+type blockingPrompter struct {
+	prompts int32
+}
+
+func (p *blockingPrompter) Prompt(label string) (string, error) {
+	atomic.AddInt32(&p.prompts, 1)
+	select {}
+}
+
+func (p *blockingPrompter) Confirm(question string) bool {
+	atomic.AddInt32(&p.prompts, 1)
+	select {}
+}
+
+func (p *blockingPrompter) Notify(msg string) {
+	atomic.AddInt32(&p.prompts, 1)
+	select {}
+}
+
+func TestDeadlinePrompter(t *testing.T) {
+	answered := NewDeadlinePrompter(context.Background(), &scriptedPrompter{answers: []string{"abc", "y"}})
+	if got, err := answered.Prompt("Label"); got != "abc" || err != nil {
+		t.Errorf("Prompt before the deadline - got: %q, %v, want: abc, nil", got, err)
+	}
+	if !answered.Confirm("Question?") {
+		t.Error("Confirm before the deadline - got: false, want: true")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	blocked := &blockingPrompter{}
+	p := NewDeadlinePrompter(ctx, blocked)
+	if _, err := p.Prompt("Label"); err != context.DeadlineExceeded {
+		t.Errorf("Prompt after the deadline - got error: %v, want: %v", err, context.DeadlineExceeded)
+	}
+	if p.Confirm("Question?") {
+		t.Error("Confirm after the deadline - got: true, want: false")
+	}
+	p.Notify("Message")
+	// The unanswered prompt keeps the input, so it is the only one
+	if got := atomic.LoadInt32(&blocked.prompts); got != 1 {
+		t.Errorf("prompts - got: %d, want: 1", got)
+	}
+
+	// The prompt stops when the session is canceled, e.g. with Ctrl-C
+	ctx, cancel = context.WithCancel(context.Background())
+	p = NewDeadlinePrompter(ctx, &blockingPrompter{})
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := p.Prompt("Label"); err != context.Canceled {
+		t.Errorf("Prompt after canceling - got error: %v, want: %v", err, context.Canceled)
+	}
+}
+
+func TestNonInteractivePrompter(t *testing.T) {
+	c := &Config{
+		NonInteractive: true,
+		ConfigFile: diag.ConfigFile{
+			Lang:       "python",
+			FromEnv:    true,
+			ConfigKeys: diag.ConfigKeys{DevToken: "OldDevToken", ClientSecret: "OldClientSecret"},
+		},
+	}
+
+	_, err := c.prompter().Prompt("Customer ID")
+	if err == nil || !strings.Contains(err.Error(), `"Customer ID"`) {
+		t.Errorf("Prompt - got error: %v, want an error naming the prompt", err)
+	}
+	if c.prompter().Confirm("Replace it?") {
+		t.Error("Confirm - got: true, want: false")
+	}
+	c.prompter().Notify("Press <Enter> to continue")
+
+	// The values are kept instead of being replaced with empty answers
+	c.replaceDevToken()
+	c.replaceCloudCredentials([]string{diag.ClientSecret})
+	want := diag.ConfigKeys{DevToken: "OldDevToken", ClientSecret: "OldClientSecret"}
+	if c.ConfigFile.ConfigKeys != want {
+		t.Errorf("config keys - got: %+v, want: %+v", c.ConfigFile.ConfigKeys, want)
+	}
+
+	// A Prompter set by the caller is used in non-interactive mode too
+	p := &scriptedPrompter{answers: []string{"y"}}
+	c.Prompter = p
+	if !c.prompter().Confirm("Replace it?") {
+		t.Error("Confirm with the Prompter - got: false, want: true")
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains the refresh of the access tokens that the Google Ads
+// API rejects during a long diagnosis, e.g. of many customer IDs, so that an
+// expired access token is not diagnosed as invalid credentials.
+
+import (
+	"net/http"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// refreshableSource is a token source that reuses its token until it
+// expires, like oauth2.ReuseTokenSource, and that can be forced to get a
+// new token from a new source, e.g. when the Google Ads API rejects an
+// access token before its expiry. The sources of the oauth2 package cache
+// their token, so they cannot be forced themselves.
+type refreshableSource struct {
+	mu        sync.Mutex
+	newSource func() oauth2.TokenSource
+	ts        oauth2.TokenSource
+}
+
+// newRefreshableSource returns a refreshableSource that starts with tok,
+// which may be nil, and gets the new tokens from the sources of newSource.
+// Each source returned by newSource must get a new token on its first call.
+func newRefreshableSource(tok *oauth2.Token, newSource func() oauth2.TokenSource) *refreshableSource {
+	return &refreshableSource{newSource: newSource, ts: oauth2.ReuseTokenSource(tok, newSource())}
+}
+
+// Token implements oauth2.TokenSource.
+func (s *refreshableSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	ts := s.ts
+	s.mu.Unlock()
+	return ts.Token()
+}
+
+// refresh replaces the token with a new one, even if it has not expired.
+func (s *refreshableSource) refresh() error {
+	ts := s.newSource()
+	tok, err := ts.Token()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ts = oauth2.ReuseTokenSource(tok, ts)
+	return nil
+}
+
+// newClient returns a client of the Google Ads API requests authorized by
+// ts. Unlike oauth2.NewClient, the transport keeps ts as is, so that
+// refreshClient can refresh its token.
+func (c *Config) newClient(ts oauth2.TokenSource) *http.Client {
+	return &http.Client{Transport: &oauth2.Transport{Base: c.httpClient().Transport, Source: ts}}
+}
+
+// refreshClient gets a new access token for the requests of client. It
+// returns false when the token cannot be refreshed, e.g. an access token
+// given in Config.
+func refreshClient(client *http.Client) bool {
+	t, ok := client.Transport.(*oauth2.Transport)
+	if !ok {
+		return false
+	}
+	s, ok := t.Source.(*refreshableSource)
+	if !ok {
+		return false
+	}
+	return s.refresh() == nil
+}
+
+// isRejectedAccessToken returns true when the Google Ads API rejected the
+// access token of the request, rather than the developer token or the
+// account access, which a new access token may fix.
+func (c *Config) isRejectedAccessToken(err error) bool {
+	apiErr, ok := err.(*APIError)
+	if !ok || apiErr.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+	switch c.decodeError(err) {
+	case AccessTokenExpired, Unauthenticated:
+		return true
+	}
+	return false
+}
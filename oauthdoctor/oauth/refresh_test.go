@@ -0,0 +1,122 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"oauthdoctor/diag"
+)
+
+// tokenServer returns a server that issues the access tokens AccessToken1,
+// AccessToken2... which expire in expiresIn seconds, and rejects the Google
+// Ads API requests authorized by the tokens in rejected.
+func tokenServer(expiresIn int, rejected map[string]bool, tokens, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/token" {
+			n := atomic.AddInt32(tokens, 1)
+			fmt.Fprintf(w, `{"access_token": "AccessToken%d", "token_type": "Bearer", "expires_in": %d}`, n, expiresIn)
+			return
+		}
+		atomic.AddInt32(requests, 1)
+		if rejected[r.Header.Get("Authorization")] {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error": {"code": 401, "message": "Request had invalid authentication credentials.", "status": "UNAUTHENTICATED"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"resourceName": "customers/1234567890"}`)
+	}))
+}
+
+func refreshConfig(server *httptest.Server) *Config {
+	return &Config{
+		CustomerID:    "1234567890",
+		Endpoint:      server.URL,
+		HTTPClient:    server.Client(),
+		TokenEndpoint: server.URL + "/token",
+		ConfigFile: diag.ConfigFile{
+			ConfigKeys: diag.ConfigKeys{RefreshToken: "GoodRefreshToken"},
+		},
+	}
+}
+
+func TestRejectedAccessTokenIsRefreshed(t *testing.T) {
+	tests := []struct {
+		desc         string
+		rejected     map[string]bool
+		wantErr      bool
+		wantTokens   int32
+		wantRequests int32
+	}{
+		{
+			desc:         "Access token rejected before its expiry",
+			rejected:     map[string]bool{"Bearer AccessToken1": true},
+			wantTokens:   2,
+			wantRequests: 2,
+		},
+		{
+			desc:         "New access token rejected too",
+			rejected:     map[string]bool{"Bearer AccessToken1": true, "Bearer AccessToken2": true},
+			wantErr:      true,
+			wantTokens:   2,
+			wantRequests: 2,
+		},
+		{
+			desc:         "Access token accepted",
+			wantTokens:   1,
+			wantRequests: 1,
+		},
+	}
+
+	for _, test := range tests {
+		var tokens, requests int32
+		server := tokenServer(3600, test.rejected, &tokens, &requests)
+		_, err := refreshConfig(server).connectWithRefreshToken(context.Background())
+		server.Close()
+
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: error - got: %v, want error: %t", test.desc, err, test.wantErr)
+		}
+		if tokens != test.wantTokens || requests != test.wantRequests {
+			t.Errorf("%s: got %d token and %d API requests, want %d and %d",
+				test.desc, tokens, requests, test.wantTokens, test.wantRequests)
+		}
+	}
+}
+
+func TestExpiredAccessTokenIsRefreshedAfterFlow(t *testing.T) {
+	// The access tokens expire right away, so each request refreshes them
+	var tokens, requests int32
+	server := tokenServer(1, nil, &tokens, &requests)
+	defer server.Close()
+
+	c := refreshConfig(server)
+	if _, err := c.connectWithRefreshToken(context.Background()); err != nil {
+		t.Fatalf("connectWithRefreshToken - got error: %s", err)
+	}
+	// The client of the flow is reused, e.g. by the concurrent workers,
+	// after the timeout of the flow is canceled
+	if _, err := c.getAccount(context.Background(), c.client); err != nil {
+		t.Errorf("getAccount after the flow - got error: %s", err)
+	}
+	if tokens < 2 {
+		t.Errorf("token requests - got: %d, want at least 2", tokens)
+	}
+}
@@ -0,0 +1,474 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains the machine-readable report of a diagnosis, which is
+// returned by SimulateOAuthFlow.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"oauthdoctor/diag"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Report is the result of a diagnosis. It is exported so that other
+// programs can reuse the diagnosis.
+type Report struct {
+	// Success is true when the last attempt of the OAuth flow succeeded. An
+	// error may still be reported when it was fixed before the last attempt.
+	Success bool `json:"success"`
+	// Error is the name of the diagnosed error code, e.g.
+	// InvalidRefreshToken. It is empty when no error was diagnosed.
+	Error string `json:"error,omitempty"`
+	// Code is the diagnosed error code. It is only meaningful when Error is
+	// not empty.
+	Code int32 `json:"code"`
+	// Message is the error message returned by the server, with the secret
+	// values redacted.
+	Message string `json:"message,omitempty"`
+	// Fields are the keys in the configuration file that are likely to
+	// cause the error, named as in the configuration file.
+	Fields []string `json:"fields,omitempty"`
+	// Remediation is the recommended action to fix the error.
+	Remediation string `json:"remediation,omitempty"`
+	// Warnings are the non-fatal findings of the diagnosis, e.g. the
+	// configuration file can be read by other users. They do not change the
+	// verdict, unless the configuration warnings fail it with Strict.
+	Warnings []string `json:"warnings,omitempty"`
+	// ConfigModified is true when any value in the configuration file was
+	// replaced during the diagnosis.
+	ConfigModified bool `json:"configModified"`
+	// CustomerID is the Google Ads account ID that was diagnosed.
+	CustomerID string `json:"customerId,omitempty"`
+	// Account is the Google Ads account that was reached when the diagnosis
+	// succeeded. It is nil when no account info was returned, e.g. with
+	// TokenOnly.
+	Account *Account `json:"account,omitempty"`
+	// AccountType is TestAccountType or ProductionAccountType when the type
+	// of the diagnosed account is known: from the account info on success,
+	// or from a DEVELOPER_TOKEN_NOT_APPROVED error, which is only returned
+	// for production accounts. It is empty when the type is unknown.
+	AccountType string `json:"accountType,omitempty"`
+	// DeadlineExceeded is true when the deadline of the context passed
+	// before the diagnosis completed, so that the error may only be the
+	// interrupted call.
+	DeadlineExceeded bool `json:"deadlineExceeded,omitempty"`
+	// Canceled is true when the context was canceled before the diagnosis
+	// completed, e.g. with Ctrl-C, so that the error may only be the
+	// interrupted call.
+	Canceled bool `json:"canceled,omitempty"`
+	// ClockSkew is the measured skew of the system clock from the clock of
+	// the token endpoint, e.g. "7m12s" when it is ahead, for a ClockSkew
+	// error.
+	ClockSkew string `json:"clockSkew,omitempty"`
+	// Flows are the results of the OAuth types tried with Auto, in the order
+	// they were tried.
+	Flows []FlowResult `json:"flows,omitempty"`
+	// Timings are the durations of the steps of the diagnosis. They are only
+	// recorded with Timings in Config.
+	Timings *Timings `json:"timings,omitempty"`
+	// Build is the build of the doctor that made the diagnosis. It is set
+	// by the command line tool, and nil otherwise.
+	Build *Build `json:"build,omitempty"`
+}
+
+// Build is the build metadata of the doctor, which tells the binary that
+// made a report.
+type Build struct {
+	Version string `json:"version"`
+	// Commit is the git commit that the binary was built from.
+	Commit string `json:"commit,omitempty"`
+	// Date is the build date, e.g. 2024-06-01T12:00:00Z.
+	Date string `json:"date,omitempty"`
+}
+
+// String returns the build in a single line, e.g. "oauthdoctor 1.2.0
+// (commit 0e08443, built 2024-06-01T12:00:00Z)".
+func (b *Build) String() string {
+	s := "oauthdoctor " + b.Version
+	var details []string
+	if b.Commit != "" {
+		details = append(details, "commit "+b.Commit)
+	}
+	if b.Date != "" {
+		details = append(details, "built "+b.Date)
+	}
+	if len(details) > 0 {
+		s += " (" + strings.Join(details, ", ") + ")"
+	}
+	return s
+}
+
+// The types of the Google Ads accounts in Report.AccountType.
+const (
+	TestAccountType       = "test"
+	ProductionAccountType = "production"
+)
+
+// Account is the Google Ads account info returned on success, which confirms
+// that the intended account was reached.
+type Account struct {
+	// ID is the customer ID of the account.
+	ID              string `json:"id"`
+	DescriptiveName string `json:"descriptiveName,omitempty"`
+	CurrencyCode    string `json:"currencyCode,omitempty"`
+	TimeZone        string `json:"timeZone,omitempty"`
+	// Manager is true for a manager account.
+	Manager bool `json:"manager"`
+	// TestAccount is true for a test account, which the developer tokens
+	// without Basic or Standard access are limited to.
+	TestAccount bool `json:"testAccount"`
+}
+
+// parseAccount parses the customer resource in the account info. It returns
+// nil when the account info is not a customer resource.
+func parseAccount(accountInfo *bytes.Buffer) *Account {
+	if accountInfo == nil {
+		return nil
+	}
+	var customer struct {
+		ResourceName    string `json:"resourceName"`
+		DescriptiveName string `json:"descriptiveName"`
+		CurrencyCode    string `json:"currencyCode"`
+		TimeZone        string `json:"timeZone"`
+		Manager         bool   `json:"manager"`
+		TestAccount     bool   `json:"testAccount"`
+	}
+	if err := json.Unmarshal(accountInfo.Bytes(), &customer); err != nil ||
+		!strings.HasPrefix(customer.ResourceName, "customers/") {
+		return nil
+	}
+	return &Account{
+		// The ID is taken from the resource name, since it is an int64
+		// that may be encoded as a string or a number
+		ID:              strings.TrimPrefix(customer.ResourceName, "customers/"),
+		DescriptiveName: customer.DescriptiveName,
+		CurrencyCode:    customer.CurrencyCode,
+		TimeZone:        customer.TimeZone,
+		Manager:         customer.Manager,
+		TestAccount:     customer.TestAccount,
+	}
+}
+
+// accountType returns TestAccountType or ProductionAccountType of the
+// account.
+func (a *Account) accountType() string {
+	if a.TestAccount {
+		return TestAccountType
+	}
+	return ProductionAccountType
+}
+
+// String returns the account info in a single line, e.g. "Example Inc.
+// (1234567890), USD, America/New_York, manager account".
+func (a *Account) String() string {
+	s := a.ID
+	if a.DescriptiveName != "" {
+		s = a.DescriptiveName + " (" + a.ID + ")"
+	}
+	for _, v := range []string{a.CurrencyCode, a.TimeZone} {
+		if v != "" {
+			s += ", " + v
+		}
+	}
+	if a.Manager {
+		s += ", manager account"
+	}
+	if a.TestAccount {
+		s += ", test account"
+	}
+	return s
+}
+
+// Summary is the result of diagnosing several customer IDs with the same
+// configuration, which is returned by SimulateOAuthFlows.
+type Summary struct {
+	// Success is true when the diagnosis of every customer ID succeeded.
+	Success bool `json:"success"`
+	// Reports are the results of the customer IDs in the given order.
+	Reports []Report `json:"reports"`
+	// DeadlineExceeded is true when the deadline passed before every
+	// customer ID was diagnosed.
+	DeadlineExceeded bool `json:"deadlineExceeded,omitempty"`
+	// Canceled is true when the diagnosis was canceled before every
+	// customer ID was diagnosed.
+	Canceled bool `json:"canceled,omitempty"`
+	// Passed and Failed are the numbers of the customer IDs whose diagnosis
+	// succeeded and failed.
+	Passed int `json:"passed"`
+	Failed int `json:"failed"`
+	// FailuresByCategory are the numbers of the failed customer IDs keyed
+	// by the ErrorCategory of their error, e.g. "credentials".
+	FailuresByCategory map[string]int `json:"failuresByCategory,omitempty"`
+	// Build is the build of the doctor, as in Report.
+	Build *Build `json:"build,omitempty"`
+}
+
+// add appends the report of a customer ID to the summary and counts it.
+func (s *Summary) add(r Report) {
+	s.Success = s.Success && r.Success
+	s.DeadlineExceeded = s.DeadlineExceeded || r.DeadlineExceeded
+	s.Canceled = s.Canceled || r.Canceled
+	s.Reports = append(s.Reports, r)
+	if r.Success {
+		s.Passed++
+		return
+	}
+	s.Failed++
+	if s.FailuresByCategory == nil {
+		s.FailuresByCategory = make(map[string]int)
+	}
+	s.FailuresByCategory[ErrorCategory(r.Code)]++
+}
+
+// Print prints the result of each customer ID in a table, followed by the
+// numbers of the passed and failed customer IDs, and returns Success.
+func (s Summary) Print() bool {
+	log.Println("Customer ID summary:")
+	for _, line := range strings.Split(strings.TrimSuffix(s.table(), "\n"), "\n") {
+		log.Print(line)
+	}
+	log.Print(s.counts())
+	if s.mixedAccountTypes() {
+		log.Print("Your developer token works with the test accounts but not " +
+			"with the production accounts above, since it is not approved yet. " +
+			"Please apply for Basic or Standard access to use it with production " +
+			"accounts: " + devTokenAccessURL)
+	}
+	if s.DeadlineExceeded {
+		log.Print("The deadline passed before the diagnosis completed, so the " +
+			"customer IDs that failed with DeadlineExceeded were not fully diagnosed.")
+	}
+	if s.Canceled {
+		log.Print("The diagnosis was canceled, so the customer IDs that failed " +
+			"with Canceled were not fully diagnosed.")
+	}
+	return s.Success
+}
+
+// table returns the aligned table of the results of the customer IDs. The
+// last column is the account of a success, and the recommended action of a
+// failure.
+func (s Summary) table() string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "CUSTOMER ID\tSTATUS\tERROR\tCATEGORY\tDETAILS")
+	for _, r := range s.Reports {
+		switch {
+		case r.Success && r.Account != nil:
+			fmt.Fprintf(w, "%s\tOK\t-\t-\t%s\n", r.CustomerID, r.Account)
+		case r.Success:
+			fmt.Fprintf(w, "%s\tOK\t-\t-\n", r.CustomerID)
+		default:
+			fmt.Fprintf(w, "%s\tERROR\t%s\t%s\t%s\n", r.CustomerID, r.Error,
+				ErrorCategory(r.Code), r.Remediation)
+		}
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// counts returns the numbers of the passed and failed customer IDs, e.g.
+// "Passed: 3, failed: 2 (credentials: 1, network: 1)".
+func (s Summary) counts() string {
+	msg := fmt.Sprintf("Passed: %d, failed: %d", s.Passed, s.Failed)
+	if len(s.FailuresByCategory) == 0 {
+		return msg
+	}
+	var categories []string
+	for category, n := range s.FailuresByCategory {
+		categories = append(categories, fmt.Sprintf("%s: %d", category, n))
+	}
+	sort.Strings(categories)
+	return msg + " (" + strings.Join(categories, ", ") + ")"
+}
+
+// mixedAccountTypes returns true when a test account succeeded and a
+// production account failed because the developer token is not approved,
+// which looks like the developer token works only sometimes.
+func (s Summary) mixedAccountTypes() bool {
+	var test, unapproved bool
+	for _, r := range s.Reports {
+		test = test || r.Success && r.AccountType == TestAccountType
+		unapproved = unapproved || r.Code == DevTokenNotApproved && r.Error != ""
+	}
+	return test && unapproved
+}
+
+// Verdict returns a single line that summarizes the diagnosis, e.g.
+// "PASS: 1234567890" or "FAIL: 1234567890 InvalidRefreshToken: Regenerate
+// ...". A failure names the error and the recommended action of every
+// customer ID that failed.
+func (s Summary) Verdict() string {
+	var passed, failed []string
+	for _, r := range s.Reports {
+		if r.Success {
+			passed = append(passed, r.CustomerID)
+		} else {
+			failed = append(failed, r.CustomerID+" "+r.Error+": "+r.Remediation)
+		}
+	}
+	if s.Success {
+		return "PASS: " + strings.Join(passed, ", ")
+	}
+	return "FAIL: " + strings.Join(failed, "; ")
+}
+
+// errorNames are the names of the error codes used in the Report.
+var errorNames = map[int32]string{
+	AccessNotPermittedForManagerAccount: "AccessNotPermittedForManagerAccount",
+	AccessTokenExpired:                  "AccessTokenExpired",
+	AudienceMismatch:                    "AudienceMismatch",
+	Canceled:                            "Canceled",
+	CertificateError:                    "CertificateError",
+	ClockSkew:                           "ClockSkew",
+	ConfigFileError:                     "ConfigFileError",
+	ConfigWarning:                       "ConfigWarning",
+	ConsentDenied:                       "ConsentDenied",
+	CustomerNotAccessible:               "CustomerNotAccessible",
+	CustomerNotEnabled:                  "CustomerNotEnabled",
+	DeadlineExceeded:                    "DeadlineExceeded",
+	DevTokenNotAllowlisted:              "DevTokenNotAllowlisted",
+	DevTokenNotApproved:                 "DevTokenNotApproved",
+	DevTokenProhibited:                  "DevTokenProhibited",
+	GoogleAdsAPIDisabled:                "GoogleAdsAPIDisabled",
+	ImpersonationDenied:                 "ImpersonationDenied",
+	InsufficientScope:                   "InsufficientScope",
+	InvalidClientInfo:                   "InvalidClientInfo",
+	InvalidCustomerID:                   "InvalidCustomerID",
+	InvalidDevToken:                     "InvalidDevToken",
+	InvalidRefreshToken:                 "InvalidRefreshToken",
+	MissingDevToken:                     "MissingDevToken",
+	NetworkUnreachable:                  "NetworkUnreachable",
+	RateLimited:                         "RateLimited",
+	RedirectURIMismatch:                 "RedirectURIMismatch",
+	RequestTimeout:                      "RequestTimeout",
+	ServiceAccountUnauthorized:          "ServiceAccountUnauthorized",
+	SubjectTokenError:                   "SubjectTokenError",
+	Unauthenticated:                     "Unauthenticated",
+	Unauthorized:                        "Unauthorized",
+	UnfilledConfigValue:                 "UnfilledConfigValue",
+	UnknownError:                        "UnknownError",
+	UserPermissionDenied:                "UserPermissionDenied",
+}
+
+// errorFields are the keys in the configuration file that are likely to
+// cause the errors.
+var errorFields = map[int32][]string{
+	AudienceMismatch:           {diag.JSONKeyFilePath},
+	CustomerNotAccessible:      {diag.LoginCustomerID},
+	DevTokenNotAllowlisted:     {diag.DevToken},
+	DevTokenNotApproved:        {diag.DevToken},
+	DevTokenProhibited:         {diag.DevToken, diag.ClientID},
+	ImpersonationDenied:        {diag.JSONKeyFilePath},
+	InsufficientScope:          {diag.RefreshToken},
+	InvalidClientInfo:          {diag.ClientID, diag.ClientSecret},
+	InvalidDevToken:            {diag.DevToken},
+	InvalidRefreshToken:        {diag.RefreshToken},
+	MissingDevToken:            {diag.DevToken},
+	ServiceAccountUnauthorized: {diag.JSONKeyFilePath, diag.ImpersonatedEmail},
+	SubjectTokenError:          {diag.JSONKeyFilePath},
+	Unauthenticated:            {diag.LoginCustomerID},
+	Unauthorized:               {diag.RefreshToken},
+	UserPermissionDenied:       {diag.LoginCustomerID},
+}
+
+// errorKeys returns the keys in the configuration file that are likely to
+// cause err of the error code. They are narrowed down from errorFields when
+// the error tells which of the keys is wrong.
+func errorKeys(code int32, err error) []string {
+	if code == InvalidClientInfo {
+		return rejectedClientKeys(err.Error())
+	}
+	return errorFields[code]
+}
+
+// ErrorName returns the name of the error code, e.g. InvalidRefreshToken.
+func ErrorName(code int32) string {
+	if name, ok := errorNames[code]; ok {
+		return name
+	}
+	return errorNames[UnknownError]
+}
+
+// fail records the diagnosed error in the report. keys are the keys in the
+// configuration file that are likely to cause the error.
+func (c *Config) fail(code int32, msg string, keys []string) {
+	c.report.Error = ErrorName(code)
+	c.report.Code = code
+	c.report.Message = c.redact(msg)
+	c.report.Fields = nil
+	for _, k := range keys {
+		c.report.Fields = append(c.report.Fields, c.ConfigFile.GetConfigKeysInLang(k))
+	}
+	c.report.Remediation = remediations[code]
+	c.report.ClockSkew = ""
+	c.report.AccountType = ""
+	if code == DevTokenNotApproved {
+		c.report.AccountType = ProductionAccountType
+	}
+}
+
+// onReport calls OnReport with the report of a customer ID if it is set.
+func (c *Config) onReport(r Report) {
+	if c.OnReport != nil {
+		c.OnReport(r)
+	}
+}
+
+// finish logs the result of the last attempt of the OAuth flow and records
+// it in the report. The error of the last attempt replaces the error of the
+// previous attempts in the report, unless the report already has its
+// diagnosis, e.g. with the remediation refined by diagnose.
+func (c *Config) finish(accountInfo *bytes.Buffer, err error) {
+	if err == nil {
+		if c.Verbose {
+			log.Print(c.redact(accountInfo.String()))
+		}
+		log.Println("SUCCESS: OAuth test passed with given config file settings.")
+		c.report.AccountType = ""
+		if c.report.Account = parseAccount(accountInfo); c.report.Account != nil {
+			log.Print("Account: " + c.report.Account.String())
+			c.report.AccountType = c.report.Account.accountType()
+		}
+	} else {
+		if c.Verbose {
+			log.Println(c.redact(err.Error()))
+		}
+		diag.Error("OAuth test failed.")
+		if c.report.Error == "" || c.diagnosedErr != err.Error() {
+			code, detail := c.decodeErrorDetail(err)
+			c.fail(code, detail.Message, errorKeys(code, err))
+			c.report.Remediation = detail.Remediation
+		}
+	}
+	c.report.Success = err == nil
+}
+
+// printWarnings prints the warnings of the diagnosis in a section after the
+// verdict, so that they are not lost in the output of the flow.
+func (c *Config) printWarnings() {
+	if len(c.report.Warnings) == 0 {
+		return
+	}
+	log.Print("Warnings:")
+	for _, w := range c.report.Warnings {
+		log.Printf("\t- %s", w)
+	}
+}
@@ -0,0 +1,265 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"oauthdoctor/diag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFinishReport(t *testing.T) {
+	tests := []struct {
+		desc        string
+		accountInfo string
+		err         error
+		want        Report
+	}{
+		{
+			desc: "Success",
+			want: Report{Success: true},
+		},
+		{
+			desc: "Success with the account info",
+			accountInfo: `{"resourceName": "customers/1234567890", "id": "1234567890", "descriptiveName": "Example Inc.",
+				"currencyCode": "USD", "timeZone": "America/New_York", "manager": true, "testAccount": false}`,
+			want: Report{Success: true, Account: &Account{
+				ID:              "1234567890",
+				DescriptiveName: "Example Inc.",
+				CurrencyCode:    "USD",
+				TimeZone:        "America/New_York",
+				Manager:         true,
+			}, AccountType: ProductionAccountType},
+		},
+		{
+			desc:        "Success with a test account",
+			accountInfo: `{"resourceName": "customers/1234567890", "testAccount": true}`,
+			want: Report{Success: true, Account: &Account{ID: "1234567890", TestAccount: true},
+				AccountType: TestAccountType},
+		},
+		{
+			desc: "Developer token not approved for a production account",
+			err: errors.New(`{"error": {"code": 403, "message": "The caller does not have permission", "status": "PERMISSION_DENIED",
+				"details": [{"errors": [{"errorCode": {"authorizationError": "DEVELOPER_TOKEN_NOT_APPROVED"},
+				"message": "The developer token is only approved for use with test accounts."}]}]}}`),
+			want: Report{
+				Error:       "DevTokenNotApproved",
+				Code:        DevTokenNotApproved,
+				Message:     "The developer token is only approved for use with test accounts.",
+				Fields:      []string{"developer_token"},
+				Remediation: remediations[DevTokenNotApproved],
+				AccountType: ProductionAccountType,
+			},
+		},
+		{
+			desc: "User permission denied",
+			err: errors.New(`{"error": {"code": 403, "message": "The caller does not have permission", "status": "PERMISSION_DENIED",
+				"details": [{"errors": [{"errorCode": {"authorizationError": "USER_PERMISSION_DENIED"},
+				"message": "User doesn't have permission to access customer."}]}]}}`),
+			want: Report{
+				Error:       "UserPermissionDenied",
+				Code:        UserPermissionDenied,
+				Message:     "User doesn't have permission to access customer.",
+				Fields:      []string{"login_customer_id"},
+				Remediation: remediations[UserPermissionDenied],
+			},
+		},
+		{
+			desc: "Invalid refresh token with the secret redacted",
+			err:  errors.New(`oauth2: cannot fetch token: 400 Bad Request Response: {"error": "invalid_grant", "refresh_token": "BadRefreshToken"}`),
+			want: Report{
+				Error:       "InvalidRefreshToken",
+				Code:        InvalidRefreshToken,
+				Message:     `oauth2: cannot fetch token: 400 Bad Request Response: {"error": "invalid_grant", "refresh_token": "` + diag.Mask + `"}`,
+				Fields:      []string{"refresh_token"},
+				Remediation: remediations[InvalidRefreshToken],
+			},
+		},
+	}
+
+	for _, test := range tests {
+		c := &Config{ConfigFile: diag.ConfigFile{
+			Lang:       "python",
+			ConfigKeys: diag.ConfigKeys{RefreshToken: "BadRefreshToken"},
+		}}
+		c.finish(bytes.NewBufferString(test.accountInfo), test.err)
+
+		if !reflect.DeepEqual(c.report, test.want) {
+			t.Errorf("%s: got: %+v, want: %+v", test.desc, c.report, test.want)
+		}
+		if _, err := json.Marshal(c.report); err != nil {
+			t.Errorf("%s: cannot marshal the report: %s", test.desc, err)
+		}
+	}
+}
+
+func TestFinishReportLastError(t *testing.T) {
+	rateErr := &APIError{StatusCode: 429, Body: `{"error": {"code": 429, "status": "RESOURCE_EXHAUSTED"}}`}
+	notFoundErr := errors.New(`{"error": {"code": 403, "message": "The caller does not have permission", "status": "PERMISSION_DENIED",
+		"details": [{"errors": [{"errorCode": {"authorizationError": "CUSTOMER_NOT_FOUND"}}]}]}}`)
+	c := &Config{
+		CustomerID:     "1234567890",
+		NonInteractive: true,
+		ConfigFile:     diag.ConfigFile{Lang: "python"},
+	}
+
+	// The first attempt is rate limited, and the retry fails with another
+	// error
+	c.diagnose(context.Background(), rateErr)
+	c.finish(nil, notFoundErr)
+	if c.report.Code != CustomerNotAccessible || c.report.Remediation != remediations[CustomerNotAccessible] {
+		t.Errorf("report - got: %s %q, want: CustomerNotAccessible", c.report.Error, c.report.Remediation)
+	}
+
+	// The diagnosis of the last error is kept
+	c.diagnose(context.Background(), rateErr)
+	c.report.Remediation = "Refined remediation"
+	c.finish(nil, rateErr)
+	if c.report.Code != RateLimited || c.report.Remediation != "Refined remediation" {
+		t.Errorf("report - got: %s %q, want: RateLimited with the refined remediation",
+			c.report.Error, c.report.Remediation)
+	}
+}
+
+func TestAccountString(t *testing.T) {
+	tests := []struct {
+		account Account
+		want    string
+	}{
+		{
+			account: Account{ID: "1234567890", DescriptiveName: "Example Inc.", CurrencyCode: "USD",
+				TimeZone: "America/New_York", Manager: true},
+			want: "Example Inc. (1234567890), USD, America/New_York, manager account",
+		},
+		{
+			account: Account{ID: "1234567890", TestAccount: true},
+			want:    "1234567890, test account",
+		},
+	}
+
+	for _, test := range tests {
+		if got := test.account.String(); got != test.want {
+			t.Errorf("String() - got: %q, want: %q", got, test.want)
+		}
+	}
+}
+
+func TestSummaryVerdict(t *testing.T) {
+	tests := []struct {
+		desc    string
+		summary Summary
+		want    string
+	}{
+		{
+			desc: "Success",
+			summary: Summary{Success: true, Reports: []Report{
+				{Success: true, CustomerID: "1234567890"},
+				{Success: true, CustomerID: "2345678901"},
+			}},
+			want: "PASS: 1234567890, 2345678901",
+		},
+		{
+			desc: "Failure",
+			summary: Summary{Reports: []Report{
+				{Success: true, CustomerID: "1234567890"},
+				{CustomerID: "2345678901", Error: "RateLimited", Remediation: "Retry later."},
+			}},
+			want: "FAIL: 2345678901 RateLimited: Retry later.",
+		},
+	}
+
+	for _, test := range tests {
+		if got := test.summary.Verdict(); got != test.want {
+			t.Errorf("%s: got: %q, want: %q", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestSummaryCounts(t *testing.T) {
+	s := Summary{Success: true}
+	s.add(Report{Success: true, CustomerID: "1234567890"})
+	s.add(Report{CustomerID: "2345678901", Error: "RateLimited", Code: RateLimited, Remediation: "Retry later."})
+	s.add(Report{CustomerID: "3456789012", Error: "InvalidRefreshToken", Code: InvalidRefreshToken, Remediation: "Regenerate it."})
+	s.add(Report{CustomerID: "4567890123", Error: "RequestTimeout", Code: RequestTimeout, Remediation: "Retry later."})
+
+	if s.Success || s.Passed != 1 || s.Failed != 3 {
+		t.Errorf("got success %t, %d passed and %d failed, want false, 1 and 3", s.Success, s.Passed, s.Failed)
+	}
+	want := "Passed: 1, failed: 3 (credentials: 1, network: 2)"
+	if got := s.counts(); got != want {
+		t.Errorf("counts - got: %q, want: %q", got, want)
+	}
+
+	table := strings.Split(strings.TrimSuffix(s.table(), "\n"), "\n")
+	if len(table) != 5 {
+		t.Fatalf("table - got %d lines, want a header and 4 rows:\n%s", len(table), s.table())
+	}
+	// The columns are aligned
+	column := strings.Index(table[0], "STATUS")
+	for _, line := range table[1:] {
+		if !strings.HasPrefix(line[column:], "OK") && !strings.HasPrefix(line[column:], "ERROR") {
+			t.Errorf("table - got the STATUS column misaligned in %q", line)
+		}
+	}
+	if !strings.Contains(table[2], "RateLimited") || !strings.Contains(table[2], "network") ||
+		!strings.HasSuffix(table[2], "Retry later.") {
+		t.Errorf("table - got: %q, want the error, the category and the recommended action", table[2])
+	}
+}
+
+func TestSummaryMixedAccountTypes(t *testing.T) {
+	test := Report{Success: true, CustomerID: "1234567890", AccountType: TestAccountType}
+	production := Report{Success: true, CustomerID: "2345678901", AccountType: ProductionAccountType}
+	unapproved := Report{CustomerID: "3456789012", Error: "DevTokenNotApproved", Code: DevTokenNotApproved,
+		AccountType: ProductionAccountType}
+	tests := []struct {
+		desc    string
+		reports []Report
+		want    bool
+	}{
+		{desc: "Test and unapproved production accounts", reports: []Report{test, unapproved}, want: true},
+		{desc: "Only unapproved production accounts", reports: []Report{unapproved}, want: false},
+		{desc: "Test and production accounts", reports: []Report{test, production}, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := (Summary{Reports: tt.reports}).mixedAccountTypes(); got != tt.want {
+			t.Errorf("%s: got: %t, want: %t", tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestBuildString(t *testing.T) {
+	tests := []struct {
+		build Build
+		want  string
+	}{
+		{
+			build: Build{Version: "1.2.0", Commit: "0e08443", Date: "2024-06-01T12:00:00Z"},
+			want:  "oauthdoctor 1.2.0 (commit 0e08443, built 2024-06-01T12:00:00Z)",
+		},
+		{build: Build{Version: "dev"}, want: "oauthdoctor dev"},
+	}
+
+	for _, test := range tests {
+		if got := test.build.String(); got != test.want {
+			t.Errorf("String() - got: %q, want: %q", got, test.want)
+		}
+	}
+}
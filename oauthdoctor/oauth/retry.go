@@ -0,0 +1,115 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains the retry of the transient failures of the Google Ads
+// API requests.
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/url"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	// DefaultMaxAttempts is the number of attempts of a Google Ads API
+	// request when none is given.
+	DefaultMaxAttempts = 3
+	// DefaultRetryDelay is the delay before the first retry when none is
+	// given. It doubles after each attempt.
+	DefaultRetryDelay = time.Second
+)
+
+// retry calls op until it succeeds, it returns an error that is not
+// retryable, or MaxAttempts is reached, and returns the last error. The
+// delay between the attempts grows exponentially from RetryDelay with
+// jitter, unless the APIError returned by op suggests a delay. It stops
+// early when the next attempt would start after the deadline of ctx.
+func (c *Config) retry(ctx context.Context, op func() (retryable bool, err error)) error {
+	attempts := c.MaxAttempts
+	if attempts <= 0 {
+		attempts = DefaultMaxAttempts
+	}
+	delay := c.RetryDelay
+	if delay <= 0 {
+		delay = DefaultRetryDelay
+	}
+
+	for i := 1; ; i++ {
+		retryable, err := op()
+		if err == nil || !retryable || i >= attempts {
+			return err
+		}
+
+		d := backoff(delay, i)
+		if e, ok := err.(*APIError); ok {
+			if after, ok := e.RetryAfter(); ok {
+				d = after
+			}
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(d).After(deadline) {
+			return err
+		}
+		if c.Verbose {
+			log.Printf("Attempt %d of %d failed, retrying in %s: %s",
+				i, attempts, d, c.redact(err.Error()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(d):
+		}
+	}
+}
+
+// backoff returns the delay after the given number of attempts, which is
+// base * 2^(attempt-1) plus a random jitter of up to 50%.
+func backoff(base time.Duration, attempt int) time.Duration {
+	d := base << uint(attempt-1)
+	return d + time.Duration(rand.Int63n(int64(d)/2+1))
+}
+
+// isRetryableError reports whether the error returned by http.Client.Do is
+// a transient connection error. The errors from the token endpoint are only
+// retryable when the endpoint responds with a 5xx status.
+func isRetryableError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	uerr, ok := err.(*url.Error)
+	if !ok {
+		return false
+	}
+	switch e := uerr.Err.(type) {
+	case *oauth2.RetrieveError:
+		return e.Response != nil && e.Response.StatusCode >= 500
+	case net.Error:
+		return true
+	}
+	return uerr.Err == io.EOF || uerr.Err == io.ErrUnexpectedEOF
+}
+
+// isRetryableStatus reports whether the Google Ads API response is a
+// transient failure, i.e. a 5xx status or RESOURCE_EXHAUSTED.
+func isRetryableStatus(status int, body []byte) bool {
+	return status >= 500 || bytes.Contains(body, []byte("RESOURCE_EXHAUSTED"))
+}
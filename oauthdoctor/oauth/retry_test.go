@@ -0,0 +1,185 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeResponse is a canned response of sequenceTransport. The response is
+// an error when err is not nil.
+type fakeResponse struct {
+	status int
+	header http.Header
+	body   string
+	err    error
+}
+
+// sequenceTransport is a http.RoundTripper that returns the canned
+// responses in order, and repeats the last one.
+type sequenceTransport struct {
+	responses []fakeResponse
+	calls     int
+}
+
+func (s *sequenceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := s.responses[len(s.responses)-1]
+	if s.calls < len(s.responses) {
+		r = s.responses[s.calls]
+	}
+	s.calls++
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	header := r.header
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		StatusCode: r.status,
+		Header:     header,
+		Body:       ioutil.NopCloser(strings.NewReader(r.body)),
+		Request:    req,
+	}, nil
+}
+
+func TestGetAccountRetry(t *testing.T) {
+	ok := fakeResponse{status: http.StatusOK, body: `{"resourceName": "customers/1234567890"}`}
+	unavailable := fakeResponse{status: http.StatusServiceUnavailable,
+		body: `{"error": {"code": 503, "message": "The service is currently unavailable.", "status": "UNAVAILABLE"}}`}
+	exhausted := fakeResponse{status: http.StatusTooManyRequests,
+		body: `{"error": {"code": 429, "message": "Resource has been exhausted.", "status": "RESOURCE_EXHAUSTED"}}`}
+	unauthenticated := fakeResponse{status: http.StatusUnauthorized,
+		body: `{"error": {"code": 401, "message": "Request had invalid authentication credentials.", "status": "UNAUTHENTICATED"}}`}
+	connReset := fakeResponse{err: &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}}
+
+	tests := []struct {
+		desc      string
+		responses []fakeResponse
+		wantErr   bool
+		wantCalls int
+	}{
+		{desc: "Success", responses: []fakeResponse{ok}, wantCalls: 1},
+		{desc: "5xx then success", responses: []fakeResponse{unavailable, ok}, wantCalls: 2},
+		{desc: "RESOURCE_EXHAUSTED then success", responses: []fakeResponse{exhausted, ok}, wantCalls: 2},
+		{desc: "Connection error then success", responses: []fakeResponse{connReset, connReset, ok}, wantCalls: 3},
+		{desc: "5xx until max attempts", responses: []fakeResponse{unavailable}, wantErr: true, wantCalls: 3},
+		{desc: "4xx is not retried", responses: []fakeResponse{unauthenticated, ok}, wantErr: true, wantCalls: 1},
+	}
+
+	for _, test := range tests {
+		transport := &sequenceTransport{responses: test.responses}
+		c := &Config{
+			CustomerID: "1234567890",
+			HTTPClient: &http.Client{Transport: transport},
+			RetryDelay: time.Millisecond,
+		}
+
+		_, err := c.getAccount(context.Background(), c.httpClient())
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: error - got: %v, want error: %t", test.desc, err, test.wantErr)
+		}
+		if transport.calls != test.wantCalls {
+			t.Errorf("%s: attempts - got: %d, want: %d", test.desc, transport.calls, test.wantCalls)
+		}
+	}
+}
+
+func TestRetryRespectsDeadline(t *testing.T) {
+	c := &Config{RetryDelay: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	calls := 0
+	start := time.Now()
+	err := c.retry(ctx, func() (bool, error) {
+		calls++
+		return true, errors.New("transient error")
+	})
+	if err == nil {
+		t.Fatal("retry returned no error")
+	}
+	if calls != 1 {
+		t.Errorf("attempts - got: %d, want: 1", calls)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("retry waited for %s past the deadline", elapsed)
+	}
+}
+
+func TestGetAccountRetryAfter(t *testing.T) {
+	transport := &sequenceTransport{responses: []fakeResponse{
+		{
+			status: http.StatusTooManyRequests,
+			header: http.Header{"Retry-After": {"0"}, "X-Goog-Quota-Remaining": {"0"}, "Server": {"ESF"}},
+			body:   `{"error": {"code": 429, "message": "Resource has been exhausted.", "status": "RESOURCE_EXHAUSTED"}}`,
+		},
+		{status: http.StatusOK, body: `{"resourceName": "customers/1234567890"}`},
+	}}
+	// The Retry-After header overrides the retry delay
+	c := &Config{
+		CustomerID: "1234567890",
+		HTTPClient: &http.Client{Transport: transport},
+		RetryDelay: time.Hour,
+	}
+
+	if _, err := c.getAccount(context.Background(), c.httpClient()); err != nil {
+		t.Fatalf("getAccount returned error: %s", err)
+	}
+	if transport.calls != 2 {
+		t.Errorf("attempts - got: %d, want: 2", transport.calls)
+	}
+}
+
+func TestGetAccountAPIError(t *testing.T) {
+	transport := &sequenceTransport{responses: []fakeResponse{{
+		status: http.StatusTooManyRequests,
+		header: http.Header{"Retry-After": {"120"}, "X-Goog-Quota-Remaining": {"0"}, "Server": {"ESF"}},
+		body:   `{"error": {"code": 429, "message": "Resource has been exhausted.", "status": "RESOURCE_EXHAUSTED"}}`,
+	}}}
+	c := &Config{
+		CustomerID:  "1234567890",
+		HTTPClient:  &http.Client{Transport: transport},
+		MaxAttempts: 1,
+	}
+
+	_, err := c.getAccount(context.Background(), c.httpClient())
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		t.Fatalf("getAccount error - got: %#v, want: *APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("status code - got: %d, want: %d", apiErr.StatusCode, http.StatusTooManyRequests)
+	}
+	if got := apiErr.Header.Get("X-Goog-Quota-Remaining"); got != "0" {
+		t.Errorf("quota header - got: %q, want: %q", got, "0")
+	}
+	if got := apiErr.Header.Get("Server"); got != "" {
+		t.Errorf("unrelated header is kept - got: %q", got)
+	}
+	if d, ok := apiErr.RetryAfter(); !ok || d != 2*time.Minute {
+		t.Errorf("RetryAfter - got: %s, %t, want: %s", d, ok, 2*time.Minute)
+	}
+	if got := c.decodeError(err); got != RateLimited {
+		t.Errorf("decodeError - got: %d, want: %d", got, RateLimited)
+	}
+}
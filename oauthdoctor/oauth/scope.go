@@ -0,0 +1,130 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains the OAuth2 scopes requested in the flows. The Google Ads
+// API scope is always requested, and other scopes can be added, e.g. when
+// the same refresh token is used for other Google APIs.
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"oauthdoctor/diag"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// identityScopes are the OpenID Connect scopes, which are not URLs.
+var identityScopes = []string{"email", "openid", "profile"}
+
+// ParseScopes splits a comma or space separated list of OAuth2 scopes, e.g.
+// https://www.googleapis.com/auth/drive, and verifies each of them. The
+// Google Ads API scope is added first when it is missing, and duplicates
+// are removed.
+func ParseScopes(s string) ([]string, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+	scopes := []string{AdwordsScope}
+	for _, scope := range fields {
+		if !diag.Contains(identityScopes, scope) {
+			u, err := url.Parse(scope)
+			if err != nil || u.Scheme != "https" || u.Host == "" {
+				return nil, fmt.Errorf("invalid scope %q: a scope must be an https URL, e.g. %s", scope, AdwordsScope)
+			}
+		}
+		if !diag.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// scopes returns the OAuth2 scopes requested in the flows, which always
+// include the Google Ads API scope.
+func (c *Config) scopes() []string {
+	if diag.Contains(c.Scopes, AdwordsScope) {
+		return c.Scopes
+	}
+	return append([]string{AdwordsScope}, c.Scopes...)
+}
+
+// grantedScopes returns the scopes that the token endpoint granted to the
+// access token. It returns nil when the token response has no scope.
+func grantedScopes(token *oauth2.Token) []string {
+	scope, _ := token.Extra("scope").(string)
+	return strings.Fields(scope)
+}
+
+// checkTokenScopes verifies that the access token was granted the requested
+// scopes. It returns an insufficient_scope error when the Google Ads API
+// scope is missing, i.e. the refresh token was generated without it, and
+// warns about the other missing scopes. Nothing is checked when the token
+// endpoint does not return the granted scopes.
+func (c *Config) checkTokenScopes(token *oauth2.Token) error {
+	granted := grantedScopes(token)
+	if len(granted) == 0 {
+		return nil
+	}
+	if !diag.Contains(granted, AdwordsScope) {
+		return fmt.Errorf("insufficient_scope: the access token was granted %s without the %s scope",
+			strings.Join(granted, " "), AdwordsScope)
+	}
+	var missing []string
+	for _, scope := range c.scopes() {
+		if !diag.Contains(granted, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	if len(missing) > 0 {
+		c.warnf("The refresh token was not granted the scopes %s. Other Google "+
+			"APIs using these scopes will fail with this refresh token.", strings.Join(missing, ", "))
+	} else if c.Verbose {
+		log.Printf("The access token was granted the scopes %s.", strings.Join(granted, ", "))
+	}
+	return nil
+}
+
+// diagnoseInsufficientScope explains that the credentials are valid but the
+// access token was not granted the Google Ads API scope, which is a different
+// problem from an invalid refresh token. In the installed app flow, it offers
+// to generate a new refresh token with the scope right away. It returns false
+// when the user declines, and for a service account, whose scopes are only
+// granted in the Google Workspace admin console.
+func (c *Config) diagnoseInsufficientScope() bool {
+	if c.OAuthType == ServiceAccount {
+		diag.Error("Your service account is valid, but its access token " +
+			"was not granted the " + AdwordsScope + " scope.")
+		log.Print("Please grant the " + AdwordsScope + " scope to the service " +
+			"account in the domain-wide delegation of your Google Workspace.")
+		return false
+	}
+	diag.Error("Your refresh token is valid, but it was generated without " +
+		"access to the Google Ads API.")
+	log.Print("The refresh token must be regenerated with the " + AdwordsScope +
+		" scope. Please grant access to the Google Ads API in the consent " +
+		"screen when the new refresh token is generated.")
+
+	if c.NonInteractive || c.OAuthType != InstalledApp {
+		return true
+	}
+	if c.confirm("Would you like to run the installed app flow now to "+
+		"generate a new refresh token with the Google Ads API scope?", true) {
+		return true
+	}
+	log.Print("The installed app flow is NOT run")
+	return false
+}
@@ -0,0 +1,115 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+const driveScope = "https://www.googleapis.com/auth/drive"
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		scopes string
+		want   []string
+		valid  bool
+	}{
+		{scopes: driveScope, want: []string{AdwordsScope, driveScope}, valid: true},
+		{scopes: driveScope + ", " + AdwordsScope, want: []string{AdwordsScope, driveScope}, valid: true},
+		{scopes: "openid email " + driveScope + " " + driveScope, want: []string{AdwordsScope, "openid", "email", driveScope}, valid: true},
+		{scopes: AdwordsScope, want: []string{AdwordsScope}, valid: true},
+		{scopes: "drive", valid: false},
+		{scopes: "http://www.googleapis.com/auth/drive", valid: false},
+	}
+
+	for _, test := range tests {
+		got, err := ParseScopes(test.scopes)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("ParseScopes(%q) - got valid: %t, want valid: %t, err: %v",
+				test.scopes, valid, test.valid, err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseScopes(%q) - got: %v, want: %v", test.scopes, got, test.want)
+		}
+	}
+}
+
+func TestCheckTokenScopes(t *testing.T) {
+	tests := []struct {
+		desc    string
+		scopes  []string
+		granted string
+		errstr  string
+	}{
+		{desc: "no granted scopes in the token response", errstr: ""},
+		{desc: "Google Ads API scope granted", granted: AdwordsScope, errstr: ""},
+		{desc: "missing additional scope", scopes: []string{AdwordsScope, driveScope}, granted: AdwordsScope, errstr: ""},
+		{desc: "missing Google Ads API scope", granted: driveScope, errstr: "insufficient_scope"},
+	}
+
+	for _, test := range tests {
+		c := &Config{Scopes: test.scopes}
+		token := (&oauth2.Token{AccessToken: "AccessToken"}).WithExtra(map[string]interface{}{
+			"scope": test.granted,
+		})
+		err := c.checkTokenScopes(token)
+		if test.errstr == "" && err != nil {
+			t.Errorf("checkTokenScopes (%s) - got error: %s, want: nil", test.desc, err)
+		}
+		if test.errstr != "" && (err == nil || !strings.Contains(err.Error(), test.errstr)) {
+			t.Errorf("checkTokenScopes (%s) - got error: %v, want: %q", test.desc, err, test.errstr)
+		}
+	}
+}
+
+func TestDiagnoseInsufficientScope(t *testing.T) {
+	scopeErr := errors.New(`{"error": {"code": 403, "message": "Request had insufficient authentication scopes.", "status": "PERMISSION_DENIED",
+		"details": [{"reason": "ACCESS_TOKEN_SCOPE_INSUFFICIENT"}]}}`)
+	tests := []struct {
+		desc string
+		c    *Config
+		want bool
+	}{
+		{
+			desc: "Installed app flow is run when confirmed",
+			c:    &Config{AssumeYes: true, OAuthType: InstalledApp},
+			want: true,
+		},
+		{
+			desc: "Non-interactive mode is not retried",
+			c:    &Config{NonInteractive: true, OAuthType: InstalledApp},
+			want: false,
+		},
+		{
+			desc: "Service account is not retried",
+			c:    &Config{OAuthType: ServiceAccount, Prompter: &scriptedPrompter{}},
+			want: false,
+		},
+	}
+
+	for _, test := range tests {
+		if got := test.c.diagnose(context.Background(), scopeErr); got != test.want {
+			t.Errorf("%s: diagnose - got: %t, want: %t", test.desc, got, test.want)
+		}
+		if got := test.c.report.Remediation; got != remediations[InsufficientScope] {
+			t.Errorf("%s: remediation - got: %q, want: %q", test.desc, got, remediations[InsufficientScope])
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains functions that are specific to service account OAuth
+// flow. A service account authenticates with a JSON key file and
+// impersonates a user that has access to the Google Ads account.
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// simulateServiceAccountFlow simulates the service account flow to see if it
+// succeeds or fails. If it fails, it will try to examine the error and prompt
+// user to fix it. Then it retries to connect again, see fixAndRetry, and
+// prints the result of the last attempt.
+func (c *Config) simulateServiceAccountFlow(ctx context.Context) {
+	if c.isExternalAccount() {
+		c.simulateExternalAccountFlow(ctx)
+		return
+	}
+
+	accountInfo, err := c.connectWithServiceAccount(ctx)
+	accountInfo, err = c.fixAndRetry(ctx, accountInfo, err, func(error) (*bytes.Buffer, error) {
+		return c.connectWithServiceAccount(ctx)
+	})
+
+	c.finish(accountInfo, err)
+}
+
+// connectWithServiceAccount loads the JSON key file given in the client lib
+// config file, mints an access token for the impersonated user and gets the
+// account info.
+func (c *Config) connectWithServiceAccount(ctx context.Context) (*bytes.Buffer, error) {
+	if c.ConfigFile.JSONKeyFilePath == "" {
+		return nil, errors.New("service account JSON key file path is not set in the configuration file")
+	}
+
+	key, err := ioutil.ReadFile(c.ConfigFile.JSONKeyFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	conf, err := google.JWTConfigFromJSON(key, c.scopes()...)
+	if err != nil {
+		return nil, err
+	}
+	conf.Subject = c.ConfigFile.ImpersonatedEmail
+	conf.TokenURL = c.tokenURL()
+
+	oauth2Ctx := c.oauth2Context(ctx)
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	// Mint the token up front, so token endpoint errors are reported before
+	// the Google Ads API request is made.
+	ts := c.tokenSource(func() oauth2.TokenSource {
+		return conf.TokenSource(oauth2Ctx)
+	})
+	if _, err := ts.Token(); err != nil {
+		return nil, err
+	}
+
+	accountInfo, err := c.getAccount(ctx, c.newClient(ts))
+	c.cacheToken(ts, err)
+	return accountInfo, err
+}
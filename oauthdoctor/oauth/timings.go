@@ -0,0 +1,121 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains the timings of the steps of a diagnosis, which tell a
+// slow token exchange from a slow Google Ads API.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timings are the durations of the steps of a diagnosis in milliseconds.
+// The retries of a step are included in its duration.
+type Timings struct {
+	// TokenExchangeMs is the duration of the requests to the OAuth2 token
+	// endpoints, e.g. the exchange of the refresh token.
+	TokenExchangeMs int64 `json:"tokenExchangeMs"`
+	// GetAccountMs is the duration of the Google Ads API requests of the
+	// account of the customer ID.
+	GetAccountMs int64 `json:"getAccountMs"`
+	// TotalMs is the duration of the whole diagnosis of the customer ID,
+	// including the prompts and the remediations.
+	TotalMs int64 `json:"totalMs"`
+}
+
+// String returns the timings in a single line, e.g. "token exchange 120 ms,
+// getAccount 340 ms, total 910 ms".
+func (t *Timings) String() string {
+	return fmt.Sprintf("token exchange %d ms, getAccount %d ms, total %d ms",
+		t.TokenExchangeMs, t.GetAccountMs, t.TotalMs)
+}
+
+// timer sums the durations of the requests made with a context of
+// withTimer. It is shared by the requests of the token source and of the
+// Google Ads API client, which may run in other goroutines.
+type timer struct {
+	mu         sync.Mutex
+	start      time.Time
+	token      time.Duration
+	getAccount time.Duration
+}
+
+type timerKey struct{}
+
+// accountRequestKey marks the context of the getAccount requests.
+type accountRequestKey struct{}
+
+// withTimer returns a copy of ctx whose requests are timed by the returned
+// timer.
+func withTimer(ctx context.Context) (context.Context, *timer) {
+	t := &timer{start: time.Now()}
+	return context.WithValue(ctx, timerKey{}, t), t
+}
+
+// recordRequest records the duration of a request of ctx in its timer, if
+// there's any. The requests made by getAccount are recorded as such, and the
+// requests to the token URL or to another host than the Google Ads API as
+// token exchanges.
+func recordRequest(ctx context.Context, t *timingTransport, url string, d time.Duration) {
+	tm, ok := ctx.Value(timerKey{}).(*timer)
+	if !ok {
+		return
+	}
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	switch {
+	case ctx.Value(accountRequestKey{}) != nil:
+		tm.getAccount += d
+	case url == t.tokenURL || !strings.HasPrefix(url, t.apiURL):
+		tm.token += d
+	}
+}
+
+// timings returns the durations recorded so far, with the total measured
+// from the creation of the timer.
+func (t *timer) timings() *Timings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return &Timings{
+		TokenExchangeMs: milliseconds(t.token),
+		GetAccountMs:    milliseconds(t.getAccount),
+		TotalMs:         milliseconds(time.Since(t.start)),
+	}
+}
+
+func milliseconds(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
+
+// timingTransport records the duration of each request in the timer of its
+// context. apiURL and tokenURL are the base URL of the Google Ads API and
+// the URL of the OAuth2 token endpoint.
+type timingTransport struct {
+	apiURL   string
+	tokenURL string
+	base     http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *timingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	recordRequest(req.Context(), t, req.URL.String(), time.Since(start))
+	return resp, err
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"oauthdoctor/diag"
+)
+
+func TestSimulateOAuthFlowTimings(t *testing.T) {
+	// The token exchange is slower than the Google Ads API request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/token" {
+			time.Sleep(60 * time.Millisecond)
+			fmt.Fprint(w, `{"access_token": "AccessToken", "token_type": "Bearer", "expires_in": 3600}`)
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+		fmt.Fprint(w, `{"resourceName": "customers/1234567890"}`)
+	}))
+	defer server.Close()
+
+	c := &Config{
+		CustomerID:     "1234567890",
+		Endpoint:       server.URL,
+		NonInteractive: true,
+		OAuthType:      InstalledApp,
+		Timings:        true,
+		TokenEndpoint:  server.URL + "/token",
+		reachable:      true,
+		ConfigFile: diag.ConfigFile{
+			Lang: "python",
+			ConfigKeys: diag.ConfigKeys{
+				ClientID:     "ClientID.apps.googleusercontent.com",
+				ClientSecret: "ClientSecret",
+				DevToken:     "GoodDevToken",
+				RefreshToken: "GoodRefreshToken",
+			},
+		},
+	}
+	r := c.SimulateOAuthFlow(context.Background())
+	if !r.Success {
+		t.Fatalf("report - got: %+v, want success", r)
+	}
+
+	tm := r.Timings
+	if tm == nil {
+		t.Fatal("timings - got nil, want the timings")
+	}
+	if tm.TokenExchangeMs < 60 || tm.GetAccountMs < 20 || tm.GetAccountMs >= tm.TokenExchangeMs {
+		t.Errorf("timings - got: %s, want a token exchange of at least 60 ms and a getAccount of at least 20 ms", tm)
+	}
+	if tm.TotalMs < tm.TokenExchangeMs+tm.GetAccountMs {
+		t.Errorf("timings - got: %s, want a total of at least the sum of the steps", tm)
+	}
+
+	// The timings are not recorded by default
+	c.Timings = false
+	if r := c.SimulateOAuthFlow(context.Background()); r.Timings != nil {
+		t.Errorf("timings without Timings - got: %s, want nil", r.Timings)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains the on-disk cache of the OAuth2 tokens minted by the
+// auth dialog, which saves the browser flow on the next runs.
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/oauth2"
+)
+
+// TokenCache stores the OAuth2 token of a client ID and secret between the
+// runs of the doctor. It is implemented by NewFileTokenCache.
+type TokenCache interface {
+	// Load returns the cached token of the client ID and secret. It returns
+	// nil without an error when no token is cached for them.
+	Load(clientID, clientSecret string) (*oauth2.Token, error)
+	// Save caches the token of the client ID and secret, replacing the
+	// token of any other client.
+	Save(clientID, clientSecret string, token *oauth2.Token) error
+	// Clear removes the cached token.
+	Clear() error
+}
+
+// fileTokenCache is a TokenCache in a JSON file that only the user can read.
+type fileTokenCache struct {
+	path string
+}
+
+// cachedToken is the content of the token cache file. The client secret is
+// only stored as a hash, which is enough to tell that it has changed.
+type cachedToken struct {
+	ClientID         string        `json:"clientId"`
+	ClientSecretHash string        `json:"clientSecretHash"`
+	Token            *oauth2.Token `json:"token"`
+}
+
+// NewFileTokenCache returns a TokenCache in the file at path, which is
+// created with 0600 permissions when a token is saved.
+func NewFileTokenCache(path string) TokenCache {
+	return &fileTokenCache{path: path}
+}
+
+// DefaultTokenCachePath returns the path of the token cache file in the user
+// cache directory, e.g. ~/.cache/oauthdoctor/token.json on Linux.
+func DefaultTokenCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "oauthdoctor", "token.json"), nil
+}
+
+// secretHash returns the hex SHA-256 hash of the client secret.
+func secretHash(clientSecret string) string {
+	sum := sha256.Sum256([]byte(clientSecret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Load returns the cached token when it was saved for the same client ID and
+// secret. The cache is invalidated when either of them has changed, since
+// the token cannot be refreshed with another client.
+func (f *fileTokenCache) Load(clientID, clientSecret string) (*oauth2.Token, error) {
+	content, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cached cachedToken
+	if err := json.Unmarshal(content, &cached); err != nil {
+		return nil, err
+	}
+	if cached.ClientID != clientID || cached.ClientSecretHash != secretHash(clientSecret) {
+		log.Printf("The cached token in %s is for another client ID or secret. "+
+			"It is removed.", f.path)
+		return nil, f.Clear()
+	}
+	return cached.Token, nil
+}
+
+func (f *fileTokenCache) Save(clientID, clientSecret string, token *oauth2.Token) error {
+	content, err := json.MarshalIndent(cachedToken{
+		ClientID:         clientID,
+		ClientSecretHash: secretHash(clientSecret),
+		Token:            token,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(f.path, content, 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the permissions of an existing file
+	return os.Chmod(f.path, 0600)
+}
+
+func (f *fileTokenCache) Clear() error {
+	if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// saveToken caches the token minted by the auth dialog when TokenCache is
+// set. A failure is only logged, since the diagnosis does not depend on it.
+func (c *Config) saveToken(token *oauth2.Token) {
+	if c.TokenCache == nil || token.RefreshToken == "" {
+		return
+	}
+	if err := c.TokenCache.Save(c.ConfigFile.ClientID, c.ConfigFile.ClientSecret, token); err != nil {
+		log.Printf("Cannot cache the token: %s", err)
+	}
+}
+
+// cachedTokenSource returns the token source of the token cached by a
+// previous run, which refreshes its access token when it has expired, and the
+// refresh token to replace the one in the configuration file. It returns nil
+// when no token is cached, or when the cached token is rejected, in which
+// case the cache is cleared and the auth dialog is needed.
+func (c *Config) cachedTokenSource(ctx context.Context) (oauth2.TokenSource, string) {
+	if c.TokenCache == nil {
+		return nil, ""
+	}
+	token, err := c.TokenCache.Load(c.ConfigFile.ClientID, c.ConfigFile.ClientSecret)
+	if err != nil {
+		log.Printf("Cannot read the cached token: %s", err)
+		return nil, ""
+	}
+	// The refresh token in the configuration file has already failed
+	if token == nil || token.RefreshToken == c.ConfigFile.RefreshToken {
+		return nil, ""
+	}
+
+	conf := c.oauth2Conf("")
+	ts := conf.TokenSource(ctx, token)
+	tok, err := ts.Token()
+	if err == nil {
+		err = c.checkTokenScopes(tok)
+	}
+	if err != nil {
+		log.Printf("The cached token is rejected, so it is removed: %s", c.redact(err.Error()))
+		if err := c.TokenCache.Clear(); err != nil {
+			log.Printf("Cannot remove the cached token: %s", err)
+		}
+		return nil, ""
+	}
+
+	log.Print("Using the token cached by a previous run instead of the auth dialog.")
+	c.saveToken(tok)
+	refreshToken := tok.RefreshToken
+	return newRefreshableSource(tok, func() oauth2.TokenSource {
+		return conf.TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken})
+	}), tok.RefreshToken
+}
@@ -0,0 +1,124 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"oauthdoctor/diag"
+
+	"golang.org/x/oauth2"
+)
+
+func TestFileTokenCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oauthdoctor")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "oauthdoctor", "token.json")
+	cache := NewFileTokenCache(path)
+	if token, err := cache.Load("ClientID", "ClientSecret"); token != nil || err != nil {
+		t.Errorf("Load without a cache file - got: %v, %v, want: nil, nil", token, err)
+	}
+
+	want := &oauth2.Token{AccessToken: "AccessToken", RefreshToken: "RefreshToken"}
+	if err := cache.Save("ClientID", "ClientSecret", want); err != nil {
+		t.Fatalf("Save - got error: %s", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("cache file - got: %v, %v, want mode 0600", info, err)
+	}
+	content, _ := ioutil.ReadFile(path)
+	if got := string(content); !strings.Contains(got, "RefreshToken") || strings.Contains(got, "ClientSecret") {
+		t.Errorf("cache file - got: %s, want the token without the client secret", got)
+	}
+
+	got, err := cache.Load("ClientID", "ClientSecret")
+	if err != nil || got == nil || got.RefreshToken != want.RefreshToken {
+		t.Errorf("Load - got: %v, %v, want: %v", got, err, want)
+	}
+
+	// A changed client secret invalidates the cache
+	if got, err := cache.Load("ClientID", "NewClientSecret"); got != nil || err != nil {
+		t.Errorf("Load with another client secret - got: %v, %v, want: nil, nil", got, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("cache file is not removed with another client secret: %v", err)
+	}
+}
+
+func TestConnectWithCachedToken(t *testing.T) {
+	tests := []struct {
+		desc   string
+		token  *oauth2.Token
+		status int
+		body   string
+		want   bool
+	}{
+		{
+			desc:   "Valid cached token",
+			token:  &oauth2.Token{AccessToken: "AccessToken", RefreshToken: "CachedRefreshToken", Expiry: time.Now().Add(time.Hour)},
+			status: http.StatusOK,
+			body:   `{"resourceName": "customers/1234567890"}`,
+			want:   true,
+		},
+		{
+			desc:   "Revoked cached token",
+			token:  &oauth2.Token{AccessToken: "AccessToken", RefreshToken: "CachedRefreshToken", Expiry: time.Now().Add(-time.Hour)},
+			status: http.StatusBadRequest,
+			body:   `{"error": "invalid_grant", "error_description": "Token has been expired or revoked."}`,
+		},
+		{
+			desc:  "Cached refresh token already in the configuration file",
+			token: &oauth2.Token{AccessToken: "AccessToken", RefreshToken: "BadRefreshToken", Expiry: time.Now().Add(time.Hour)},
+		},
+	}
+
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "oauthdoctor")
+		if err != nil {
+			t.Fatalf("Error creating temp dir: %s", err)
+		}
+		cache := NewFileTokenCache(filepath.Join(dir, "token.json"))
+		if err := cache.Save("ClientID", "ClientSecret", test.token); err != nil {
+			t.Fatalf("%s: Save - got error: %s", test.desc, err)
+		}
+
+		c := fakeConfig(test.status, test.body)
+		c.TokenCache = cache
+		c.ConfigFile = diag.ConfigFile{
+			Lang: "python",
+			ConfigKeys: diag.ConfigKeys{DevToken: "GoodDevToken", ClientID: "ClientID",
+				ClientSecret: "ClientSecret", RefreshToken: "BadRefreshToken"},
+		}
+		_, refreshToken, ok, err := c.connectWithCachedToken(context.Background())
+		if ok != test.want || (ok && (err != nil || refreshToken != "CachedRefreshToken")) {
+			t.Errorf("%s: got: %q, %t, %v, want ok: %t", test.desc, refreshToken, ok, err, test.want)
+		}
+		cached, _ := cache.Load("ClientID", "ClientSecret")
+		if rejected := test.status == http.StatusBadRequest; rejected != (cached == nil) {
+			t.Errorf("%s: cached token - got: %v, want it removed only when rejected", test.desc, cached)
+		}
+		os.RemoveAll(dir)
+	}
+}
@@ -21,44 +21,39 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"net/http"
+	"net/url"
+	"oauthdoctor/diag"
+	"runtime"
 
 	"golang.org/x/oauth2"
 )
 
-var authCode = make(chan string)
+// webRedirectURL is the default redirect URL for the web flow, which is
+// served by the HTTP server of the doctor.
+const webRedirectURL = "http://localhost:8080"
+
+// webServerAddr is the address of the HTTP server of webRedirectURL.
+const webServerAddr = ":8080"
 
 // simulateWebFlow simulates the web flow to see if it succeeds
 // or fails. If it fails, it will try to examine the error and prompt user
-// to fix it. Then it retries to connect again and prints the result of the
-// 2nd attempt.
-func (c *Config) simulateWebFlow() {
-	// Can only register the handle once
-	http.HandleFunc("/", serverHandler)
-
-	accountInfo, err := c.connectWebFlow()
-
-	if err != nil {
-		if c.Verbose {
-			log.Print(err)
-		}
-		c.diagnose(err)
-		accountInfo, err = c.connectWebFlow()
+// to fix it. Then it retries to connect again, see fixAndRetry, and prints
+// the result of the last attempt.
+func (c *Config) simulateWebFlow(ctx context.Context) {
+	if c.NonInteractive {
+		msg := "The web flow requires signing in with a browser and cannot " +
+			"run in non-interactive mode."
+		diag.Error(msg)
+		c.fail(UnknownError, msg, nil)
+		return
 	}
 
-	close(authCode)
+	accountInfo, err := c.connectWebFlow(ctx)
+	accountInfo, err = c.fixAndRetry(ctx, accountInfo, err, func(error) (*bytes.Buffer, error) {
+		return c.connectWebFlow(ctx)
+	})
 
-	if err == nil {
-		if c.Verbose {
-			log.Print(accountInfo.String())
-		}
-		log.Println("SUCCESS: OAuth test passed with given config file settings.")
-	} else {
-		if c.Verbose {
-			log.Println(err)
-		}
-		log.Println("ERROR: OAuth test failed.")
-	}
+	c.finish(accountInfo, err)
 }
 
 // connectWebFlow connects with web flow OAuth2 and starts a web server in the
@@ -67,45 +62,101 @@ func (c *Config) simulateWebFlow() {
 // after the authentication and authorization step. Once the auth code is
 // received in the background process, the command line will continue the
 // simulation process.
-func (c *Config) connectWebFlow() (*bytes.Buffer, error) {
-	log.Print("Verify \"Authorized redirect URIs\"=localhost:8080 in " +
-		"your OAuth 2.0 client ID in Google cloud project before you proceed. " +
-		"Follow this guide for further instructions: " +
-		"https://developers.google.com/google-ads/api/docs/oauth/cloud-project")
-	conf := c.oauth2Conf("http://localhost:8080")
-
+func (c *Config) connectWebFlow(ctx context.Context) (*bytes.Buffer, error) {
+	if accountInfo, _, ok, err := c.connectWithCachedToken(ctx); ok {
+		return accountInfo, err
+	}
+	redirectURL := c.webRedirectURL()
+	c.redirectURL = redirectURL
+	log.Printf("Verify \"Authorized redirect URIs\"=%s in "+
+		"your OAuth 2.0 client ID in Google cloud project before you proceed. "+
+		"Follow this guide for further instructions: "+
+		"https://developers.google.com/google-ads/api/docs/oauth/cloud-project", redirectURL)
+	conf := c.oauth2Conf(redirectURL)
+
+	state, err := newState()
+	if err != nil {
+		return nil, err
+	}
 	// Redirect user to Google's consent page to ask for permission
 	// for the scopes specified above.
-	url := conf.AuthCodeURL("state", oauth2.AccessTypeOffline)
-	log.Printf("Visit the URL for the auth dialog:\n%s\n", url)
-
-	srv := runServer()
+	url := conf.AuthCodeURL(state, oauth2.AccessTypeOffline)
 
-	code, _ := <-authCode
+	var code string
+	if redirectURL == webRedirectURL {
+		code, err = c.serveRedirect(ctx, url, state)
+	} else {
+		code, err = c.promptRedirectedCode(url, redirectURL)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	srv.Shutdown(context.Background())
+	client, _, err := c.oauth2Client(ctx, redirectURL, code)
+	if err != nil {
+		return nil, err
+	}
+	return c.getAccount(ctx, client)
+}
 
-	client, _ := c.oauth2Client(code)
-	return c.getAccount(client)
+// webRedirectURL returns the redirect URL of the web flow, which is
+// RedirectURL when it is set.
+func (c *Config) webRedirectURL() string {
+	if c.RedirectURL != "" {
+		return c.RedirectURL
+	}
+	return webRedirectURL
 }
 
-// runServer starts a HTTP server as a background process.
-func runServer() *http.Server {
+// serveRedirect starts the HTTP server of webRedirectURL in the background,
+// opens the auth URL and waits for the auth code sent to the redirect URL.
+// The server only serves the auth request of state.
+func (c *Config) serveRedirect(ctx context.Context, authURL, state string) (string, error) {
 	log.Print("Running HTTP server in the background at port 8080...")
-	srv := &http.Server{Addr: ":8080"}
-	go srv.ListenAndServe()
-	return srv
+	srv, err := startRedirectServer(webServerAddr, state)
+	if err != nil {
+		return "", err
+	}
+	defer srv.close()
+
+	c.launchBrowser(authURL)
+	return waitForAuthCode(ctx, srv.codes, srv.errs)
 }
 
-// serverHandler handles all the HTTP home page requests. It parses the auth
-// code and sends it to the channel, so the parent process can continue the
-// simulation at the command line.
-func serverHandler(w http.ResponseWriter, r *http.Request) {
-	code := r.URL.Query().Get("code")
+// promptRedirectedCode opens the auth URL and prompts for the auth code when
+// the redirect URL is served by another server, e.g. the server of your app,
+// which the doctor cannot listen on. The code is copied from the URL of the
+// redirected page instead.
+func (c *Config) promptRedirectedCode(authURL, redirectURL string) (string, error) {
+	c.launchBrowser(authURL)
+	log.Printf("After the consent, your browser is redirected to %s, "+
+		"which is not served by the doctor. An auth code can only be "+
+		"exchanged once, so make sure your server does not exchange it "+
+		"before the doctor does.", redirectURL)
+	log.Print(genAuthCodePrompt(runtime.GOOS))
+	code, err := c.prompter().Prompt("Enter Code")
+	if err != nil && code == "" {
+		return "", err
+	}
+	return code, nil
+}
 
-	if code != "" {
-		authCode <- code
-		log.Print("OAuth code received by the HTTP server handler: " + code)
-		fmt.Fprintf(w, "Auth code received by diagnose-googleads tool")
+// ParseRedirectURL verifies the redirect URL of the web flow, e.g.
+// https://example.com/oauth2callback. It must be an absolute http or https
+// URL without a fragment, as registered in the OAuth client ID.
+func ParseRedirectURL(redirectURL string) (string, error) {
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid redirect URL %q: %s", redirectURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("invalid redirect URL %q: the scheme must be http or https", redirectURL)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid redirect URL %q: missing host", redirectURL)
+	}
+	if u.Fragment != "" {
+		return "", fmt.Errorf("invalid redirect URL %q: it cannot contain a fragment", redirectURL)
 	}
+	return redirectURL, nil
 }
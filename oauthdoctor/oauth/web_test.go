@@ -0,0 +1,140 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseRedirectURL(t *testing.T) {
+	tests := []struct {
+		redirectURL string
+		valid       bool
+	}{
+		{redirectURL: "https://example.com/oauth2callback", valid: true},
+		{redirectURL: "http://localhost:8000/", valid: true},
+		{redirectURL: "example.com/oauth2callback", valid: false},
+		{redirectURL: "urn:ietf:wg:oauth:2.0:oob", valid: false},
+		{redirectURL: "https://", valid: false},
+		{redirectURL: "https://example.com/#callback", valid: false},
+	}
+
+	for _, test := range tests {
+		_, err := ParseRedirectURL(test.redirectURL)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("ParseRedirectURL(%q) - got valid: %t, want valid: %t, err: %v",
+				test.redirectURL, valid, test.valid, err)
+		}
+	}
+}
+
+func TestConnectWebFlowRedirectURL(t *testing.T) {
+	const redirectURL = "https://example.com/oauth2callback"
+	var exchanged string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/token" {
+			exchanged = r.FormValue("code") + " " + r.FormValue("redirect_uri")
+			fmt.Fprint(w, `{"access_token": "AccessToken", "token_type": "Bearer", "expires_in": 3600}`)
+			return
+		}
+		fmt.Fprint(w, `{"resourceName": "customers/1234567890"}`)
+	}))
+	defer server.Close()
+
+	prompter := &scriptedPrompter{answers: []string{"AuthCode"}}
+	c := &Config{
+		CustomerID:    "1234567890",
+		Endpoint:      server.URL,
+		HTTPClient:    server.Client(),
+		OAuthType:     Web,
+		Prompter:      prompter,
+		RedirectURL:   redirectURL,
+		TokenEndpoint: server.URL + "/token",
+	}
+	if _, err := c.connectWebFlow(context.Background()); err != nil {
+		t.Fatalf("connectWebFlow - got error: %s", err)
+	}
+	if want := "AuthCode " + redirectURL; exchanged != want {
+		t.Errorf("token exchange - got: %q, want: %q", exchanged, want)
+	}
+	if fmt.Sprint(prompter.labels) != "[Enter Code]" {
+		t.Errorf("prompts - got: %v, want: [Enter Code]", prompter.labels)
+	}
+}
+
+func TestDiagnoseRedirectURIMismatch(t *testing.T) {
+	c := &Config{NonInteractive: true, OAuthType: Web, RedirectURL: "https://example.com/oauth2callback"}
+	err := errors.New(`oauth2: cannot fetch token: 400 Bad Request Response: {"error": "redirect_uri_mismatch", "error_description": "Bad Request"}`)
+	if c.diagnose(context.Background(), err) {
+		t.Errorf("diagnose - got: true, want: false in non-interactive mode")
+	}
+	if c.report.Code != RedirectURIMismatch {
+		t.Errorf("report code - got: %s, want: RedirectURIMismatch", errorNames[c.report.Code])
+	}
+}
+
+func TestRedirectServerLateRedirect(t *testing.T) {
+	srv, err := startRedirectServer(LoopbackHost+":0", "GoodState")
+	if err != nil {
+		t.Fatalf("startRedirectServer - got error: %s", err)
+	}
+	defer srv.close()
+
+	// The redirects after the first one are answered without blocking
+	client := &http.Client{Timeout: 5 * time.Second}
+	for _, code := range []string{"GoodAuthCode", "LateAuthCode"} {
+		resp, err := client.Get(srv.redirectURL() + "/?state=GoodState&code=" + code)
+		if err != nil {
+			t.Fatalf("redirect of %s - got error: %s", code, err)
+		}
+		resp.Body.Close()
+	}
+	if got := <-srv.codes; got != "GoodAuthCode" {
+		t.Errorf("auth code - got: %s, want: GoodAuthCode", got)
+	}
+}
+
+func TestRedirectServerStateMismatch(t *testing.T) {
+	srv, err := startRedirectServer(LoopbackHost+":0", "GoodState")
+	if err != nil {
+		t.Fatalf("startRedirectServer - got error: %s", err)
+	}
+	defer srv.close()
+
+	for _, query := range []string{"state=BadState&code=ForgedAuthCode", "code=ForgedAuthCode",
+		"state=BadState&error=access_denied"} {
+		resp, err := http.Get(srv.redirectURL() + "/?" + query)
+		if err != nil {
+			t.Fatalf("redirect %s - got error: %s", query, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("redirect %s - got status: %d, want: %d", query, resp.StatusCode, http.StatusBadRequest)
+		}
+	}
+	select {
+	case code := <-srv.codes:
+		t.Errorf("auth code - got: %s, want none", code)
+	case err := <-srv.errs:
+		t.Errorf("redirect error - got: %s, want none", err)
+	default:
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+// This file contains the credential wizard, which fixes the client ID and
+// secret and the refresh token of the installed app flow in one session.
+
+import (
+	"bytes"
+	"context"
+	"log"
+
+	"oauthdoctor/diag"
+)
+
+// wizardSteps is the number of steps of the credential wizard.
+const wizardSteps = 3
+
+// refreshTokenCodes are the errors that a new refresh token fixes.
+var refreshTokenCodes = []int32{InvalidRefreshToken, Unauthorized, InsufficientScope,
+	AccessNotPermittedForManagerAccount}
+
+// runWizard walks through the fixes of the credentials after err, the error
+// of the first attempt of the installed app flow: it sets the client ID and
+// secret when they are rejected, then runs the installed app flow for a new
+// refresh token when the refresh token is rejected, and then verifies the
+// configuration. The configuration file is updated after each step, and each
+// step can be skipped. It returns the result of the verification, whose
+// error is diagnosed as usual, or err when the error is not about the
+// credentials.
+func (c *Config) runWizard(ctx context.Context, err error) (*bytes.Buffer, error) {
+	code := c.decodeError(err)
+	if code != InvalidClientInfo && !containsCode(refreshTokenCodes, code) {
+		log.Printf("Credential wizard: the error %s is not about the client "+
+			"ID, the client secret or the refresh token, so it is diagnosed "+
+			"as usual.", errorNames[code])
+		return nil, err
+	}
+	log.Print("Credential wizard: the client ID and secret, then the " +
+		"refresh token are fixed, and the configuration is verified. Each " +
+		"step can be skipped.")
+
+	wizardStep(1, "Set the client ID and client secret")
+	if code != InvalidClientInfo {
+		log.Print("Skipped: the client ID and client secret are accepted.")
+	} else if c.confirm("Would you like to enter a new client ID and client secret?", true) {
+		keys := c.ConfigFile.ConfigKeys
+		// A new client ID comes with its own secret, so both are entered
+		c.replaceCloudCredentials([]string{diag.ClientID, diag.ClientSecret})
+		c.reloadConfig(keys)
+		accountInfo, oErr := c.connectWithRefreshToken(ctx)
+		if oErr == nil {
+			return accountInfo, nil
+		}
+		err, code = oErr, c.decodeError(oErr)
+	} else {
+		log.Print("Skipped: the client ID and client secret are NOT replaced.")
+	}
+
+	wizardStep(2, "Generate a new refresh token")
+	switch {
+	case code == InvalidClientInfo:
+		log.Print("Skipped: the client ID and client secret are still " +
+			"rejected, so a refresh token cannot be generated with them.")
+	case !containsCode(refreshTokenCodes, code):
+		log.Print("Skipped: the refresh token is accepted.")
+	case c.confirm("Would you like to run the installed app flow now to "+
+		"generate a new refresh token?", true):
+		keys := c.ConfigFile.ConfigKeys
+		log.Print("Attempting to regenerate refresh token...")
+		if _, refreshToken, oErr := c.connectWithNoRefreshToken(ctx); refreshToken != "" {
+			c.replaceConfig(diag.RefreshToken, refreshToken)
+			c.reloadConfig(keys)
+		} else if oErr != nil {
+			log.Print("Skipped: no refresh token was generated: " + c.redact(oErr.Error()))
+		}
+	default:
+		log.Print("Skipped: the refresh token is NOT replaced.")
+	}
+
+	wizardStep(3, "Verify the configuration")
+	return c.connectWithRefreshToken(ctx)
+}
+
+// wizardStep prints the title of the nth step of the credential wizard.
+func wizardStep(n int, title string) {
+	log.Printf("Step %d of %d: %s", n, wizardSteps, title)
+}
+
+// containsCode reports whether codes contains code.
+func containsCode(codes []int32, code int32) bool {
+	for _, cd := range codes {
+		if cd == code {
+			return true
+		}
+	}
+	return false
+}
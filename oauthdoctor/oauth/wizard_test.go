@@ -0,0 +1,128 @@
+// Copyright 2019 Google LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"oauthdoctor/diag"
+)
+
+// wizardServer returns a server that only accepts the client NewClientID and
+// the refresh token NewRefreshToken, which it issues for any auth code.
+func wizardServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/token" {
+			fmt.Fprint(w, `{"resourceName": "customers/1234567890"}`)
+			return
+		}
+		clientID, _, ok := r.BasicAuth()
+		if !ok {
+			clientID = r.FormValue("client_id")
+		}
+		switch {
+		case clientID != "NewClientID":
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error": "invalid_client", "error_description": "The OAuth client was not found."}`)
+		case r.FormValue("grant_type") == "authorization_code":
+			fmt.Fprint(w, `{"access_token": "AccessToken", "token_type": "Bearer", "expires_in": 3600, "refresh_token": "NewRefreshToken"}`)
+		case r.FormValue("refresh_token") != "NewRefreshToken":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error": "unauthorized_client", "error_description": "Unauthorized"}`)
+		default:
+			fmt.Fprint(w, `{"access_token": "AccessToken", "token_type": "Bearer", "expires_in": 3600}`)
+		}
+	}))
+}
+
+func TestRunWizard(t *testing.T) {
+	tests := []struct {
+		desc    string
+		answers []string
+		wantErr bool
+		want    diag.ConfigKeys
+	}{
+		{
+			desc:    "Client and refresh token are fixed in one session",
+			answers: []string{"y", "NewClientID", "NewClientSecret", "y", "AuthCode"},
+			want: diag.ConfigKeys{ClientID: "NewClientID", ClientSecret: "NewClientSecret",
+				RefreshToken: "NewRefreshToken"},
+		},
+		{
+			desc:    "Refresh token step is skipped",
+			answers: []string{"y", "NewClientID", "NewClientSecret", "n"},
+			wantErr: true,
+			want: diag.ConfigKeys{ClientID: "NewClientID", ClientSecret: "NewClientSecret",
+				RefreshToken: "OldRefreshToken"},
+		},
+		{
+			desc:    "Client step is skipped",
+			answers: []string{"n"},
+			wantErr: true,
+			want: diag.ConfigKeys{ClientID: "OldClientID", ClientSecret: "OldClientSecret",
+				RefreshToken: "OldRefreshToken"},
+		},
+	}
+
+	server := wizardServer()
+	defer server.Close()
+
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "oauthdoctor")
+		if err != nil {
+			t.Fatalf("Error creating temp dir: %s", err)
+		}
+		defer os.RemoveAll(dir)
+		content := "client_id: OldClientID\nclient_secret: OldClientSecret\nrefresh_token: OldRefreshToken\n"
+		if err := ioutil.WriteFile(filepath.Join(dir, "google-ads.yaml"), []byte(content), 0600); err != nil {
+			t.Fatalf("Error writing config file: %s", err)
+		}
+
+		c := &Config{
+			CustomerID:    "1234567890",
+			Endpoint:      server.URL,
+			HTTPClient:    server.Client(),
+			OAuthType:     InstalledApp,
+			Prompter:      &scriptedPrompter{answers: test.answers},
+			TokenEndpoint: server.URL + "/token",
+			Wizard:        true,
+			ConfigFile: diag.ConfigFile{
+				Filename: "google-ads.yaml",
+				Filepath: dir,
+				Lang:     "python",
+				ConfigKeys: diag.ConfigKeys{ClientID: "OldClientID", ClientSecret: "OldClientSecret",
+					RefreshToken: "OldRefreshToken"},
+			},
+		}
+		_, err = c.connectWithRefreshToken(context.Background())
+		if err == nil {
+			t.Fatalf("%s: connectWithRefreshToken - got no error, want invalid_client", test.desc)
+		}
+		_, err = c.runWizard(context.Background(), err)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("%s: runWizard - got error: %v, want error: %t", test.desc, err, test.wantErr)
+		}
+		if c.ConfigFile.ConfigKeys != test.want {
+			t.Errorf("%s: config keys - got: %+v, want: %+v", test.desc, c.ConfigFile.ConfigKeys, test.want)
+		}
+	}
+}